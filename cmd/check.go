@@ -2,12 +2,17 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/luxfi/genesis/pkg/application"
 	"github.com/luxfi/genesis/pkg/balance"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/invariant"
 	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
 	"github.com/spf13/cobra"
 )
 
@@ -20,6 +25,111 @@ func NewCheckCmd(app *application.Genesis) *cobra.Command {
 	}
 
 	// Future checks like `check migration`, `check db`, etc. can be added here.
+	cmd.AddCommand(newCheckInvariantsCmd(app))
+
+	return cmd
+}
+
+// newCheckInvariantsCmd creates the `check invariants` subcommand.
+func newCheckInvariantsCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbType string
+		only   []string
+		fix    bool
+		yes    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "invariants [db-path]",
+		Short: "Checks the chain database invariants geth and coreth need to start",
+		Long: `Checks the head block, head header and head fast block pointers, the genesis
+block, the continuity of the canonical chain, the presence of every canonical
+header, body and receipt list, and the chain config. Only the key-value store
+is read, so blocks that were moved into a freezer count as missing.
+
+With --fix the repairs for the violated invariants are planned and shown, and
+only applied after confirmation (or straight away with --yes).`,
+		Example: `  genesis check invariants /data/cchain/ethdb --type badgerdb --fix`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			invariants := invariant.All()
+			if len(only) > 0 {
+				var err error
+				if invariants, err = invariant.Select(only); err != nil {
+					return err
+				}
+			}
+
+			kv, err := database.OpenKeyValueStore(database.DatabaseType(dbType), args[0], database.BackendOptions{ReadOnly: !fix})
+			if err != nil {
+				return err
+			}
+			defer kv.Close()
+			db := rawdb.NewDatabase(kv)
+
+			results := invariant.Check(db, invariants)
+			violated := 0
+			for _, r := range results {
+				switch {
+				case r.Err != nil:
+					cmd.Printf("❌ %s: %v\n", r.Invariant.Name(), r.Err)
+					violated++
+				case len(r.Violations) > 0:
+					cmd.Printf("❌ %s\n", r.Invariant.Name())
+					for _, v := range r.Violations {
+						cmd.Printf("   %s\n", v.Message)
+					}
+					violated++
+				default:
+					cmd.Printf("✅ %s\n", r.Invariant.Name())
+				}
+			}
+			if violated == 0 {
+				return nil
+			}
+			if !fix {
+				return fmt.Errorf("%d invariants violated", violated)
+			}
+
+			plans, unfixed, err := invariant.PlanFixes(db, results)
+			if err != nil {
+				return err
+			}
+			if len(plans) == 0 {
+				return fmt.Errorf("%d invariants violated, none can be fixed automatically", violated)
+			}
+			cmd.Println("\nPlanned fixes:")
+			for _, plan := range plans {
+				plan.Print(cmd.OutOrStdout())
+			}
+			if len(unfixed) > 0 {
+				cmd.Printf("No automatic fix for: %s\n", strings.Join(unfixed, ", "))
+			}
+
+			if !yes {
+				cmd.Print("\nApply these fixes? [y/N] ")
+				answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					return fmt.Errorf("fixes not applied")
+				}
+			}
+			for _, plan := range plans {
+				if err := plan.Apply(kv); err != nil {
+					return err
+				}
+			}
+			cmd.Printf("Applied %d fixes\n", len(plans))
+			if len(unfixed) > 0 {
+				return fmt.Errorf("%d invariants still need manual repair", len(unfixed))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
+	cmd.Flags().StringSliceVar(&only, "only", nil, "Check only the named invariants")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Plan fixes for violated invariants and apply them after confirmation")
+	cmd.Flags().BoolVar(&yes, "yes", false, "Apply fixes without asking")
 
 	return cmd
 }
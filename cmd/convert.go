@@ -34,7 +34,7 @@ func newConvertDenamespaceCmd(app *application.Genesis) *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&namespace, "namespace", "", "Namespace to remove")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Namespace to remove (hex encoded, detected when omitted)")
 
 	return cmd
 }
@@ -3,7 +3,10 @@ package cmd
 import (
 	"encoding/hex"
 	"fmt"
+	"os"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/luxfi/genesis/pkg/application"
 	"github.com/luxfi/genesis/pkg/database"
@@ -24,6 +27,8 @@ func NewDatabaseCmd(app *application.Genesis) *cobra.Command {
 	cmd.AddCommand(newDatabasePrepareMigrationCmd(app))
 	cmd.AddCommand(newDatabaseCompactCmd(app))
 	cmd.AddCommand(newDatabaseConvertCmd(app))
+	cmd.AddCommand(newDatabaseNamespaceCmd(app))
+	cmd.AddCommand(newDatabaseFreezeCmd(app))
 
 	return cmd
 }
@@ -119,15 +124,115 @@ func newDatabaseCompactCmd(app *application.Genesis) *cobra.Command {
 	return cmd
 }
 
+func newDatabaseNamespaceCmd(app *application.Genesis) *cobra.Command {
+	var dbType string
+
+	cmd := &cobra.Command{
+		Use:   "namespace [db-path]",
+		Short: "Detect the SubnetEVM namespace prefix of a database",
+		Long: `Samples keys across the database and lists the 32-byte prefixes they share.
+A candidate is confirmed when a canonical hash entry (h + number + n) can be
+decoded under it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kv, err := database.OpenKeyValueStore(database.DatabaseType(dbType), args[0], database.BackendOptions{ReadOnly: true})
+			if err != nil {
+				return err
+			}
+			defer kv.Close()
+
+			candidates, err := database.DetectNamespaces(kv)
+			if err != nil {
+				return err
+			}
+			if len(candidates) == 0 {
+				fmt.Println("No namespace candidates found")
+				return nil
+			}
+			for _, c := range candidates {
+				status := "unconfirmed"
+				if c.Confirmed {
+					status = fmt.Sprintf("confirmed (block %d = %s)", c.CanonicalBlock, c.CanonicalHash.Hex())
+				}
+				fmt.Printf("%x  samples=%d  %s\n", c.Prefix, c.Samples, status)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
+
+	return cmd
+}
+
+func newDatabaseFreezeCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbType  string
+		ancient string
+		below   uint64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "freeze [db-path]",
+		Short: "Move old blocks from the key-value store into a freezer",
+		Long: `Moves the canonical headers, bodies and receipts of every block below
+--below into geth's freezer format, then deletes the key-value copies. The
+freezer is created in <db-path>/ancient unless --ancient is given. Blocks that
+are already frozen are skipped, so an interrupted run can be repeated.
+
+Example:
+  genesis database freeze /path/to/chaindata --below 1000000`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if below == 0 {
+				return fmt.Errorf("--below is required")
+			}
+			if ancient == "" {
+				ancient = database.AncientPath(args[0])
+			}
+
+			kv, err := database.OpenKeyValueStore(database.DatabaseType(dbType), args[0], database.BackendOptions{})
+			if err != nil {
+				return err
+			}
+			defer kv.Close()
+
+			stats, err := database.Freeze(kv, ancient, below, os.Stdout)
+			if err != nil {
+				return err
+			}
+			if stats.Blocks > 0 {
+				fmt.Printf("Froze blocks %d-%d (%d blocks, %.1f MB) into %s\n",
+					stats.From, stats.To, stats.Blocks, float64(stats.Bytes)/(1024*1024), ancient)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
+	cmd.Flags().StringVar(&ancient, "ancient", "", "Freezer directory (default: <db-path>/ancient)")
+	cmd.Flags().Uint64Var(&below, "below", 0, "Freeze every block with a lower number")
+
+	return cmd
+}
+
 func newDatabaseConvertCmd(app *application.Genesis) *cobra.Command {
 	var (
-		sourceType      string
-		destType        string
-		conversionType  string
-		namespace       string
-		batchSize       int
-		verbose         bool
-		fixCanonical    bool
+		sourceType     string
+		destType       string
+		conversionType string
+		namespace      string
+		batchSize      int
+		verbose        bool
+		fixCanonical   bool
+		resume         bool
+		saveInterval   time.Duration
+		workers        int
+		freezeBelow    uint64
+		receipts       bool
+		dropReceipts   bool
+		fromBlock      uint64
+		toBlock        uint64
 	)
 
 	cmd := &cobra.Command{
@@ -142,6 +247,13 @@ Supported conversions:
 - badger-to-pebble: Convert BadgerDB to PebbleDB
 - denamespace: Remove namespace prefix from all keys
 - add-namespace: Add namespace prefix to all keys
+- leveldb-to-pebble, leveldb-to-badger: Convert a goleveldb snapshot
+- pebble-to-leveldb, badger-to-leveldb: Convert back to goleveldb
+
+The leveldb conversions set --source-type and --dest-type from their name and
+fail if either flag names another backend. They detect a namespace like
+subnet-to-coreth does and, when one is found or given with --namespace, copy
+only the keys under it and remove the prefix.
 
 Examples:
   # Convert SubnetEVM PebbleDB to Coreth BadgerDB
@@ -152,7 +264,29 @@ Examples:
 
   # Simple PebbleDB to BadgerDB conversion
   genesis database convert /path/to/pebble.db /path/to/badger.db \
-    --conversion=pebble-to-badger`,
+    --conversion=pebble-to-badger
+
+Subnet-to-coreth, denamespace, pebble-to-badger and the leveldb conversions
+split the source keyspace into --workers ranges that are copied in parallel. They save a
+checkpoint next to the destination (<dest-db>.checkpoint.json) after every
+batch, or with --checkpoint-interval once per interval and when a worker
+finishes. Re-run the same command with --resume to continue after a crash or
+interrupt; the saved ranges are continued whatever --workers is set to. The
+other conversions copy with a single iterator and cannot be resumed.
+
+Subnet-to-coreth and denamespace conversions also validate every receipt list
+against its header's receipt root and re-encode it in the coreth layout. The
+receipts of blocks that fail the check are listed and copied unchanged, or
+removed with --drop-invalid-receipts. Disable this pass with
+--convert-receipts=false.
+
+--freeze-below moves the blocks below that number into <dest-db>/ancient once
+the conversion is done, as "genesis database freeze" does.
+
+--from-block and --to-block copy only the canonical blocks in that range, plus
+genesis and the chain config, and the state reachable from the root at
+--to-block, which defaults to the source head. The head pointers are set to
+--to-block. Such conversions are not checkpointed.`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			sourcePath := args[0]
@@ -170,15 +304,23 @@ Examples:
 
 			// Create conversion config
 			config := &database.ConversionConfig{
-				SourcePath:      sourcePath,
-				DestPath:        destPath,
-				SourceType:      database.DatabaseType(sourceType),
-				DestType:        database.DatabaseType(destType),
-				ConversionType:  database.ConversionType(conversionType),
-				Namespace:       namespaceBytes,
-				BatchSize:       batchSize,
-				Verbose:         verbose,
-				FixCanonical:    fixCanonical,
+				SourcePath:          sourcePath,
+				DestPath:            destPath,
+				SourceType:          database.DatabaseType(sourceType),
+				DestType:            database.DatabaseType(destType),
+				ConversionType:      database.ConversionType(conversionType),
+				Namespace:           namespaceBytes,
+				BatchSize:           batchSize,
+				Verbose:             verbose,
+				FixCanonical:        fixCanonical,
+				Resume:              resume,
+				CheckpointInterval:  saveInterval,
+				Workers:             workers,
+				FreezeBelow:         freezeBelow,
+				ConvertReceipts:     receipts,
+				DropInvalidReceipts: dropReceipts,
+				FromBlock:           fromBlock,
+				ToBlock:             toBlock,
 			}
 
 			// Run conversion
@@ -192,13 +334,21 @@ Examples:
 		},
 	}
 
-	cmd.Flags().StringVar(&sourceType, "source-type", "pebbledb", "Source database type (pebbledb, badgerdb, leveldb)")
-	cmd.Flags().StringVar(&destType, "dest-type", "badgerdb", "Destination database type (pebbledb, badgerdb, leveldb)")
+	cmd.Flags().StringVar(&sourceType, "source-type", "", "Source database type (pebbledb, badgerdb, leveldb; default: pebbledb, or the leveldb conversion's)")
+	cmd.Flags().StringVar(&destType, "dest-type", "", "Destination database type (pebbledb, badgerdb, leveldb; default: badgerdb, or the leveldb conversion's)")
 	cmd.Flags().StringVar(&conversionType, "conversion", "pebble-to-badger", "Conversion type")
-	cmd.Flags().StringVar(&namespace, "namespace", "", "Namespace to add/remove (hex encoded)")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Namespace to add/remove (hex encoded, detected for subnet-to-coreth, denamespace and leveldb-to-* when omitted)")
 	cmd.Flags().IntVar(&batchSize, "batch-size", 10000, "Batch size for conversion")
 	cmd.Flags().BoolVar(&verbose, "verbose", false, "Verbose output")
 	cmd.Flags().BoolVar(&fixCanonical, "fix-canonical", true, "Fix missing canonical mappings")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Continue from the checkpoint left by an interrupted conversion")
+	cmd.Flags().DurationVar(&saveInterval, "checkpoint-interval", 0, "Least time between checkpoint saves (0 saves after every batch)")
+	cmd.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "Number of key ranges to copy in parallel")
+	cmd.Flags().Uint64Var(&freezeBelow, "freeze-below", 0, "Move blocks below this number into the destination freezer (0 disables)")
+	cmd.Flags().BoolVar(&receipts, "convert-receipts", true, "Validate receipts against their header roots and re-encode them for coreth")
+	cmd.Flags().BoolVar(&dropReceipts, "drop-invalid-receipts", false, "Delete receipts that fail validation instead of keeping them")
+	cmd.Flags().Uint64Var(&fromBlock, "from-block", 0, "First canonical block to copy")
+	cmd.Flags().Uint64Var(&toBlock, "to-block", 0, "Last canonical block to copy and the block whose state is copied (default: head)")
 
 	return cmd
 }
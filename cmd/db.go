@@ -2,16 +2,20 @@ package cmd
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 
 	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
 	"github.com/luxfi/genesis/pkg/db"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/ethdb"
 	"github.com/spf13/cobra"
 )
 
 // NewDBCmd creates the `db` command and its subcommands.
 func NewDBCmd(app *application.Genesis) *cobra.Command {
-	var dbPath string
+	var dbPath, dbType string
 
 	cmd := &cobra.Command{
 		Use:   "db",
@@ -26,19 +30,20 @@ func NewDBCmd(app *application.Genesis) *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringVar(&dbPath, "db-path", "", "Path to the blockchain database")
+	cmd.PersistentFlags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
 
 	// Add subcommands
-	cmd.AddCommand(newDBScanCmd(app, &dbPath))
-	cmd.AddCommand(newDBInspectCmd(app, &dbPath))
-	cmd.AddCommand(newDBFindTipCmd(app, &dbPath))
-	cmd.AddCommand(newDBStatsCmd(app, &dbPath))
+	cmd.AddCommand(newDBScanCmd(app, &dbPath, &dbType))
+	cmd.AddCommand(newDBInspectCmd(app, &dbPath, &dbType))
+	cmd.AddCommand(newDBFindTipCmd(app, &dbPath, &dbType))
+	cmd.AddCommand(newDBStatsCmd(app, &dbPath, &dbType))
 	// Future: db repair, db compact, db verify
 
 	return cmd
 }
 
 // newDBScanCmd creates the `db scan` subcommand.
-func newDBScanCmd(app *application.Genesis, dbPath *string) *cobra.Command {
+func newDBScanCmd(app *application.Genesis, dbPath, dbType *string) *cobra.Command {
 	var (
 		prefix string
 		limit  int
@@ -50,7 +55,7 @@ func newDBScanCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 		Long:  `Iterates over the database, optionally filtering by a key prefix, and prints the keys and values.`, // Corrected: Removed unnecessary backticks around the string literal.
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			database, err := openDatabase(*dbPath) // Using the helper from extract.go for now
+			database, err := openInspectedDB(*dbPath, *dbType)
 			if err != nil {
 				return err
 			}
@@ -88,7 +93,7 @@ func newDBScanCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 }
 
 // newDBInspectCmd creates the `db inspect` subcommand.
-func newDBInspectCmd(app *application.Genesis, dbPath *string) *cobra.Command {
+func newDBInspectCmd(app *application.Genesis, dbPath, dbType *string) *cobra.Command {
 	var key string
 
 	cmd := &cobra.Command{
@@ -97,7 +102,7 @@ func newDBInspectCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 		Long:  `Decode and display the contents of specific database keys with proper formatting.`,
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			database, err := openDatabase(*dbPath)
+			database, err := openInspectedDB(*dbPath, *dbType)
 			if err != nil {
 				return err
 			}
@@ -119,6 +124,15 @@ func newDBInspectCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 
 			cmd.Printf("✅ Key inspection result:\n")
 			cmd.Printf("  Type: %s\n", result.Type)
+			if result.Namespace != nil {
+				cmd.Printf("  Namespace: 0x%x\n", result.Namespace)
+			}
+			if result.Number != nil {
+				cmd.Printf("  Block: %d\n", *result.Number)
+			}
+			if result.Hash != (common.Hash{}) {
+				cmd.Printf("  Hash: %s\n", result.Hash.Hex())
+			}
 			cmd.Printf("  Decoded: %s\n", result.Decoded)
 			if result.Details != "" {
 				cmd.Printf("  Details: %s\n", result.Details)
@@ -135,14 +149,17 @@ func newDBInspectCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 }
 
 // newDBFindTipCmd creates the `db find-tip` subcommand.
-func newDBFindTipCmd(app *application.Genesis, dbPath *string) *cobra.Command {
+func newDBFindTipCmd(app *application.Genesis, dbPath, dbType *string) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "find-tip",
 		Short: "Find the tip (latest block) in the database",
-		Long:  `Scans the database to find the highest block number and its associated data.`,
-		Args:  cobra.NoArgs,
+		Long: `Gathers every head signal in the database: the LastBlock, LastHeader and
+LastFast pointers, the highest canonical hash entry and the highest header
+key. Each is shown with its hash, parent and timestamp, and a warning is
+printed when they point at different blocks.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			database, err := openDatabase(*dbPath)
+			database, err := openInspectedDB(*dbPath, *dbType)
 			if err != nil {
 				return err
 			}
@@ -153,11 +170,28 @@ func newDBFindTipCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 			cmd.Printf("🔍 Finding tip block in database at %s...\n", *dbPath)
 
 			tip, err := inspector.FindTip()
+			if tip != nil {
+				cmd.Printf("\n  Head signals:\n")
+				for _, c := range tip.Candidates {
+					if c.Hash == (common.Hash{}) {
+						cmd.Printf("    %-18s %s\n", c.Source, c.Err)
+						continue
+					}
+					cmd.Printf("    %-18s #%d %s parent %s time %d", c.Source, c.Number, c.Hash.Hex(), c.ParentHash.Hex(), c.Timestamp)
+					if c.Err != "" {
+						cmd.Printf(" (%s)", c.Err)
+					}
+					cmd.Printf("\n")
+				}
+				if tip.Disagree() {
+					cmd.Printf("\n⚠️  Head signals disagree, the node may boot to a different height\n")
+				}
+			}
 			if err != nil {
 				return fmt.Errorf("find tip failed: %w", err)
 			}
 
-			cmd.Printf("✅ Found tip block:\n")
+			cmd.Printf("\n✅ Found tip block (from %s):\n", tip.Source)
 			cmd.Printf("  Height: %d\n", tip.Height)
 			cmd.Printf("  Hash: 0x%x\n", tip.Hash)
 			cmd.Printf("  Parent: 0x%x\n", tip.ParentHash)
@@ -171,14 +205,26 @@ func newDBFindTipCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 }
 
 // newDBStatsCmd creates the `db stats` subcommand.
-func newDBStatsCmd(app *application.Genesis, dbPath *string) *cobra.Command {
+func newDBStatsCmd(app *application.Genesis, dbPath, dbType *string) *cobra.Command {
+	var (
+		opts    db.StatsOptions
+		jsonOut bool
+	)
+
 	cmd := &cobra.Command{
 		Use:   "stats",
 		Short: "Display database statistics",
-		Long:  `Shows comprehensive statistics about the database including size, key count, and type distribution.`,
-		Args:  cobra.NoArgs,
+		Long: `Shows the key count and size of the database per rawdb table, per
+namespace and per block-height bucket, with the contracts using the most
+storage and the largest values. Contract sizes come from snapshot storage and
+path-scheme storage trie entries only: hash-scheme trie nodes are keyed by node
+hash alone and are reported as a total, so a hash-scheme database without a
+snapshot lists no contracts. On large databases --sample N reads one in N
+slices of every table and scales the figures up.`,
+		Example: `  genesis db stats --db-path /data/cchain/ethdb --sample 100 --json`,
+		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			database, err := openDatabase(*dbPath)
+			database, err := openInspectedDB(*dbPath, *dbType)
 			if err != nil {
 				return err
 			}
@@ -186,41 +232,34 @@ func newDBStatsCmd(app *application.Genesis, dbPath *string) *cobra.Command {
 
 			inspector := db.NewInspector(app, database)
 
-			cmd.Printf("📊 Gathering statistics for database at %s...\n", *dbPath)
+			if !jsonOut {
+				cmd.Printf("📊 Gathering statistics for database at %s...\n", *dbPath)
+			}
 
-			stats, err := inspector.GetStats()
+			stats, err := inspector.GetStats(opts)
 			if err != nil {
 				return fmt.Errorf("stats gathering failed: %w", err)
 			}
 
-			cmd.Printf("✅ Database Statistics:\n")
-			cmd.Printf("  Total Keys: %d\n", stats.TotalKeys)
-			cmd.Printf("  Total Size: %s\n", formatBytes(stats.TotalSize))
-			cmd.Printf("\n  Key Type Distribution:\n")
-			for keyType, count := range stats.KeyTypes {
-				cmd.Printf("    %s: %d\n", keyType, count)
+			if jsonOut {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(stats)
 			}
-			if stats.LatestBlock > 0 {
-				cmd.Printf("\n  Latest Block: %d\n", stats.LatestBlock)
-			}
-
+			stats.Print(cmd.OutOrStdout())
 			return nil
 		},
 	}
 
+	cmd.Flags().Uint64Var(&opts.BucketSize, "bucket-size", db.DefaultStatsBucketSize, "Blocks per height bucket")
+	cmd.Flags().IntVar(&opts.Top, "top", db.DefaultStatsTop, "Number of largest contracts and values to list")
+	cmd.Flags().IntVar(&opts.SampleRate, "sample", 0, "Read one in N slices of each table and estimate the totals (0 = full scan)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print the statistics as JSON")
+
 	return cmd
 }
 
-// formatBytes formats bytes into human-readable format
-func formatBytes(bytes uint64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := uint64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+// openInspectedDB opens a database read-only for inspection
+func openInspectedDB(path, dbType string) (ethdb.Database, error) {
+	return database.OpenEthDB(database.DatabaseType(dbType), path, database.BackendOptions{ReadOnly: true})
 }
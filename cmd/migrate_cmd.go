@@ -2,9 +2,13 @@
 package cmd
 
 import (
+	"encoding/hex"
 	"fmt"
+	"runtime"
+	"strings"
 
 	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
 	"github.com/luxfi/genesis/pkg/migration"
 	"github.com/spf13/cobra"
 )
@@ -32,28 +36,56 @@ func newMigrateRunCmd(app *application.Genesis) *cobra.Command {
 		sourcePath string
 		destPath   string
 		strategy   string
+		sourceType string
+		destType   string
+		cacheMB    int
+		handles    int
+		resume     bool
+		fromBlock  uint64
+		toBlock    uint64
 	)
 
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Runs a database migration from a source to a destination",
-		Args:  cobra.NoArgs,
+		Long: `Runs a database migration from a source to a destination.
+
+--from-block and --to-block select the block-range strategy, which copies only
+the canonical blocks in that range, plus genesis and the chain config, and the
+state reachable from the root at --to-block. The head pointers are set to
+--to-block, which defaults to the source head.`,
+		Example: `  genesis migrate run --source /data/cchain --dest /tmp/fixture --to-block 50000`,
+		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			blocks := database.BlockRange{From: fromBlock, To: toBlock}
+			if blocks.Enabled() && !cmd.Flags().Changed("strategy") {
+				strategy = "block-range"
+			}
+
 			// 1. Select the strategy
 			var strat migration.Strategy
 			switch strategy {
 			case "full-copy":
+				if blocks.Enabled() {
+					return fmt.Errorf("the full-copy strategy copies every block, use --strategy block-range with --from-block/--to-block")
+				}
 				strat = &migration.FullCopyStrategy{}
-			// In the future, we would add cases for "subnet-cchain", etc.
+			case "block-range":
+				strat = &migration.BlockRangeStrategy{Range: blocks, Workers: runtime.NumCPU()}
 			default:
-				return fmt.Errorf("unknown migration strategy '%s'. available: [full-copy]", strategy)
+				return fmt.Errorf("unknown migration strategy '%s'. available: [full-copy, block-range]", strategy)
 			}
 
 			// 2. Create the migrator
 			cfg := migration.Config{
-				SourceDBPath: sourcePath,
-				DestDBPath:   destPath,
-				Strategy:     strat,
+				SourceDBPath:  sourcePath,
+				DestDBPath:    destPath,
+				Strategy:      strat,
+				SourceType:    database.DatabaseType(sourceType),
+				DestType:      database.DatabaseType(destType),
+				SourceOptions: database.BackendOptions{CacheMB: cacheMB, Handles: handles},
+				DestOptions:   database.BackendOptions{CacheMB: cacheMB, Handles: handles},
+				Resume:        resume,
 			}
 			m, err := migration.NewMigrator(cfg)
 			if err != nil {
@@ -72,7 +104,14 @@ func newMigrateRunCmd(app *application.Genesis) *cobra.Command {
 
 	cmd.Flags().StringVar(&sourcePath, "source", "", "Path to the source database (required)")
 	cmd.Flags().StringVar(&destPath, "dest", "", "Path to the destination database (required)")
-	cmd.Flags().StringVar(&strategy, "strategy", "full-copy", "The migration strategy to use (e.g., full-copy)")
+	cmd.Flags().StringVar(&strategy, "strategy", "full-copy", "The migration strategy to use (full-copy, block-range)")
+	cmd.Flags().StringVar(&sourceType, "source-type", "", "Source database type (pebbledb, badgerdb, badgerdb-v3, leveldb; default: auto-detect)")
+	cmd.Flags().StringVar(&destType, "dest-type", "pebbledb", "Destination database type (pebbledb, badgerdb, badgerdb-v3, leveldb)")
+	cmd.Flags().IntVar(&cacheMB, "cache", 512, "Cache size in MB for each database")
+	cmd.Flags().IntVar(&handles, "handles", 1024, "Maximum open file handles for each database")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Continue from the checkpoint left by an interrupted migration")
+	cmd.Flags().Uint64Var(&fromBlock, "from-block", 0, "First canonical block to copy (selects the block-range strategy)")
+	cmd.Flags().Uint64Var(&toBlock, "to-block", 0, "Last canonical block to copy and the block whose state is copied (default: head)")
 	_ = cmd.MarkFlagRequired("source")
 	_ = cmd.MarkFlagRequired("dest")
 
@@ -81,17 +120,78 @@ func newMigrateRunCmd(app *application.Genesis) *cobra.Command {
 
 // newMigrateVerifyCmd creates the `migrate verify` subcommand.
 func newMigrateVerifyCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbA     string
+		dbB     string
+		typeA   string
+		typeB   string
+		prefixA string
+		prefixB string
+		samples int
+		cacheMB int
+	)
+
 	cmd := &cobra.Command{
 		Use:   "verify",
 		Short: "Verifies the integrity of a migration by comparing two databases",
+		Long: `Streams both databases in key order and reports every key that is missing
+from B, extra in B, or has a different value, grouped by rawdb key kind.
+
+Use --strip-prefix-a or --strip-prefix-b to compare a namespaced SubnetEVM
+database against a converted one. Only keys under the prefix are read from
+that side, and the prefix is removed before comparing.
+
+The command exits non-zero when the databases differ.`,
+		Example: `  genesis migrate verify --db-a /data/subnet-pebble --db-b /data/coreth-badger \
+    --strip-prefix-a 337fb73f9bcdac8c31a2d5f7b877ab1e8a2b7f2a1e9bf02a0a0e6c6fd164f1d1`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cmd.Println("Verification logic not yet implemented.")
+			config := migration.VerifyConfig{Samples: samples}
+			var err error
+			if config.PrefixA, err = hex.DecodeString(strings.TrimPrefix(prefixA, "0x")); err != nil {
+				return fmt.Errorf("invalid --strip-prefix-a: %w", err)
+			}
+			if config.PrefixB, err = hex.DecodeString(strings.TrimPrefix(prefixB, "0x")); err != nil {
+				return fmt.Errorf("invalid --strip-prefix-b: %w", err)
+			}
+
+			opts := database.BackendOptions{ReadOnly: true, CacheMB: cacheMB}
+			a, err := database.OpenKeyValueStore(database.DatabaseType(typeA), dbA, opts)
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+			b, err := database.OpenKeyValueStore(database.DatabaseType(typeB), dbB, opts)
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+
+			cmd.Printf("Comparing %s (A) against %s (B)...\n\n", dbA, dbB)
+			report, err := migration.Verify(a, b, config)
+			if err != nil {
+				return err
+			}
+			report.Print(cmd.OutOrStdout())
+
+			if n := report.Mismatches(); n > 0 {
+				return fmt.Errorf("databases differ: %d mismatched keys", n)
+			}
+			cmd.Println("\n✅ Databases match")
 			return nil
 		},
 	}
 
-	cmd.Flags().String("db-a", "", "Path to the first database")
-	cmd.Flags().String("db-b", "", "Path to the second database")
+	cmd.Flags().StringVar(&dbA, "db-a", "", "Path to the first (reference) database")
+	cmd.Flags().StringVar(&dbB, "db-b", "", "Path to the second database")
+	cmd.Flags().StringVar(&typeA, "type-a", "", "Type of the first database (default: auto-detect)")
+	cmd.Flags().StringVar(&typeB, "type-b", "", "Type of the second database (default: auto-detect)")
+	cmd.Flags().StringVar(&prefixA, "strip-prefix-a", "", "Hex prefix (e.g. namespace) to select and strip from keys in A")
+	cmd.Flags().StringVar(&prefixB, "strip-prefix-b", "", "Hex prefix (e.g. namespace) to select and strip from keys in B")
+	cmd.Flags().IntVar(&samples, "samples", 5, "Number of sample keys to show per kind of difference")
+	cmd.Flags().IntVar(&cacheMB, "cache", 512, "Cache size in MB for each database")
+	_ = cmd.MarkFlagRequired("db-a")
+	_ = cmd.MarkFlagRequired("db-b")
 
 	return cmd
 }
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/repair"
+	"github.com/spf13/cobra"
+)
+
+// NewRepairCmd creates the `repair` command for rebuilding chain indexes.
+func NewRepairCmd(app *application.Genesis) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Rebuild chain indexes from the block data in a database",
+		Long:  `The repair command rewrites derived chain indexes, such as canonical hash mappings, from the headers and blocks a database still holds.`,
+	}
+
+	cmd.AddCommand(newRepairCanonicalCmd(app))
+	cmd.AddCommand(newRepairTDCmd(app))
+	cmd.AddCommand(newRepairTxIndexCmd(app))
+	cmd.AddCommand(newRepairBloomBitsCmd(app))
+
+	return cmd
+}
+
+// newRepairCanonicalCmd creates the `repair canonical` subcommand.
+func newRepairCanonicalCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbType string
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "canonical [db-path]",
+		Short: "Rebuilds the canonical chain by following parent hashes from the best tip",
+		Long: `Finds the highest header whose parent hashes lead back to genesis and makes
+it the canonical chain. Every h+num+n and H+hash entry is rewritten to that
+chain, canonical entries above the tip are removed and the head pointers are
+moved to the tip. Every changed height is listed. Databases with blocks in
+<db-path>/ancient are refused, since frozen blocks cannot be rewritten.`,
+		Example: `  genesis repair canonical /data/cchain/ethdb --type badgerdb --dry-run`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.OpenEthDB(database.DatabaseType(dbType), args[0], database.BackendOptions{ReadOnly: dryRun})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			report, err := repair.RebuildCanonical(db, repair.CanonicalConfig{DryRun: dryRun})
+			if report != nil {
+				report.Print(cmd.OutOrStdout())
+			}
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				cmd.Println("Dry run, nothing was written")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report the changes without writing them")
+
+	return cmd
+}
+
+// newRepairTDCmd creates the `repair td` subcommand.
+func newRepairTDCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbType string
+		check  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "td [db-path]",
+		Short: "Recomputes the total difficulty of every canonical block",
+		Long: `Walks the canonical chain from genesis, adding up header difficulties, and
+writes the h+num+hash+t total difficulty entry of every block whose entry is
+missing or wrong. Coreth refuses to load blocks without a consistent total
+difficulty.
+
+With --check nothing is written, and the command fails if any entry is missing
+or wrong.`,
+		Example: `  genesis repair td /data/cchain/ethdb --type badgerdb --check`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.OpenKeyValueStore(database.DatabaseType(dbType), args[0], database.BackendOptions{ReadOnly: check})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			report, err := repair.RebuildTD(db, repair.TDConfig{Check: check})
+			report.Print(cmd.OutOrStdout())
+			if err != nil {
+				return err
+			}
+			if check && !report.Consistent() {
+				return fmt.Errorf("%d blocks have a missing or wrong total difficulty", report.Missing+report.Mismatched)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
+	cmd.Flags().BoolVar(&check, "check", false, "Only report missing and wrong entries")
+
+	return cmd
+}
+
+// newRepairTxIndexCmd creates the `repair txindex` subcommand.
+func newRepairTxIndexCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbType  string
+		from    uint64
+		to      uint64
+		workers int
+		verify  bool
+		samples int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "txindex [db-path]",
+		Short: "Rebuilds the transaction lookup index of the canonical blocks",
+		Long: `Decodes every canonical block body in the range and writes the l+txhash
+lookup entry of each transaction, which eth_getTransactionByHash and
+eth_getTransactionReceipt need. Migrated coreth databases often lack them.
+Bodies are decoded by a pool of workers.
+
+With --verify nothing is written. Transactions from random blocks in the range
+are checked until --samples have been seen, and the command fails if any lookup
+is missing or resolves to the wrong block.
+
+Bodies of blocks moved into <db-path>/ancient are read from the freezer.`,
+		Example: `  genesis repair txindex /data/cchain/ethdb --type badgerdb
+  genesis repair txindex /data/cchain/ethdb --from 1000000 --to 2000000
+  genesis repair txindex /data/cchain/ethdb --verify --samples 5000`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.OpenEthDB(database.DatabaseType(dbType), args[0], database.BackendOptions{ReadOnly: verify})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			config := repair.TxIndexConfig{
+				From:     from,
+				To:       to,
+				Workers:  workers,
+				Samples:  samples,
+				Progress: cmd.OutOrStdout(),
+			}
+			if verify {
+				report, err := repair.VerifyTxIndex(db, config)
+				if report != nil {
+					report.Print(cmd.OutOrStdout())
+				}
+				if err != nil {
+					return err
+				}
+				if len(report.Failures) > 0 {
+					return fmt.Errorf("%d of %d sampled transactions do not resolve to their block", len(report.Failures), report.Transactions)
+				}
+				return nil
+			}
+
+			report, err := repair.RebuildTxIndex(db, config)
+			if report != nil {
+				report.Print(cmd.OutOrStdout())
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
+	cmd.Flags().Uint64Var(&from, "from", 0, "First block to index")
+	cmd.Flags().Uint64Var(&to, "to", 0, "Last block to index (default: head block)")
+	cmd.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "Number of body decoding workers")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Only check a sample of lookups against their blocks")
+	cmd.Flags().IntVar(&samples, "samples", 1000, "Transactions to check with --verify")
+
+	return cmd
+}
+
+// newRepairBloomBitsCmd creates the `repair bloombits` subcommand.
+func newRepairBloomBitsCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbType      string
+		sectionSize uint64
+		confirms    uint64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "bloombits [db-path]",
+		Short: "Regenerates the bloom-bits log index from the canonical header blooms",
+		Long: `Rebuilds the B bloom-bits sections and their iB section heads from the
+header blooms of the canonical chain, in the format the node's chain indexer
+writes. Without them eth_getLogs scans every block of a historical range.
+
+Only complete sections at least --confirms blocks behind the head header are
+written. The section size must match the node's (4096 for coreth). Headers of
+blocks moved into <db-path>/ancient are read from the freezer.`,
+		Example: `  genesis repair bloombits /data/cchain/ethdb --type badgerdb`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.OpenEthDB(database.DatabaseType(dbType), args[0], database.BackendOptions{})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			report, err := repair.RebuildBloomBits(db, repair.BloomBitsConfig{
+				SectionSize: sectionSize,
+				Confirms:    confirms,
+				Progress:    cmd.OutOrStdout(),
+			})
+			if report != nil {
+				report.Print(cmd.OutOrStdout())
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (pebbledb, badgerdb, leveldb; default: auto-detect)")
+	cmd.Flags().Uint64Var(&sectionSize, "section-size", repair.DefaultBloomSectionSize, "Blocks per bloom-bits section")
+	cmd.Flags().Uint64Var(&confirms, "confirms", repair.DefaultBloomConfirms, "Blocks a section must be behind the head")
+
+	return cmd
+}
@@ -74,6 +74,9 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(NewLaunchBFTCmd(app))
 	rootCmd.AddCommand(NewLaunchBFTSimpleCmd(app))
 	rootCmd.AddCommand(NewMigrateCmd(app))
+	rootCmd.AddCommand(NewStateCmd(app))
+	rootCmd.AddCommand(NewRepairCmd(app))
+	rootCmd.AddCommand(NewServeRPCCmd(app))
 
 	return rootCmd
 }
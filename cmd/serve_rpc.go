@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/rpcserver"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/spf13/cobra"
+)
+
+// NewServeRPCCmd creates the `serve-rpc` command.
+func NewServeRPCCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbPath      string
+		dbType      string
+		namespace   string
+		addr        string
+		maxLogRange uint64
+		gasCap      uint64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve-rpc",
+		Short: "Serves a read-only Ethereum JSON-RPC API from a chain database",
+		Long: `Opens a chain database read-only and answers JSON-RPC requests from it
+directly, without booting a node:
+
+  eth_chainId, eth_blockNumber, eth_getBlockByNumber, eth_getBlockByHash,
+  eth_getTransactionByHash, eth_getTransactionReceipt, eth_getBalance,
+  eth_getCode, eth_getStorageAt, eth_getLogs, eth_call, eth_estimateGas
+  and net_version
+
+Balance, code and storage are read from the state trie of the requested
+block, so older blocks only answer when their state is still stored. Calls
+run the EVM on that state with the rules the stored chain config gives the
+block; coreth and Subnet-EVM network upgrades are mapped to the geth forks
+they correspond to, and their precompiles are not available.
+
+SubnetEVM sources are read under their namespace, which is detected when
+--namespace is not given.`,
+		Example: `  genesis serve-rpc --db /data/cchain/ethdb --addr 127.0.0.1:8545
+  genesis serve-rpc --db /data/subnet/pebbledb --type pebbledb`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.OpenEthDB(database.DatabaseType(dbType), dbPath, database.BackendOptions{ReadOnly: true})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var ns []byte
+			if namespace != "" {
+				if ns, err = hex.DecodeString(strings.TrimPrefix(namespace, "0x")); err != nil {
+					return fmt.Errorf("invalid namespace hex: %w", err)
+				}
+			} else if ns, err = database.DetectNamespace(db); err != nil && !errors.Is(err, database.ErrNoNamespace) {
+				return err
+			}
+			if len(ns) > 0 {
+				cmd.Printf("Reading database under namespace %x\n", ns)
+				db = rawdb.NewTable(db, string(ns))
+			}
+
+			chain := rpcserver.NewChain(db)
+			head, hash, err := chain.Head()
+			if err != nil {
+				return err
+			}
+			server, err := rpcserver.NewServer(chain, rpcserver.Config{MaxLogRange: maxLogRange, GasCap: gasCap})
+			if err != nil {
+				return err
+			}
+			defer server.Stop()
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			httpServer := &http.Server{Addr: addr, Handler: server, ReadHeaderTimeout: 10 * time.Second}
+			errCh := make(chan error, 1)
+			go func() { errCh <- httpServer.ListenAndServe() }()
+
+			cmd.Printf("Serving %s (head block #%d %s) on http://%s\n", dbPath, head, hash.Hex(), addr)
+			select {
+			case err := <-errCh:
+				return fmt.Errorf("RPC server failed: %w", err)
+			case <-ctx.Done():
+			}
+
+			cmd.Println("Shutting down RPC server...")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return httpServer.Shutdown(shutdownCtx)
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Path to the chain database (required)")
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (default: auto-detect)")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Hex namespace of the database keys (default: auto-detect)")
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:8545", "Address to listen on")
+	cmd.Flags().Uint64Var(&maxLogRange, "max-log-range", rpcserver.DefaultMaxLogRange, "Most blocks a single eth_getLogs call may scan")
+	cmd.Flags().Uint64Var(&gasCap, "gas-cap", rpcserver.DefaultGasCap, "Most gas a single eth_call or eth_estimateGas run may use")
+	_ = cmd.MarkFlagRequired("db")
+
+	return cmd
+}
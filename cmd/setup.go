@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
 	"github.com/luxfi/genesis/pkg/setup"
+	"github.com/luxfi/geth/ethdb"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +17,7 @@ func NewSetupCmd(app *application.Genesis) *cobra.Command {
 	}
 
 	cmd.AddCommand(newSetupChainStateCmd(app))
+	cmd.AddCommand(newSetupVMStateCmd(app))
 
 	return cmd
 }
@@ -25,8 +28,10 @@ func newSetupChainStateCmd(app *application.Genesis) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "chain-state [db-path]",
 		Short: "Setup C-Chain state with imported blockchain data",
-		Long:  "Properly configure chain head and state references for imported blockchain",
-		Args:  cobra.ExactArgs(1),
+		Long: `Points the C-Chain head at the canonical block at --target-height, or at the
+highest block, by writing the same ethdb keys as "setup vm-state" after the
+same checks. The VM metadata database is not touched.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			manager := setup.New(app)
 			return manager.SetupChainState(args[0], targetHeight)
@@ -37,3 +42,56 @@ func newSetupChainStateCmd(app *application.Genesis) *cobra.Command {
 
 	return cmd
 }
+
+// newSetupVMStateCmd creates the `setup vm-state` subcommand.
+func newSetupVMStateCmd(app *application.Genesis) *cobra.Command {
+	var (
+		dbType   string
+		vmPath   string
+		vmDBType string
+		height   uint64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "vm-state [ethdb-path]",
+		Short: "Point the C-Chain VM's last accepted block at a given height",
+		Long: `Writes every key luxd's C-Chain VM reads on startup for the canonical block
+at --height. In ethdb these are LastHeader, LastBlock, LastFast,
+AcceptorTipKey, snowman_lastAccepted and height. With --vm-db, lastAccepted,
+lastAcceptedHeight and initialized are also written to the VM metadata
+database. The block must have a canonical hash, header, hash-to-number entry
+and body, otherwise nothing is written. Every key and value written is printed.`,
+		Example: `  genesis setup vm-state /data/cchain/ethdb --height 1082780 --vm-db /data/cchain/vm`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.OpenKeyValueStore(database.DatabaseType(dbType), args[0], database.BackendOptions{})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var vmdb ethdb.KeyValueStore
+			if vmPath != "" {
+				vmdb, err = database.OpenKeyValueStore(database.DatabaseType(vmDBType), vmPath, database.BackendOptions{})
+				if err != nil {
+					return err
+				}
+				defer vmdb.Close()
+			}
+
+			report, err := setup.WriteVMState(db, vmdb, height)
+			if report != nil {
+				report.Print(cmd.OutOrStdout())
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type of ethdb (pebbledb, badgerdb, leveldb; default: auto-detect)")
+	cmd.Flags().StringVar(&vmPath, "vm-db", "", "Path to the VM metadata database (default: ethdb only)")
+	cmd.Flags().StringVar(&vmDBType, "vm-type", "", "Database type of the VM metadata database (default: auto-detect)")
+	cmd.Flags().Uint64Var(&height, "height", 0, "Height of the block to mark as last accepted")
+	cmd.MarkFlagRequired("height")
+
+	return cmd
+}
@@ -0,0 +1,371 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/spf13/cobra"
+)
+
+// NewStateCmd creates the `state` command for working with state tries.
+func NewStateCmd(app *application.Genesis) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Copy, dump and inspect state tries",
+		Long:  `The state command walks the account and storage tries of a state root stored in the hash-based scheme.`,
+	}
+
+	cmd.AddCommand(newStateCopyCmd(app))
+	cmd.AddCommand(newStateDumpCmd(app))
+	cmd.AddCommand(newStatePreimagesCmd(app))
+
+	return cmd
+}
+
+// newStateCopyCmd creates the `state copy` subcommand.
+func newStateCopyCmd(app *application.Genesis) *cobra.Command {
+	var (
+		root      string
+		fromPath  string
+		toPath    string
+		fromType  string
+		toType    string
+		namespace string
+		workers   int
+		verify    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "copy",
+		Short: "Copies the state trie of a root, its storage tries and contract code between databases",
+		Long: `Walks the account trie at --root and every storage trie under it, writing
+each trie node and all contract code into the destination database. Every
+node is checked against its hash as it is copied, and the root is checked in
+the destination at the end.
+
+SubnetEVM sources are read under their namespace, which is detected when
+--namespace is not given.`,
+		Example: `  genesis state copy --root 0xaedd8be7a060b082b0cb3195d0b5ba017c058468851ed93dd07eca274de000c2 \
+    --from /data/subnet/pebbledb --to /data/cchain/ethdb --to-type badgerdb`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stateRoot := common.HexToHash(root)
+
+			src, err := database.OpenKeyValueStore(database.DatabaseType(fromType), fromPath, database.BackendOptions{ReadOnly: true})
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+
+			var ns []byte
+			if namespace != "" {
+				if ns, err = hex.DecodeString(strings.TrimPrefix(namespace, "0x")); err != nil {
+					return fmt.Errorf("invalid namespace hex: %w", err)
+				}
+			} else if ns, err = database.DetectNamespace(src); err != nil && !errors.Is(err, database.ErrNoNamespace) {
+				return err
+			}
+			if len(ns) > 0 {
+				cmd.Printf("Reading source under namespace %x\n", ns)
+			}
+
+			dst, err := database.OpenKeyValueStore(database.DatabaseType(toType), toPath, database.BackendOptions{})
+			if err != nil {
+				return err
+			}
+			defer dst.Close()
+
+			cmd.Printf("Copying state %s with %d workers...\n", stateRoot.Hex(), workers)
+			start := time.Now()
+			stats, err := state.Copy(cmd.Context(), src, dst, state.CopyConfig{
+				Root:      stateRoot,
+				Namespace: ns,
+				Workers:   workers,
+				Verify:    verify,
+				Progress:  cmd.OutOrStdout(),
+			})
+			if err != nil {
+				return fmt.Errorf("state copy failed after %s: %w", stats, err)
+			}
+
+			cmd.Printf("\n✅ Copied state %s in %v\n", stateRoot.Hex(), time.Since(start).Round(time.Second))
+			cmd.Printf("   Accounts:      %d\n", stats.Accounts)
+			cmd.Printf("   Storage tries: %d (%d slots)\n", stats.StorageTries, stats.StorageSlots)
+			cmd.Printf("   Trie nodes:    %d\n", stats.Nodes)
+			cmd.Printf("   Contract code: %d\n", stats.Code)
+			cmd.Printf("   Bytes:         %d\n", stats.Bytes)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "State root to copy (required)")
+	cmd.Flags().StringVar(&fromPath, "from", "", "Path to the source database (required)")
+	cmd.Flags().StringVar(&toPath, "to", "", "Path to the destination database (required)")
+	cmd.Flags().StringVar(&fromType, "from-type", "", "Source database type (default: auto-detect)")
+	cmd.Flags().StringVar(&toType, "to-type", string(database.PebbleDB), "Destination database type (pebbledb, badgerdb, badgerdb-v3, leveldb)")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Hex namespace of the source keys (default: auto-detect)")
+	cmd.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "Number of concurrent trie walkers")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Re-walk the full destination state after copying")
+	_ = cmd.MarkFlagRequired("root")
+	_ = cmd.MarkFlagRequired("from")
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// newStateDumpCmd creates the `state dump` subcommand.
+func newStateDumpCmd(app *application.Genesis) *cobra.Command {
+	var (
+		root      string
+		height    uint64
+		dbPath    string
+		dbType    string
+		namespace string
+		start     string
+		outPath   string
+		storage   bool
+		workers   int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Streams every account of a state trie as JSON lines",
+		Long: `Walks the account trie at --root, or at the state root of canonical block
+--height, and writes one JSON object per account in account hash order:
+
+  {"addressHash":"0x..","address":"0x..","nonce":1,"balance":"1000",
+   "codeHash":"0x..","storageRoot":"0x.."}
+
+The address is included when the database holds its preimage. --storage adds
+every storage slot as {"hash","key","value"}, reading storage tries with a
+pool of workers.
+
+An interrupted or failed dump prints the account hash to pass as --start to
+continue where it stopped; appending the continued output to the partial file
+gives the full dump.
+
+SubnetEVM sources are read under their namespace, which is detected when
+--namespace is not given.`,
+		Example: `  genesis state dump --db /data/cchain/ethdb --height 1082780 --out accounts.jsonl
+  genesis state dump --db /data/subnet/pebbledb --root 0xaedd...00c2 --storage --start 0x7f3a...`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (root == "") == !cmd.Flags().Changed("height") {
+				return errors.New("exactly one of --root or --height is required")
+			}
+
+			db, err := database.OpenKeyValueStore(database.DatabaseType(dbType), dbPath, database.BackendOptions{ReadOnly: true})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var ns []byte
+			if namespace != "" {
+				if ns, err = hex.DecodeString(strings.TrimPrefix(namespace, "0x")); err != nil {
+					return fmt.Errorf("invalid namespace hex: %w", err)
+				}
+			} else if ns, err = database.DetectNamespace(db); err != nil && !errors.Is(err, database.ErrNoNamespace) {
+				return err
+			}
+			if len(ns) > 0 {
+				cmd.PrintErrf("Reading database under namespace %x\n", ns)
+			}
+
+			stateRoot := common.HexToHash(root)
+			if root == "" {
+				hash, blockRoot, err := database.CanonicalStateRoot(state.NewPrefixReader(db, ns), height)
+				if err != nil {
+					return err
+				}
+				cmd.PrintErrf("Block #%d %s has state root %s\n", height, hash.Hex(), blockRoot.Hex())
+				stateRoot = blockRoot
+			}
+
+			var out io.Writer = cmd.OutOrStdout()
+			if outPath != "" {
+				flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+				if start != "" {
+					flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+				}
+				file, err := os.OpenFile(outPath, flags, 0o644)
+				if err != nil {
+					return fmt.Errorf("failed to open output: %w", err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			started := time.Now()
+			stats, err := state.Dump(ctx, db, state.DumpConfig{
+				Root:      stateRoot,
+				Namespace: ns,
+				Start:     common.HexToHash(start),
+				Storage:   storage,
+				Workers:   workers,
+				Progress:  cmd.ErrOrStderr(),
+			}, out)
+			if err != nil {
+				return fmt.Errorf("state dump stopped after %d accounts, resume with --start %s: %w", stats.Accounts, stats.Next.Hex(), err)
+			}
+
+			cmd.PrintErrf("✅ Dumped state %s in %v\n", stateRoot.Hex(), time.Since(started).Round(time.Second))
+			cmd.PrintErrf("   Accounts:      %d (%d with address)\n", stats.Accounts, stats.Addresses)
+			if storage {
+				cmd.PrintErrf("   Storage slots: %d\n", stats.StorageSlots)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "State root to dump")
+	cmd.Flags().Uint64Var(&height, "height", 0, "Dump the state of the canonical block at this height")
+	cmd.Flags().StringVar(&dbPath, "db", "", "Path to the database (required)")
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (default: auto-detect)")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Hex namespace of the database keys (default: auto-detect)")
+	cmd.Flags().StringVar(&start, "start", "", "Account hash to start from, to resume an interrupted dump")
+	cmd.Flags().StringVar(&outPath, "out", "", "File to write to, appended to with --start (default: stdout)")
+	cmd.Flags().BoolVar(&storage, "storage", false, "Include every storage slot")
+	cmd.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "Number of concurrent storage trie readers")
+	_ = cmd.MarkFlagRequired("db")
+
+	return cmd
+}
+
+// newStatePreimagesCmd creates the `state preimages` subcommand.
+func newStatePreimagesCmd(app *application.Genesis) *cobra.Command {
+	var (
+		root        string
+		height      uint64
+		to          uint64
+		dbPath      string
+		dbType      string
+		namespace   string
+		genesisPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "preimages",
+		Short: "Recovers account addresses from the chain and writes them as trie preimages",
+		Long: `The state trie keys accounts by keccak256(address), and migrated databases
+rarely keep the preimages that map those hashes back to addresses. This scans
+every canonical block up to --to (default: the head) and collects candidate
+addresses from:
+
+  - the genesis alloc stored with the chain, and --genesis if given
+  - transaction senders, recovered from their signatures
+  - transaction recipients and the contracts they created
+  - log emitters, and addresses passed in log topics and data
+
+Every candidate that is an account of the state at --root, or at the state
+root of canonical block --height, gets a "secure-key-" preimage entry, after
+which state dump shows its address. The database is opened for writing.
+
+SubnetEVM databases are read and written under their namespace, which is
+detected when --namespace is not given.`,
+		Example: `  genesis state preimages --db /data/cchain/ethdb --height 1082780
+  genesis state preimages --db /data/subnet/pebbledb --root 0xaedd...00c2 --genesis genesis.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (root == "") == !cmd.Flags().Changed("height") {
+				return errors.New("exactly one of --root or --height is required")
+			}
+
+			var addresses []common.Address
+			if genesisPath != "" {
+				data, err := os.ReadFile(genesisPath)
+				if err != nil {
+					return fmt.Errorf("failed to read genesis: %w", err)
+				}
+				if addresses, err = database.GenesisAllocAddresses(data); err != nil {
+					return err
+				}
+			}
+
+			db, err := database.OpenEthDB(database.DatabaseType(dbType), dbPath, database.BackendOptions{})
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var ns []byte
+			if namespace != "" {
+				if ns, err = hex.DecodeString(strings.TrimPrefix(namespace, "0x")); err != nil {
+					return fmt.Errorf("invalid namespace hex: %w", err)
+				}
+			} else if ns, err = database.DetectNamespace(db); err != nil && !errors.Is(err, database.ErrNoNamespace) {
+				return err
+			}
+			if len(ns) > 0 {
+				cmd.Printf("Using database under namespace %x\n", ns)
+				db = rawdb.NewTable(db, string(ns))
+			}
+
+			stateRoot := common.HexToHash(root)
+			if root == "" {
+				hash, blockRoot, err := database.CanonicalStateRoot(db, height)
+				if err != nil {
+					return err
+				}
+				cmd.Printf("Block #%d %s has state root %s\n", height, hash.Hex(), blockRoot.Hex())
+				stateRoot = blockRoot
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			cmd.Printf("Recovering preimages for state %s...\n", stateRoot.Hex())
+			started := time.Now()
+			stats, err := database.BuildPreimages(ctx, db, database.PreimageConfig{
+				Root:      stateRoot,
+				To:        to,
+				Addresses: addresses,
+				Progress:  cmd.OutOrStdout(),
+			})
+			if err != nil {
+				if stats != nil {
+					return fmt.Errorf("preimage recovery failed after %d blocks, %d preimages written: %w", stats.Blocks, stats.Recovered, err)
+				}
+				return fmt.Errorf("preimage recovery failed: %w", err)
+			}
+
+			cmd.Printf("\n✅ Recovered preimages in %v\n", time.Since(started).Round(time.Second))
+			cmd.Printf("   Scanned:    %d blocks, %d transactions, %d logs\n", stats.Blocks, stats.Transactions, stats.Logs)
+			if stats.Missing > 0 {
+				cmd.Printf("   Missing:    %d heights without a canonical block\n", stats.Missing)
+			}
+			cmd.Printf("   Accounts:   %d\n", stats.Accounts)
+			cmd.Printf("   Known:      %d\n", stats.Known)
+			cmd.Printf("   Recovered:  %d\n", stats.Recovered)
+			cmd.Printf("   Resolved:   %.2f%%\n", stats.Resolved())
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "State root whose accounts are resolved")
+	cmd.Flags().Uint64Var(&height, "height", 0, "Resolve the accounts of the state of the canonical block at this height")
+	cmd.Flags().Uint64Var(&to, "to", 0, "Last block to scan (default: head block)")
+	cmd.Flags().StringVar(&dbPath, "db", "", "Path to the database (required)")
+	cmd.Flags().StringVar(&dbType, "type", "", "Database type (default: auto-detect)")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Hex namespace of the database keys (default: auto-detect)")
+	cmd.Flags().StringVar(&genesisPath, "genesis", "", "Genesis file whose alloc addresses are candidates too")
+	_ = cmd.MarkFlagRequired("db")
+
+	return cmd
+}
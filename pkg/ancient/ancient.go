@@ -4,11 +4,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"path/filepath"
 
+	"github.com/luxfi/genesis/pkg/database"
 	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
 	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	"github.com/luxfi/geth/rlp"
+)
+
+const (
+	manifestName  = "ancient-manifest.json"
+	compactedName = "ancient-compact"
+
+	// importChunk is the number of blocks appended to the freezer at a time
+	importChunk = 10000
 )
 
 // AncientStore represents the interface for ancient data storage
@@ -42,16 +55,37 @@ type CChainAncientData struct {
 // Builder builds ancient store data for C-Chain genesis
 type Builder struct {
 	config      *CChainAncientData
-	ancientDb   ethdb.AncientStore
+	ancientDb   ethdb.Database
 	compactedDb ethdb.Database
+	checksums   *checksummer
 }
 
-// NewBuilder creates a new ancient store builder
+// NewBuilder opens the freezer at config.DataPath read-only and the compacted
+// store at config.CompactedDir. DataPath may point at a chaindata/ancient
+// directory or straight at its chain subdirectory.
 func NewBuilder(config *CChainAncientData) (*Builder, error) {
-	// TODO: Implement database opening with proper imports
-	// For now, return a placeholder builder
+	if config.DataPath == "" || config.CompactedDir == "" {
+		return nil, fmt.Errorf("both the ancient data path and the compacted directory are required")
+	}
+	if _, err := os.Stat(config.DataPath); err != nil {
+		return nil, fmt.Errorf("ancient data not found: %w", err)
+	}
+
+	ancientDb, err := rawdb.Open(memorydb.New(), rawdb.OpenOptions{Ancient: config.DataPath, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open freezer: %w", err)
+	}
+
+	compactedDb, err := database.OpenEthDB(database.PebbleDB, config.CompactedDir, database.BackendOptions{})
+	if err != nil {
+		ancientDb.Close()
+		return nil, fmt.Errorf("failed to open compacted store: %w", err)
+	}
+
 	return &Builder{
-		config: config,
+		config:      config,
+		ancientDb:   ancientDb,
+		compactedDb: compactedDb,
 	}, nil
 }
 
@@ -59,65 +93,135 @@ func NewBuilder(config *CChainAncientData) (*Builder, error) {
 func (b *Builder) Close() error {
 	if b.ancientDb != nil {
 		b.ancientDb.Close()
+		b.ancientDb = nil
 	}
 	if b.compactedDb != nil {
 		b.compactedDb.Close()
+		b.compactedDb = nil
 	}
 	return nil
 }
 
-// CompactAncientData compacts ancient data for efficient storage
+// CompactAncientData copies the canonical headers, bodies, receipts and hashes
+// of [StartBlock, EndBlock] from the freezer into the compacted store, together
+// with the total difficulty of each block. An EndBlock of 0 or past the frozen
+// head is clamped to the last frozen block.
 func (b *Builder) CompactAncientData() error {
-	fmt.Printf("Compacting ancient data from block %d to %d...\n",
-		b.config.StartBlock, b.config.EndBlock)
-
-	// Get total ancients count
 	ancients, err := b.ancientDb.Ancients()
 	if err != nil {
 		return fmt.Errorf("failed to get ancients count: %w", err)
 	}
+	if ancients == 0 {
+		return fmt.Errorf("freezer at %s is empty", b.config.DataPath)
+	}
+	if b.config.EndBlock == 0 || b.config.EndBlock >= ancients {
+		b.config.EndBlock = ancients - 1
+	}
+	if b.config.StartBlock > b.config.EndBlock {
+		return fmt.Errorf("start block %d is past end block %d", b.config.StartBlock, b.config.EndBlock)
+	}
 
-	if b.config.EndBlock > ancients {
-		b.config.EndBlock = ancients
+	if b.config.GenesisHash == (common.Hash{}) {
+		genesis, err := b.ancientDb.Ancient(rawdb.ChainFreezerHashTable, 0)
+		if err != nil {
+			return fmt.Errorf("failed to read genesis hash: %w", err)
+		}
+		b.config.GenesisHash = common.BytesToHash(genesis)
 	}
 
-	// TODO: Implement actual ancient data processing
-	// For now, just print progress
-	for blockNum := b.config.StartBlock; blockNum <= b.config.EndBlock; blockNum++ {
-		if blockNum%1000 == 0 {
-			fmt.Printf("Processing block %d/%d...\n", blockNum, b.config.EndBlock)
+	fmt.Printf("Compacting ancient data from block %d to %d...\n",
+		b.config.StartBlock, b.config.EndBlock)
+
+	// Freezers written by recent geth versions no longer keep total
+	// difficulties, so they are summed up from the headers instead
+	td := new(big.Int)
+	for number := uint64(0); number < b.config.StartBlock; number++ {
+		header, err := b.ancientDb.Ancient(rawdb.ChainFreezerHeaderTable, number)
+		if err != nil {
+			return fmt.Errorf("failed to read header %d: %w", number, err)
 		}
+		difficulty, err := headerDifficulty(header)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", number, err)
+		}
+		td.Add(td, difficulty)
 	}
 
+	sums := newChecksummer()
+	batch := b.compactedDb.NewBatch()
+	for number := b.config.StartBlock; number <= b.config.EndBlock; number++ {
+		block, err := readFrozenBlock(b.ancientDb, number)
+		if err != nil {
+			return err
+		}
+		difficulty, err := headerDifficulty(block.header)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", number, err)
+		}
+		td.Add(td, difficulty)
+		if block.td, err = rlp.EncodeToBytes(td); err != nil {
+			return fmt.Errorf("failed to encode total difficulty of block %d: %w", number, err)
+		}
+
+		if err := block.write(batch, number); err != nil {
+			return fmt.Errorf("failed to write block %d: %w", number, err)
+		}
+		sums.add(block)
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return fmt.Errorf("failed to write batch: %w", err)
+			}
+			batch.Reset()
+		}
+		if number%10000 == 0 {
+			fmt.Printf("Processing block %d/%d...\n", number, b.config.EndBlock)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write batch: %w", err)
+	}
+	b.checksums = sums
+
 	fmt.Println("Compaction completed successfully")
 	return nil
 }
 
-// ExportToGenesis exports compacted data for genesis import
+// ExportToGenesis closes the compacted store and copies it next to a manifest
+// holding the checksum of every table
 func (b *Builder) ExportToGenesis(outputPath string) error {
+	if b.checksums == nil {
+		return fmt.Errorf("no compacted data, run CompactAncientData first")
+	}
 	fmt.Println("Exporting compacted data for genesis...")
 
+	if b.compactedDb != nil {
+		if err := b.compactedDb.Close(); err != nil {
+			return fmt.Errorf("failed to close compacted store: %w", err)
+		}
+		b.compactedDb = nil
+	}
+
 	// Create output directory
 	if err := os.MkdirAll(outputPath, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
 	// Create manifest file
-	manifestPath := filepath.Join(outputPath, "ancient-manifest.json")
-	manifest := map[string]interface{}{
-		"chainId":     b.config.ChainID,
-		"genesisHash": b.config.GenesisHash.Hex(),
-		"startBlock":  b.config.StartBlock,
-		"endBlock":    b.config.EndBlock,
-		"version":     "1.0.0",
+	manifest := Manifest{
+		ChainID:     b.config.ChainID,
+		GenesisHash: b.config.GenesisHash,
+		StartBlock:  b.config.StartBlock,
+		EndBlock:    b.config.EndBlock,
+		Version:     ManifestVersion,
+		Tables:      b.checksums.tables(),
 	}
-
-	if err := writeJSON(manifestPath, manifest); err != nil {
+	if err := writeJSON(filepath.Join(outputPath, manifestName), manifest); err != nil {
 		return fmt.Errorf("failed to write manifest: %w", err)
 	}
 
 	// Copy compacted database
-	compactedPath := filepath.Join(outputPath, "ancient-compact")
+	compactedPath := filepath.Join(outputPath, compactedName)
 	if err := copyDir(b.config.CompactedDir, compactedPath); err != nil {
 		return fmt.Errorf("failed to copy compacted data: %w", err)
 	}
@@ -126,19 +230,90 @@ func (b *Builder) ExportToGenesis(outputPath string) error {
 	return nil
 }
 
-// ImportFromGenesis imports ancient data into C-Chain
-func ImportFromGenesis(genesisPath string, targetDataDir string) error {
+// ImportFromGenesis verifies the exported data in genesisPath against its
+// manifest and appends it to the freezer of the database at targetDataDir.
+// Nothing is written unless every table checksum matches, and the target
+// freezer must end right before the manifest's start block. An empty
+// targetType is detected from the files in targetDataDir.
+func ImportFromGenesis(genesisPath string, targetDataDir string, targetType database.DatabaseType) error {
 	fmt.Printf("Importing ancient data from %s to %s...\n", genesisPath, targetDataDir)
 
 	// Read manifest
-	manifestPath := filepath.Join(genesisPath, "ancient-manifest.json")
-	var manifest map[string]interface{}
-	if err := readJSON(manifestPath, &manifest); err != nil {
+	var manifest Manifest
+	if err := readJSON(filepath.Join(genesisPath, manifestName), &manifest); err != nil {
 		return fmt.Errorf("failed to read manifest: %w", err)
 	}
+	if len(manifest.Tables) == 0 {
+		return fmt.Errorf("manifest version %q has no table checksums", manifest.Version)
+	}
+
+	src, err := database.OpenEthDB(database.PebbleDB, filepath.Join(genesisPath, compactedName), database.BackendOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open compacted data: %w", err)
+	}
+	defer src.Close()
+
+	fmt.Println("Verifying table checksums...")
+	sums := newChecksummer()
+	for number := manifest.StartBlock; number <= manifest.EndBlock; number++ {
+		block, err := readCompactedBlock(src, number)
+		if err != nil {
+			return err
+		}
+		sums.add(block)
+	}
+	if err := sums.verify(manifest.Tables); err != nil {
+		return err
+	}
+
+	kv, err := database.OpenKeyValueStore(targetType, targetDataDir, database.BackendOptions{})
+	if err != nil {
+		return err
+	}
+	db, err := rawdb.Open(kv, rawdb.OpenOptions{Ancient: filepath.Join(targetDataDir, "ancient")})
+	if err != nil {
+		kv.Close()
+		return fmt.Errorf("failed to open target freezer: %w", err)
+	}
+	defer db.Close()
+
+	frozen, err := db.Ancients()
+	if err != nil {
+		return fmt.Errorf("failed to get target ancients count: %w", err)
+	}
+	if frozen != manifest.StartBlock {
+		return fmt.Errorf("target freezer holds %d blocks, but the export starts at block %d", frozen, manifest.StartBlock)
+	}
 
-	// TODO: Implement the actual import logic
-	// This would involve reading from compacted format and writing to ancient store
+	for start := manifest.StartBlock; start <= manifest.EndBlock; start += importChunk {
+		end := min(start+importChunk-1, manifest.EndBlock)
+		batch := db.NewBatch()
+		_, err := db.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+			for number := start; number <= end; number++ {
+				block, err := readCompactedBlock(src, number)
+				if err != nil {
+					return err
+				}
+				if err := block.append(op, number); err != nil {
+					return fmt.Errorf("failed to append block %d: %w", number, err)
+				}
+				if err := batch.Put(tdKey(number, common.BytesToHash(block.hash)), block.td); err != nil {
+					return fmt.Errorf("failed to write total difficulty of block %d: %w", number, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := batch.Write(); err != nil {
+			return fmt.Errorf("failed to write total difficulties: %w", err)
+		}
+		fmt.Printf("Imported blocks %d-%d\n", start, end)
+	}
+	if err := db.SyncAncient(); err != nil {
+		return fmt.Errorf("failed to sync freezer: %w", err)
+	}
 
 	fmt.Println("Import completed successfully")
 	return nil
@@ -0,0 +1,231 @@
+package ancient
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+)
+
+// ManifestVersion is the manifest format written by ExportToGenesis
+const ManifestVersion = "2.0.0"
+
+// Table names used in the manifest. All but the difficulties match the geth
+// freezer tables; difficulties uses the name coreth gives its freezer table.
+const (
+	TableHeaders      = rawdb.ChainFreezerHeaderTable
+	TableHashes       = rawdb.ChainFreezerHashTable
+	TableBodies       = rawdb.ChainFreezerBodiesTable
+	TableReceipts     = rawdb.ChainFreezerReceiptTable
+	TableDifficulties = "diffs"
+)
+
+var tableNames = []string{TableHeaders, TableHashes, TableBodies, TableReceipts, TableDifficulties}
+
+// Manifest describes an exported block range and the checksum of each table
+type Manifest struct {
+	ChainID     uint64                   `json:"chainId"`
+	GenesisHash common.Hash              `json:"genesisHash"`
+	StartBlock  uint64                   `json:"startBlock"`
+	EndBlock    uint64                   `json:"endBlock"`
+	Version     string                   `json:"version"`
+	Tables      map[string]TableChecksum `json:"tables"`
+}
+
+// TableChecksum is the SHA-256 over every item of a table in block order
+type TableChecksum struct {
+	Items  uint64 `json:"items"`
+	Bytes  uint64 `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// frozenBlock holds the raw items of one block
+type frozenBlock struct {
+	hash     []byte
+	header   []byte
+	body     []byte
+	receipts []byte
+	td       []byte
+}
+
+func (b *frozenBlock) item(table string) []byte {
+	switch table {
+	case TableHeaders:
+		return b.header
+	case TableHashes:
+		return b.hash
+	case TableBodies:
+		return b.body
+	case TableReceipts:
+		return b.receipts
+	default:
+		return b.td
+	}
+}
+
+// readFrozenBlock reads block number from a freezer. The total difficulty is
+// left empty since geth freezers do not keep it.
+func readFrozenBlock(db ethdb.AncientReader, number uint64) (*frozenBlock, error) {
+	block := new(frozenBlock)
+	for _, item := range []struct {
+		table string
+		dst   *[]byte
+	}{
+		{TableHashes, &block.hash},
+		{TableHeaders, &block.header},
+		{TableBodies, &block.body},
+		{TableReceipts, &block.receipts},
+	} {
+		data, err := db.Ancient(item.table, number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s of block %d: %w", item.table, number, err)
+		}
+		*item.dst = data
+	}
+	if crypto.Keccak256Hash(block.header) != common.BytesToHash(block.hash) {
+		return nil, fmt.Errorf("header of block %d does not match its canonical hash", number)
+	}
+	return block, nil
+}
+
+// readCompactedBlock reads block number back from a compacted store
+func readCompactedBlock(db ethdb.Reader, number uint64) (*frozenBlock, error) {
+	hash := rawdb.ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("canonical hash of block %d missing from compacted data", number)
+	}
+	block := &frozenBlock{
+		hash:     hash.Bytes(),
+		header:   rawdb.ReadHeaderRLP(db, hash, number),
+		body:     rawdb.ReadBodyRLP(db, hash, number),
+		receipts: rawdb.ReadReceiptsRLP(db, hash, number),
+	}
+	block.td, _ = db.Get(tdKey(number, hash))
+	if len(block.header) == 0 || len(block.body) == 0 || block.receipts == nil || len(block.td) == 0 {
+		return nil, fmt.Errorf("block %d is incomplete in compacted data", number)
+	}
+	return block, nil
+}
+
+// write stores the block under the regular rawdb keys
+func (b *frozenBlock) write(db ethdb.KeyValueWriter, number uint64) error {
+	hash := common.BytesToHash(b.hash)
+	rawdb.WriteCanonicalHash(db, hash, number)
+	rawdb.WriteHeaderNumber(db, hash, number)
+	if err := db.Put(headerKey(number, hash), b.header); err != nil {
+		return err
+	}
+	rawdb.WriteBodyRLP(db, hash, number, b.body)
+	rawdb.WriteRawReceipts(db, hash, number, b.receipts)
+	return db.Put(tdKey(number, hash), b.td)
+}
+
+// append adds the block to the geth freezer tables
+func (b *frozenBlock) append(op ethdb.AncientWriteOp, number uint64) error {
+	for _, table := range tableNames[:4] {
+		if err := op.AppendRaw(table, number, b.item(table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// headerDifficulty decodes the difficulty of a header in any known layout
+func headerDifficulty(data []byte) (*big.Int, error) {
+	var header migration.SubnetEVMHeader
+	if err := rlp.DecodeBytes(data, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	if header.Difficulty == nil {
+		return new(big.Int), nil
+	}
+	return header.Difficulty, nil
+}
+
+// checksummer accumulates a TableChecksum for every table
+type checksummer struct {
+	hashers map[string]hash.Hash
+	sums    map[string]*TableChecksum
+}
+
+func newChecksummer() *checksummer {
+	c := &checksummer{
+		hashers: make(map[string]hash.Hash, len(tableNames)),
+		sums:    make(map[string]*TableChecksum, len(tableNames)),
+	}
+	for _, table := range tableNames {
+		c.hashers[table] = sha256.New()
+		c.sums[table] = new(TableChecksum)
+	}
+	return c
+}
+
+func (c *checksummer) add(block *frozenBlock) {
+	for _, table := range tableNames {
+		item := block.item(table)
+		// Length-prefix each item so moving bytes between items changes the sum
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(item)))
+		c.hashers[table].Write(size[:])
+		c.hashers[table].Write(item)
+		c.sums[table].Items++
+		c.sums[table].Bytes += uint64(len(item))
+	}
+}
+
+func (c *checksummer) tables() map[string]TableChecksum {
+	tables := make(map[string]TableChecksum, len(tableNames))
+	for _, table := range tableNames {
+		sum := *c.sums[table]
+		sum.SHA256 = hex.EncodeToString(c.hashers[table].Sum(nil))
+		tables[table] = sum
+	}
+	return tables
+}
+
+// verify compares the accumulated checksums against a manifest
+func (c *checksummer) verify(expected map[string]TableChecksum) error {
+	var mismatched []string
+	for table, sum := range c.tables() {
+		want, ok := expected[table]
+		if !ok {
+			mismatched = append(mismatched, table+" (missing from manifest)")
+			continue
+		}
+		if want != sum {
+			mismatched = append(mismatched, table)
+		}
+	}
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return fmt.Errorf("checksum mismatch in tables: %s", strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+func encodeBlockNumber(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
+
+// headerKey = 'h' + num (uint64 big endian) + hash
+func headerKey(number uint64, hash common.Hash) []byte {
+	return append(append([]byte("h"), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// tdKey = headerKey + 't', the legacy total difficulty key
+func tdKey(number uint64, hash common.Hash) []byte {
+	return append(headerKey(number, hash), 't')
+}
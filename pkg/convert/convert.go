@@ -20,7 +20,8 @@ func New(app *application.Genesis) *Converter {
 	return &Converter{app: app}
 }
 
-// DenamespaceDB converts a namespaced database to denamespaced format
+// DenamespaceDB converts a namespaced database to denamespaced format.
+// An empty namespace is detected from the source database.
 func (c *Converter) DenamespaceDB(sourceDB, destDB string, namespace string) error {
 	c.app.Log.Info("Denamespacing database", "source", sourceDB, "dest", destDB, "namespace", namespace)
 
@@ -29,6 +30,9 @@ func (c *Converter) DenamespaceDB(sourceDB, destDB string, namespace string) err
 	if err != nil {
 		return fmt.Errorf("invalid namespace hex: %w", err)
 	}
+	if len(namespaceBytes) == 0 {
+		c.app.Log.Info("No namespace given, detecting it from the source database")
+	}
 
 	// Create database converter
 	config := &database.ConversionConfig{
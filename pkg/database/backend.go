@@ -0,0 +1,140 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/leveldb"
+	"github.com/luxfi/geth/ethdb/pebble"
+)
+
+// BadgerV3DB identifies a BadgerDB store written with the v3 on-disk format.
+// BadgerDB on its own refers to the v4 format used by luxd.
+const BadgerV3DB DatabaseType = "badgerdb-v3"
+
+// BackendOptions holds the tuning knobs passed to a backend when opening a store
+type BackendOptions struct {
+	ReadOnly  bool
+	CacheMB   int
+	Handles   int
+	Namespace string
+}
+
+// Backend opens a raw key-value store of a particular type
+type Backend func(path string, opts BackendOptions) (ethdb.KeyValueStore, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[DatabaseType]Backend{
+		PebbleDB:   openPebble,
+		LevelDB:    openLevelDB,
+		BadgerDB:   openBadger,
+		BadgerV3DB: openBadgerV3,
+	}
+)
+
+// RegisterBackend makes a backend available under the given database type.
+// Registering a type twice replaces the previous backend.
+func RegisterBackend(dbType DatabaseType, backend Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[dbType] = backend
+}
+
+// Backends returns the registered database types in sorted order
+func Backends() []DatabaseType {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	types := make([]DatabaseType, 0, len(backends))
+	for t := range backends {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// OpenKeyValueStore opens the store at path using the backend registered for dbType.
+// An empty dbType is resolved with DetectDatabaseType.
+func OpenKeyValueStore(dbType DatabaseType, path string, opts BackendOptions) (ethdb.KeyValueStore, error) {
+	if dbType == "" {
+		dbType = DetectDatabaseType(path)
+	}
+
+	backendsMu.RLock()
+	backend, ok := backends[dbType]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type %q (available: %v)", dbType, Backends())
+	}
+
+	if !opts.ReadOnly {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	kv, err := backend(path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database at %s: %w", dbType, path, err)
+	}
+	return kv, nil
+}
+
+// OpenEthDB opens the store at path and wraps it as an ethdb.Database so it can
+// be used with rawdb accessors. When path has an ancient directory its freezer
+// is attached read-only, so frozen blocks are read through the same accessors
+// while geth's background freezer never moves blocks on its own.
+func OpenEthDB(dbType DatabaseType, path string, opts BackendOptions) (ethdb.Database, error) {
+	kv, err := OpenKeyValueStore(dbType, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	ancient := AncientPath(path)
+	if _, err := os.Stat(ancient); err != nil {
+		return rawdb.NewDatabase(kv), nil
+	}
+	db, err := rawdb.Open(kv, rawdb.OpenOptions{Ancient: ancient, ReadOnly: true})
+	if err != nil {
+		kv.Close()
+		return nil, fmt.Errorf("failed to open freezer at %s: %w", ancient, err)
+	}
+	return db, nil
+}
+
+// DetectDatabaseType guesses the backend of an existing database directory from
+// the files it contains. Missing or empty directories default to PebbleDB.
+func DetectDatabaseType(path string) DatabaseType {
+	has := func(pattern string) bool {
+		matches, _ := filepath.Glob(filepath.Join(path, pattern))
+		return len(matches) > 0
+	}
+
+	switch {
+	case has("*.vlog") || has("KEYREGISTRY"):
+		return BadgerDB
+	case has("OPTIONS-*"):
+		return PebbleDB
+	case has("*.ldb"):
+		return LevelDB
+	case has("*.sst"):
+		return PebbleDB
+	case has("MANIFEST-*") && has("LOG"):
+		return LevelDB
+	default:
+		return PebbleDB
+	}
+}
+
+func openPebble(path string, opts BackendOptions) (ethdb.KeyValueStore, error) {
+	return pebble.New(path, opts.CacheMB, opts.Handles, opts.Namespace, opts.ReadOnly)
+}
+
+func openLevelDB(path string, opts BackendOptions) (ethdb.KeyValueStore, error) {
+	return leveldb.New(path, opts.CacheMB, opts.Handles, opts.Namespace, opts.ReadOnly)
+}
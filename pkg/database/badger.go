@@ -0,0 +1,240 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// errNotFound is returned by the badger stores when a key is missing
+var errNotFound = errors.New("not found")
+
+// badgerStore implements ethdb.KeyValueStore on top of BadgerDB v4
+type badgerStore struct {
+	db *badger.DB
+}
+
+func openBadger(path string, opts BackendOptions) (ethdb.KeyValueStore, error) {
+	bopts := badger.DefaultOptions(path)
+	bopts.Logger = nil
+	bopts.ReadOnly = opts.ReadOnly
+	if opts.CacheMB > 0 {
+		bopts.BlockCacheSize = int64(opts.CacheMB) << 20
+	}
+
+	db, err := badger.Open(bopts)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerStore{db: db}, nil
+}
+
+func (s *badgerStore) Has(key []byte) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *badgerStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, errNotFound
+	}
+	return value, err
+}
+
+func (s *badgerStore) Put(key []byte, value []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+}
+
+func (s *badgerStore) Delete(key []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+func (s *badgerStore) DeleteRange(start, end []byte) error {
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if end != nil && bytes.Compare(key, end) >= 0 {
+				break
+			}
+			if err := wb.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+func (s *badgerStore) Stat() (string, error) {
+	lsm, vlog := s.db.Size()
+	return fmt.Sprintf("lsm: %d bytes, vlog: %d bytes", lsm, vlog), nil
+}
+
+func (s *badgerStore) SyncKeyValue() error { return s.db.Sync() }
+
+// Compact is a no-op; badger compacts its LSM tree in the background.
+func (s *badgerStore) Compact(start []byte, limit []byte) error { return nil }
+
+func (s *badgerStore) Close() error { return s.db.Close() }
+
+func (s *badgerStore) NewBatch() ethdb.Batch { return &badgerBatch{db: s.db} }
+
+func (s *badgerStore) NewBatchWithSize(size int) ethdb.Batch { return s.NewBatch() }
+
+func (s *badgerStore) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	txn := s.db.NewTransaction(false)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	it.Seek(append(append([]byte{}, prefix...), start...))
+	return &badgerIterator{txn: txn, it: it, prefix: prefix}
+}
+
+// badgerBatch buffers writes and flushes them through a badger WriteBatch
+type badgerBatch struct {
+	db   *badger.DB
+	ops  []batchOp
+	size int
+}
+
+// batchOp is a single buffered write shared by the badger batch implementations
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+func (b *badgerBatch) Put(key []byte, value []byte) error {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), value: bytes.Clone(value)})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+func (b *badgerBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), delete: true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *badgerBatch) DeleteRange(start, end []byte) error {
+	return (&badgerStore{db: b.db}).DeleteRange(start, end)
+}
+
+func (b *badgerBatch) ValueSize() int { return b.size }
+
+func (b *badgerBatch) Write() error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			err = wb.Delete(op.key)
+		} else {
+			err = wb.Set(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (b *badgerBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+func (b *badgerBatch) Replay(w ethdb.KeyValueWriter) error {
+	return replayOps(b.ops, w)
+}
+
+func replayOps(ops []batchOp, w ethdb.KeyValueWriter) error {
+	for _, op := range ops {
+		var err error
+		if op.delete {
+			err = w.Delete(op.key)
+		} else {
+			err = w.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// badgerIterator adapts a badger iterator to ethdb.Iterator
+type badgerIterator struct {
+	txn     *badger.Txn
+	it      *badger.Iterator
+	prefix  []byte
+	started bool
+	key     []byte
+	value   []byte
+	err     error
+}
+
+func (i *badgerIterator) Next() bool {
+	if i.it == nil || i.err != nil {
+		return false
+	}
+	if i.started {
+		i.it.Next()
+	}
+	i.started = true
+
+	if !i.it.ValidForPrefix(i.prefix) {
+		i.key, i.value = nil, nil
+		return false
+	}
+	item := i.it.Item()
+	i.key = item.KeyCopy(nil)
+	i.value, i.err = item.ValueCopy(nil)
+	return i.err == nil
+}
+
+func (i *badgerIterator) Error() error  { return i.err }
+func (i *badgerIterator) Key() []byte   { return i.key }
+func (i *badgerIterator) Value() []byte { return i.value }
+
+func (i *badgerIterator) Release() {
+	if i.it != nil {
+		i.it.Close()
+		i.txn.Discard()
+		i.it = nil
+	}
+}
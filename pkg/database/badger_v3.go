@@ -0,0 +1,215 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// badgerV3Store implements ethdb.KeyValueStore on top of BadgerDB v3
+type badgerV3Store struct {
+	db *badger.DB
+}
+
+func openBadgerV3(path string, opts BackendOptions) (ethdb.KeyValueStore, error) {
+	bopts := badger.DefaultOptions(path)
+	bopts.Logger = nil
+	bopts.ReadOnly = opts.ReadOnly
+	if opts.CacheMB > 0 {
+		bopts.BlockCacheSize = int64(opts.CacheMB) << 20
+	}
+
+	db, err := badger.Open(bopts)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerV3Store{db: db}, nil
+}
+
+func (s *badgerV3Store) Has(key []byte) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *badgerV3Store) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, errNotFound
+	}
+	return value, err
+}
+
+func (s *badgerV3Store) Put(key []byte, value []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+}
+
+func (s *badgerV3Store) Delete(key []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+func (s *badgerV3Store) DeleteRange(start, end []byte) error {
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if end != nil && bytes.Compare(key, end) >= 0 {
+				break
+			}
+			if err := wb.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+func (s *badgerV3Store) Stat() (string, error) {
+	lsm, vlog := s.db.Size()
+	return fmt.Sprintf("lsm: %d bytes, vlog: %d bytes", lsm, vlog), nil
+}
+
+func (s *badgerV3Store) SyncKeyValue() error { return s.db.Sync() }
+
+// Compact is a no-op, see badgerStore.Compact.
+func (s *badgerV3Store) Compact(start []byte, limit []byte) error { return nil }
+
+func (s *badgerV3Store) Close() error { return s.db.Close() }
+
+func (s *badgerV3Store) NewBatch() ethdb.Batch { return &badgerV3Batch{db: s.db} }
+
+func (s *badgerV3Store) NewBatchWithSize(size int) ethdb.Batch { return s.NewBatch() }
+
+func (s *badgerV3Store) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	txn := s.db.NewTransaction(false)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	it.Seek(append(append([]byte{}, prefix...), start...))
+	return &badgerV3Iterator{txn: txn, it: it, prefix: prefix}
+}
+
+// badgerV3Batch buffers writes and flushes them through a badger v3 WriteBatch
+type badgerV3Batch struct {
+	db   *badger.DB
+	ops  []batchOp
+	size int
+}
+
+func (b *badgerV3Batch) Put(key []byte, value []byte) error {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), value: bytes.Clone(value)})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+func (b *badgerV3Batch) Delete(key []byte) error {
+	b.ops = append(b.ops, batchOp{key: bytes.Clone(key), delete: true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *badgerV3Batch) DeleteRange(start, end []byte) error {
+	return (&badgerV3Store{db: b.db}).DeleteRange(start, end)
+}
+
+func (b *badgerV3Batch) ValueSize() int { return b.size }
+
+func (b *badgerV3Batch) Write() error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			err = wb.Delete(op.key)
+		} else {
+			err = wb.Set(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (b *badgerV3Batch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+func (b *badgerV3Batch) Replay(w ethdb.KeyValueWriter) error {
+	return replayOps(b.ops, w)
+}
+
+// badgerV3Iterator adapts a badger v3 iterator to ethdb.Iterator
+type badgerV3Iterator struct {
+	txn     *badger.Txn
+	it      *badger.Iterator
+	prefix  []byte
+	started bool
+	key     []byte
+	value   []byte
+	err     error
+}
+
+func (i *badgerV3Iterator) Next() bool {
+	if i.it == nil || i.err != nil {
+		return false
+	}
+	if i.started {
+		i.it.Next()
+	}
+	i.started = true
+
+	if !i.it.ValidForPrefix(i.prefix) {
+		i.key, i.value = nil, nil
+		return false
+	}
+	item := i.it.Item()
+	i.key = item.KeyCopy(nil)
+	i.value, i.err = item.ValueCopy(nil)
+	return i.err == nil
+}
+
+func (i *badgerV3Iterator) Error() error  { return i.err }
+func (i *badgerV3Iterator) Key() []byte   { return i.key }
+func (i *badgerV3Iterator) Value() []byte { return i.value }
+
+func (i *badgerV3Iterator) Release() {
+	if i.it != nil {
+		i.it.Close()
+		i.txn.Discard()
+		i.it = nil
+	}
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// BlockRange selects the canonical blocks [From, To] of a partial copy
+type BlockRange struct {
+	From uint64
+	// To is the last block copied and the block whose state is copied;
+	// 0 means the head block
+	To uint64
+}
+
+// Enabled reports whether the range limits anything
+func (r BlockRange) Enabled() bool {
+	return r.From > 0 || r.To > 0
+}
+
+// BlockRangeStats reports what CopyBlockRange copied
+type BlockRangeStats struct {
+	From   uint64
+	To     uint64
+	Head   common.Hash
+	Root   common.Hash
+	Blocks uint64
+	Keys   uint64
+	State  state.Stats
+}
+
+// headPointerKeys are pointed at the last copied block. Coreth restores its
+// last accepted block from AcceptorTipKey.
+var headPointerKeys = [][]byte{
+	[]byte("LastHeader"),
+	[]byte("LastBlock"),
+	[]byte("LastFast"),
+	[]byte("AcceptorTipKey"),
+}
+
+// CopyBlockRange copies the canonical blocks in r from src to dst, with their
+// canonical and hash-to-number entries, total difficulties, bodies and
+// receipts, then copies the state trie reachable from the state root of the
+// last block and points the head pointers at it. The genesis block and chain
+// config are always copied too, since a node cannot open the database
+// without them. src must already have any namespace removed, e.g. through
+// state.NewPrefixReader.
+func CopyBlockRange(ctx context.Context, src ethdb.KeyValueReader, dst ethdb.KeyValueStore, r BlockRange, workers int, progress io.Writer) (*BlockRangeStats, error) {
+	if r.To == 0 {
+		number, err := headBlockNumber(src)
+		if err != nil {
+			return nil, err
+		}
+		r.To = number
+	}
+	if r.From > r.To {
+		return nil, fmt.Errorf("start block %d is past end block %d", r.From, r.To)
+	}
+
+	stats := &BlockRangeStats{From: r.From, To: r.To}
+	batch := dst.NewBatch()
+	put := func(key, value []byte) error {
+		stats.Keys++
+		if err := batch.Put(key, value); err != nil {
+			return err
+		}
+		if batch.ValueSize() < ethdb.IdealBatchSize {
+			return nil
+		}
+		if err := batch.Write(); err != nil {
+			return fmt.Errorf("failed to write batch: %w", err)
+		}
+		batch.Reset()
+		return nil
+	}
+
+	var header []byte
+	copyBlock := func(number uint64) error {
+		var err error
+		stats.Head, header, err = copyCanonicalBlock(src, number, put)
+		if err != nil {
+			return err
+		}
+		stats.Blocks++
+		return nil
+	}
+	if r.From > 0 {
+		if err := copyBlock(0); err != nil {
+			return stats, err
+		}
+	}
+	genesis, err := src.Get(canonicalHashKey(0))
+	if err != nil || len(genesis) != common.HashLength {
+		return stats, errors.New("no canonical genesis hash")
+	}
+	for _, prefix := range []string{"ethereum-config-", "ethereum-genesis-"} {
+		key := append([]byte(prefix), genesis...)
+		if value, err := src.Get(key); err == nil && len(value) > 0 {
+			if err := put(key, value); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	for number := r.From; number <= r.To; number++ {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		if err := copyBlock(number); err != nil {
+			return stats, err
+		}
+		if progress != nil && stats.Blocks%100000 == 0 {
+			fmt.Fprintf(progress, "  Copied %d blocks (#%d)\n", stats.Blocks, number)
+		}
+		if number == r.To {
+			break // avoid wrapping around at the maximum block number
+		}
+	}
+
+	for _, key := range headPointerKeys {
+		if err := put(key, stats.Head.Bytes()); err != nil {
+			return stats, err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return stats, fmt.Errorf("failed to write batch: %w", err)
+	}
+
+	stats.Root, err = HeaderHashField(header, HeaderRootField)
+	if err != nil {
+		return stats, fmt.Errorf("block %d: %w", r.To, err)
+	}
+	if progress != nil {
+		fmt.Fprintf(progress, "  Copying state at block %d (root %s)\n", r.To, stats.Root.Hex())
+	}
+	stats.State, err = state.Copy(ctx, src, dst, state.CopyConfig{Root: stats.Root, Workers: workers, Progress: progress})
+	if err != nil {
+		return stats, fmt.Errorf("failed to copy state at block %d: %w", r.To, err)
+	}
+	return stats, nil
+}
+
+// copyCanonicalBlock copies the canonical block at number and returns its hash
+// and encoded header. The header is required; the other entries are copied
+// when present.
+func copyCanonicalBlock(src ethdb.KeyValueReader, number uint64, put func(key, value []byte) error) (common.Hash, []byte, error) {
+	value, err := src.Get(canonicalHashKey(number))
+	if err != nil || len(value) != common.HashLength {
+		return common.Hash{}, nil, fmt.Errorf("no canonical hash for block #%d", number)
+	}
+	hash := common.BytesToHash(value)
+	if err := put(canonicalHashKey(number), value); err != nil {
+		return hash, nil, err
+	}
+
+	blockKey := append(binary.BigEndian.AppendUint64(nil, number), hash.Bytes()...)
+	header, err := src.Get(append([]byte("h"), blockKey...))
+	if err != nil || len(header) == 0 {
+		return hash, nil, fmt.Errorf("header of block #%d %s is missing", number, hash.Hex())
+	}
+	if err := put(append([]byte("h"), blockKey...), header); err != nil {
+		return hash, nil, err
+	}
+	if err := put(append([]byte("H"), hash.Bytes()...), binary.BigEndian.AppendUint64(nil, number)); err != nil {
+		return hash, nil, err
+	}
+	for _, key := range [][]byte{
+		append(append([]byte("h"), blockKey...), 't'),
+		append([]byte("b"), blockKey...),
+		append([]byte("r"), blockKey...),
+	} {
+		if value, err := src.Get(key); err == nil && len(value) > 0 {
+			if err := put(key, value); err != nil {
+				return hash, nil, err
+			}
+		}
+	}
+	return hash, header, nil
+}
+
+// headBlockNumber returns the number of the block LastBlock points at
+func headBlockNumber(db ethdb.KeyValueReader) (uint64, error) {
+	head, err := db.Get([]byte("LastBlock"))
+	if err != nil || len(head) != common.HashLength {
+		return 0, errors.New("head block not found, pass an explicit end block")
+	}
+	number, err := db.Get(append([]byte("H"), head...))
+	if err != nil || len(number) != 8 {
+		return 0, fmt.Errorf("no block number for head block %x", head)
+	}
+	return binary.BigEndian.Uint64(number), nil
+}
+
+// CanonicalStateRoot returns the hash and state root of the canonical block
+// at number
+func CanonicalStateRoot(db ethdb.KeyValueReader, number uint64) (common.Hash, common.Hash, error) {
+	value, err := db.Get(canonicalHashKey(number))
+	if err != nil || len(value) != common.HashLength {
+		return common.Hash{}, common.Hash{}, fmt.Errorf("no canonical hash for block #%d", number)
+	}
+	hash := common.BytesToHash(value)
+	header, err := db.Get(append(binary.BigEndian.AppendUint64([]byte("h"), number), hash.Bytes()...))
+	if err != nil || len(header) == 0 {
+		return hash, common.Hash{}, fmt.Errorf("header of block #%d %s is missing", number, hash.Hex())
+	}
+	root, err := HeaderHashField(header, HeaderRootField)
+	if err != nil {
+		return hash, common.Hash{}, fmt.Errorf("block #%d: %w", number, err)
+	}
+	return hash, root, nil
+}
+
+// canonicalHashKey = "h" + num (uint64 big endian) + "n"
+func canonicalHashKey(number uint64) []byte {
+	return append(binary.BigEndian.AppendUint64([]byte("h"), number), 'n')
+}
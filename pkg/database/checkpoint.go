@@ -0,0 +1,187 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/luxfi/geth/common/hexutil"
+)
+
+// ErrCheckpointMismatch is returned when a checkpoint was written for a different
+// source database or configuration than the one being resumed.
+var ErrCheckpointMismatch = errors.New("checkpoint does not match current migration")
+
+// Checkpoint records how far a migration got at its last committed batch
+type Checkpoint struct {
+	Phase      string          `json:"phase"`
+	LastKey    hexutil.Bytes   `json:"lastKey"`
+	Ranges     []RangeProgress `json:"ranges,omitempty"`
+	Stats      json.RawMessage `json:"stats,omitempty"`
+	SourceID   string          `json:"sourceId"`
+	ConfigHash string          `json:"configHash"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+}
+
+// RangeProgress tracks one key range of a partitioned migration. Start is
+// inclusive, End is exclusive and a nil bound is open.
+type RangeProgress struct {
+	Start   hexutil.Bytes `json:"start,omitempty"`
+	End     hexutil.Bytes `json:"end,omitempty"`
+	LastKey hexutil.Bytes `json:"lastKey,omitempty"`
+	Done    bool          `json:"done"`
+}
+
+// Checkpointer persists checkpoints in a sidecar file next to the destination
+// database. The file is replaced atomically so a crash never leaves a torn checkpoint.
+type Checkpointer struct {
+	path       string
+	sourceID   string
+	configHash string
+}
+
+// NewCheckpointer creates a checkpointer for a migration from sourcePath into destPath.
+// The config value is hashed so a resume with different settings is rejected.
+func NewCheckpointer(sourcePath, destPath string, config interface{}) (*Checkpointer, error) {
+	sourceID, err := fingerprintDir(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint source database: %w", err)
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode migration config: %w", err)
+	}
+	configSum := sha256.Sum256(configJSON)
+
+	return &Checkpointer{
+		path:       CheckpointPath(destPath),
+		sourceID:   sourceID,
+		configHash: hex.EncodeToString(configSum[:]),
+	}, nil
+}
+
+// CheckpointPath returns the sidecar file used for a destination database
+func CheckpointPath(destPath string) string {
+	return filepath.Clean(destPath) + ".checkpoint.json"
+}
+
+// Path returns the location of the checkpoint file
+func (c *Checkpointer) Path() string {
+	return c.path
+}
+
+// Load reads the existing checkpoint. It returns nil without error when there is
+// none, and ErrCheckpointMismatch when the source or config changed since it was written.
+func (c *Checkpointer) Load() (*Checkpoint, error) {
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", c.path, err)
+	}
+	if cp.SourceID != c.sourceID {
+		return nil, fmt.Errorf("%w: source database changed since %s", ErrCheckpointMismatch, cp.UpdatedAt.Format(time.RFC3339))
+	}
+	if cp.ConfigHash != c.configHash {
+		return nil, fmt.Errorf("%w: configuration changed since %s", ErrCheckpointMismatch, cp.UpdatedAt.Format(time.RFC3339))
+	}
+	return &cp, nil
+}
+
+// Save records progress after a batch has been committed to the destination
+func (c *Checkpointer) Save(phase string, lastKey []byte, stats interface{}) error {
+	return c.write(&Checkpoint{Phase: phase, LastKey: append([]byte{}, lastKey...)}, stats)
+}
+
+// SaveRanges records the progress of every key range of a partitioned migration
+func (c *Checkpointer) SaveRanges(phase string, ranges []RangeProgress, stats interface{}) error {
+	return c.write(&Checkpoint{Phase: phase, Ranges: ranges}, stats)
+}
+
+func (c *Checkpointer) write(cp *Checkpoint, stats interface{}) error {
+	cp.SourceID = c.sourceID
+	cp.ConfigHash = c.configHash
+	cp.UpdatedAt = time.Now().UTC()
+	if stats != nil {
+		raw, err := json.Marshal(stats)
+		if err != nil {
+			return fmt.Errorf("failed to encode checkpoint stats: %w", err)
+		}
+		cp.Stats = raw
+	}
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync checkpoint: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Clear removes the checkpoint once a migration has completed
+func (c *Checkpointer) Clear() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// fingerprintDir hashes the names, sizes and modification times of the data files
+// in a database directory. Lock and informational log files are ignored since
+// opening a database may touch them without changing its contents.
+func fingerprintDir(path string) (string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == "LOCK" || strings.HasPrefix(name, "LOG") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(path, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s:%d:%d\n", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
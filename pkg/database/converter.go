@@ -1,31 +1,52 @@
 package database
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/pebble"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/luxfi/genesis/pkg/state"
 )
 
 // ConversionType represents the type of database conversion
 type ConversionType string
 
 const (
-	SubnetToCoreth   ConversionType = "subnet-to-coreth"
-	CorethToSubnet   ConversionType = "coreth-to-subnet"
-	PebbleToBadger   ConversionType = "pebble-to-badger"
-	BadgerToPebble   ConversionType = "badger-to-pebble"
-	DenamespaceDB    ConversionType = "denamespace"
-	AddNamespaceDB   ConversionType = "add-namespace"
+	SubnetToCoreth  ConversionType = "subnet-to-coreth"
+	CorethToSubnet  ConversionType = "coreth-to-subnet"
+	PebbleToBadger  ConversionType = "pebble-to-badger"
+	BadgerToPebble  ConversionType = "badger-to-pebble"
+	DenamespaceDB   ConversionType = "denamespace"
+	AddNamespaceDB  ConversionType = "add-namespace"
+	LevelDBToPebble ConversionType = "leveldb-to-pebble"
+	LevelDBToBadger ConversionType = "leveldb-to-badger"
+	PebbleToLevelDB ConversionType = "pebble-to-leveldb"
+	BadgerToLevelDB ConversionType = "badger-to-leveldb"
 )
 
+// keyValueConversions maps the conversions that copy keys between backends
+// through ethdb.KeyValueStore to their source and destination types
+var keyValueConversions = map[ConversionType][2]DatabaseType{
+	LevelDBToPebble: {LevelDB, PebbleDB},
+	LevelDBToBadger: {LevelDB, BadgerDB},
+	PebbleToLevelDB: {PebbleDB, LevelDB},
+	BadgerToLevelDB: {BadgerDB, LevelDB},
+}
+
 // DatabaseType represents the database backend type
 type DatabaseType string
 
@@ -37,8 +58,10 @@ const (
 
 // ConversionConfig holds configuration for database conversion
 type ConversionConfig struct {
-	SourcePath      string
-	DestPath        string
+	SourcePath string
+	DestPath   string
+	// SourceType and DestType default to pebbledb and badgerdb, or to the
+	// types a leveldb conversion is named after
 	SourceType      DatabaseType
 	DestType        DatabaseType
 	ConversionType  ConversionType
@@ -48,28 +71,55 @@ type ConversionConfig struct {
 	VerifyData      bool
 	PreserveHeaders bool
 	FixCanonical    bool
+	Resume          bool
+	// CheckpointInterval is the least time between two checkpoint saves of
+	// the copy workers; 0 saves after every committed batch
+	CheckpointInterval time.Duration
+	Workers            int
+	// FromBlock and ToBlock limit the conversion to the canonical blocks in
+	// that range and the state at ToBlock; both 0 converts everything
+	FromBlock uint64
+	ToBlock   uint64
+	// ConvertReceipts validates the receipts of subnet-to-coreth and
+	// denamespace conversions against their header roots and re-encodes them
+	// in the coreth layout once the copy is done
+	ConvertReceipts bool
+	// DropInvalidReceipts deletes the receipts that fail that validation
+	// instead of keeping the copied bytes
+	DropInvalidReceipts bool
+	// FreezeBelow moves blocks below this number into the destination's
+	// freezer once the conversion is done; 0 disables freezing
+	FreezeBelow uint64
 }
 
 // ConversionStats tracks conversion statistics
 type ConversionStats struct {
-	TotalKeys       uint64
-	Headers         uint64
-	Bodies          uint64
-	Receipts        uint64
-	Canonical       uint64
-	HashToNumber    uint64
-	StateNodes      uint64
-	Code            uint64
-	Other           uint64
-	LastBlockNum    uint64
-	LastBlockHash   common.Hash
-	StartTime       time.Time
+	TotalKeys     uint64
+	Headers       uint64
+	Bodies        uint64
+	Receipts      uint64
+	Canonical     uint64
+	HashToNumber  uint64
+	StateNodes    uint64
+	Code          uint64
+	Other         uint64
+	LastBlockNum  uint64
+	LastBlockHash common.Hash
+	StartTime     time.Time
 }
 
 // DatabaseConverter handles database conversions
 type DatabaseConverter struct {
-	config *ConversionConfig
-	stats  *ConversionStats
+	config     *ConversionConfig
+	stats      *ConversionStats
+	checkpoint *Checkpointer
+
+	// Shared state of the copy workers, guarded by mu
+	mu       sync.Mutex
+	ranges   []RangeProgress
+	reported uint64
+	savedAt  time.Time
+	failed   atomic.Bool
 }
 
 // NewDatabaseConverter creates a new database converter
@@ -77,6 +127,9 @@ func NewDatabaseConverter(config *ConversionConfig) *DatabaseConverter {
 	if config.BatchSize == 0 {
 		config.BatchSize = 10000
 	}
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
 	return &DatabaseConverter{
 		config: config,
 		stats:  &ConversionStats{StartTime: time.Now()},
@@ -85,11 +138,84 @@ func NewDatabaseConverter(config *ConversionConfig) *DatabaseConverter {
 
 // Convert performs the database conversion
 func (c *DatabaseConverter) Convert() error {
+	if err := c.resolveBackendTypes(); err != nil {
+		return err
+	}
+
 	fmt.Printf("Starting database conversion:\n")
 	fmt.Printf("  Source: %s (%s)\n", c.config.SourcePath, c.config.SourceType)
 	fmt.Printf("  Destination: %s (%s)\n", c.config.DestPath, c.config.DestType)
 	fmt.Printf("  Conversion Type: %s\n\n", c.config.ConversionType)
 
+	switch c.config.ConversionType {
+	case SubnetToCoreth, DenamespaceDB, LevelDBToPebble, LevelDBToBadger:
+		if err := c.resolveNamespace(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if blocks := c.blockRange(); blocks.Enabled() {
+		err = c.convertBlockRange(blocks)
+	} else {
+		err = c.convertAll()
+	}
+	if err != nil {
+		return err
+	}
+	if c.config.ConvertReceipts && (c.config.ConversionType == SubnetToCoreth || c.config.ConversionType == DenamespaceDB) {
+		if err := c.convertDestinationReceipts(); err != nil {
+			return err
+		}
+	}
+	if c.config.FreezeBelow == 0 {
+		return nil
+	}
+	return c.freezeDestination()
+}
+
+// convertDestinationReceipts runs the receipts pass over the converted database
+func (c *DatabaseConverter) convertDestinationReceipts() error {
+	fmt.Printf("\nValidating and re-encoding receipts...\n")
+
+	kv, err := OpenKeyValueStore(c.config.DestType, c.config.DestPath, BackendOptions{})
+	if err != nil {
+		return err
+	}
+	defer kv.Close()
+
+	stats, err := ConvertReceipts(kv, c.config.BatchSize, c.config.DropInvalidReceipts)
+	if err != nil {
+		return fmt.Errorf("failed to convert receipts: %w", err)
+	}
+	fmt.Printf("Checked receipts of %d blocks, re-encoded %d", stats.Blocks, stats.Reencoded)
+	schemas := make([]string, 0, len(stats.Schemas))
+	for schema := range stats.Schemas {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+	for _, schema := range schemas {
+		fmt.Printf(", %s: %d", schema, stats.Schemas[schema])
+	}
+	fmt.Println()
+	if stats.Invalid > 0 {
+		if stats.Dropped > 0 {
+			fmt.Printf("WARNING: dropped the receipts of %d blocks that failed validation:\n", stats.Dropped)
+		} else {
+			fmt.Printf("WARNING: kept the receipts of %d blocks that failed validation (see --drop-invalid-receipts):\n", stats.Invalid)
+		}
+		for _, f := range stats.Failures {
+			fmt.Printf("  %s\n", f)
+		}
+		if shown := uint64(len(stats.Failures)); stats.Invalid > shown {
+			fmt.Printf("  ... and %d more\n", stats.Invalid-shown)
+		}
+	}
+	return nil
+}
+
+// convertAll copies the whole source database
+func (c *DatabaseConverter) convertAll() error {
 	switch c.config.ConversionType {
 	case SubnetToCoreth:
 		return c.convertSubnetToCoreth()
@@ -103,15 +229,90 @@ func (c *DatabaseConverter) Convert() error {
 		return c.denamespaceDatabase()
 	case AddNamespaceDB:
 		return c.addNamespaceToDatabase()
+	case LevelDBToPebble, LevelDBToBadger, PebbleToLevelDB, BadgerToLevelDB:
+		return c.convertKeyValueStore()
 	default:
 		return fmt.Errorf("unsupported conversion type: %s", c.config.ConversionType)
 	}
 }
 
+func (c *DatabaseConverter) blockRange() BlockRange {
+	return BlockRange{From: c.config.FromBlock, To: c.config.ToBlock}
+}
+
+// convertBlockRange copies only the canonical blocks in range and the state at
+// the last of them, removing the namespace if one is configured
+func (c *DatabaseConverter) convertBlockRange(blocks BlockRange) error {
+	switch c.config.ConversionType {
+	case SubnetToCoreth, DenamespaceDB, PebbleToBadger:
+	default:
+		if _, ok := keyValueConversions[c.config.ConversionType]; !ok {
+			return fmt.Errorf("%s conversions cannot be limited to a block range", c.config.ConversionType)
+		}
+	}
+	if c.config.Resume {
+		return errors.New("block-range conversions cannot be resumed, start them again instead")
+	}
+
+	src, err := OpenKeyValueStore(c.config.SourceType, c.config.SourcePath, BackendOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := OpenKeyValueStore(c.config.DestType, c.config.DestPath, BackendOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to open destination database: %w", err)
+	}
+	defer dst.Close()
+
+	fmt.Printf("Copying canonical blocks %d-%s and the state at the last one...\n", blocks.From, rangeEnd(blocks.To))
+	stats, err := CopyBlockRange(context.Background(), state.NewPrefixReader(src, c.config.Namespace), dst, blocks, c.config.Workers, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✅ Copied blocks %d-%d (%d keys) and the state at root %s\n", stats.From, stats.To, stats.Keys, stats.Root.Hex())
+	fmt.Printf("State: %s\n", stats.State)
+	fmt.Printf("Head: #%d %s\n", stats.To, stats.Head.Hex())
+	return nil
+}
+
+// rangeEnd formats the end of a block range, where 0 means the head
+func rangeEnd(to uint64) string {
+	if to == 0 {
+		return "head"
+	}
+	return strconv.FormatUint(to, 10)
+}
+
+// freezeDestination moves old blocks of the converted database into its freezer
+func (c *DatabaseConverter) freezeDestination() error {
+	fmt.Printf("\nFreezing blocks below %d into %s...\n", c.config.FreezeBelow, AncientPath(c.config.DestPath))
+
+	kv, err := OpenKeyValueStore(c.config.DestType, c.config.DestPath, BackendOptions{})
+	if err != nil {
+		return err
+	}
+	defer kv.Close()
+
+	stats, err := Freeze(kv, AncientPath(c.config.DestPath), c.config.FreezeBelow, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("failed to freeze blocks: %w", err)
+	}
+	fmt.Printf("Froze %d blocks (%.1f MB)\n", stats.Blocks, float64(stats.Bytes)/(1024*1024))
+	return nil
+}
+
 // convertSubnetToCoreth converts SubnetEVM database to Coreth format
 func (c *DatabaseConverter) convertSubnetToCoreth() error {
+	saved, err := c.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+
 	// Open source PebbleDB
-	pdb, err := pebble.Open(c.config.SourcePath, &pebble.Options{})
+	pdb, err := pebble.Open(c.config.SourcePath, &pebble.Options{ReadOnly: true})
 	if err != nil {
 		return fmt.Errorf("failed to open source database: %w", err)
 	}
@@ -126,101 +327,30 @@ func (c *DatabaseConverter) convertSubnetToCoreth() error {
 	}
 	defer bdb.Close()
 
-	// Track blocks for canonical chain
-	blockMap := make(map[uint64]common.Hash)
-	var maxBlockNum uint64
+	c.ranges = c.planRanges(pdb, saved)
 
 	// First pass: Scan for block information
-	fmt.Println("Phase 1: Scanning for blocks...")
-	iter, _ := pdb.NewIter(nil)
-	for iter.First(); iter.Valid(); iter.Next() {
-		key := iter.Key()
-		
-		// Remove namespace if present
-		if len(c.config.Namespace) > 0 && len(key) > len(c.config.Namespace) {
-			if bytes.Equal(key[:len(c.config.Namespace)], c.config.Namespace) {
-				key = key[len(c.config.Namespace):]
-			}
-		}
-
-		// Track headers for canonical chain
-		if c.isHeaderKey(key) {
-			blockNum, hash := c.parseHeaderKey(key)
-			if blockNum > 0 {
-				blockMap[blockNum] = hash
-				if blockNum > maxBlockNum {
-					maxBlockNum = blockNum
-					c.stats.LastBlockNum = blockNum
-					c.stats.LastBlockHash = hash
-				}
-			}
-		}
+	fmt.Printf("Phase 1: Scanning for blocks (%d workers)...\n", len(c.ranges))
+	blockMap, err := c.scanBlocks(pdb, c.ranges)
+	if err != nil {
+		return fmt.Errorf("failed to scan blocks: %w", err)
 	}
-	iter.Close()
 
-	fmt.Printf("Found blocks up to height %d\n\n", maxBlockNum)
+	fmt.Printf("Found blocks up to height %d\n\n", c.stats.LastBlockNum)
 
-	// Second pass: Migrate all data
+	// Second pass: Migrate all data, one worker per key range
 	fmt.Println("Phase 2: Migrating data...")
-	iter, _ = pdb.NewIter(nil)
-	defer iter.Close()
-
-	batch := bdb.NewWriteBatch()
-	batchCount := 0
-
-	for iter.First(); iter.Valid(); iter.Next() {
-		origKey := iter.Key()
-		value := iter.Value()
-
-		// Strip namespace if present
-		key := origKey
-		if len(c.config.Namespace) > 0 && len(key) > len(c.config.Namespace) {
-			if bytes.Equal(key[:len(c.config.Namespace)], c.config.Namespace) {
-				key = key[len(c.config.Namespace):]
-			}
-		}
-
-		// Make copies
-		keyCopy := make([]byte, len(key))
-		copy(keyCopy, key)
-		valueCopy := make([]byte, len(value))
-		copy(valueCopy, value)
-
-		// Write to destination
-		if err := batch.Set(keyCopy, valueCopy); err != nil {
-			return fmt.Errorf("failed to set key: %w", err)
-		}
-
-		// Update stats
-		c.updateStats(keyCopy)
-		c.stats.TotalKeys++
-		batchCount++
-
-		// Flush batch periodically
-		if batchCount >= c.config.BatchSize {
-			if err := batch.Flush(); err != nil {
-				return fmt.Errorf("failed to flush batch: %w", err)
-			}
-			batch = bdb.NewWriteBatch()
-			batchCount = 0
-
-			if c.config.Verbose && c.stats.TotalKeys%100000 == 0 {
-				c.printProgress()
-			}
-		}
+	if err := c.copyRanges(pebbleToBadger(pdb, bdb)); err != nil {
+		return err
 	}
-
-	// Flush final batch
-	if batchCount > 0 {
-		if err := batch.Flush(); err != nil {
-			return fmt.Errorf("failed to flush final batch: %w", err)
-		}
+	if err := c.checkpoint.SaveRanges("canonical", c.ranges, c.stats); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
 	}
 
 	// Phase 3: Fix canonical mappings if needed
 	if c.config.FixCanonical && c.stats.Canonical == 0 && len(blockMap) > 0 {
 		fmt.Println("\nPhase 3: Creating canonical mappings...")
-		batch = bdb.NewWriteBatch()
+		batch := bdb.NewWriteBatch()
 		for blockNum, hash := range blockMap {
 			canonKey := c.canonicalKey(blockNum)
 			if err := batch.Set(canonKey, hash.Bytes()); err != nil {
@@ -244,6 +374,10 @@ func (c *DatabaseConverter) convertSubnetToCoreth() error {
 	// Write metadata keys
 	c.writeMetadataKeys(bdb)
 
+	if err := c.checkpoint.Clear(); err != nil {
+		log.Printf("Failed to remove checkpoint %s: %v", c.checkpoint.Path(), err)
+	}
+
 	fmt.Println("\n" + strings.Repeat("=", 60))
 	fmt.Println("CONVERSION COMPLETED SUCCESSFULLY")
 	fmt.Println(strings.Repeat("=", 60))
@@ -252,16 +386,20 @@ func (c *DatabaseConverter) convertSubnetToCoreth() error {
 	return nil
 }
 
-// convertPebbleToBadger converts PebbleDB to BadgerDB
+// convertPebbleToBadger copies every key of a PebbleDB into a BadgerDB, with
+// one worker per key range
 func (c *DatabaseConverter) convertPebbleToBadger() error {
-	// Open source PebbleDB
-	pdb, err := pebble.Open(c.config.SourcePath, &pebble.Options{})
+	saved, err := c.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	pdb, err := pebble.Open(c.config.SourcePath, &pebble.Options{ReadOnly: true})
 	if err != nil {
 		return fmt.Errorf("failed to open PebbleDB: %w", err)
 	}
 	defer pdb.Close()
 
-	// Open destination BadgerDB
 	opts := badger.DefaultOptions(c.config.DestPath)
 	opts.Logger = nil
 	bdb, err := badger.Open(opts)
@@ -270,43 +408,17 @@ func (c *DatabaseConverter) convertPebbleToBadger() error {
 	}
 	defer bdb.Close()
 
-	// Copy all keys
-	iter, _ := pdb.NewIter(nil)
-	defer iter.Close()
-
-	batch := bdb.NewWriteBatch()
-	count := 0
-
-	for iter.First(); iter.Valid(); iter.Next() {
-		key := make([]byte, len(iter.Key()))
-		copy(key, iter.Key())
-		
-		value := make([]byte, len(iter.Value()))
-		copy(value, iter.Value())
-		
-		if err := batch.Set(key, value); err != nil {
-			return fmt.Errorf("failed to set key: %w", err)
-		}
-		
-		count++
-		
-		if count%c.config.BatchSize == 0 {
-			if err := batch.Flush(); err != nil {
-				return fmt.Errorf("failed to flush batch: %w", err)
-			}
-			batch = bdb.NewWriteBatch()
-			if c.config.Verbose {
-				fmt.Printf("Converted %d entries...\n", count)
-			}
-		}
+	c.ranges = c.planRanges(pdb, saved)
+	fmt.Printf("Copying %d key ranges in parallel...\n", len(c.ranges))
+	if err := c.copyRanges(pebbleToBadger(pdb, bdb)); err != nil {
+		return err
 	}
 
-	// Flush final batch
-	if err := batch.Flush(); err != nil {
-		return fmt.Errorf("failed to flush final batch: %w", err)
+	if err := c.checkpoint.Clear(); err != nil {
+		log.Printf("Failed to remove checkpoint %s: %v", c.checkpoint.Path(), err)
 	}
-
-	fmt.Printf("\n✅ Successfully converted %d entries from PebbleDB to BadgerDB!\n", count)
+	fmt.Printf("\n✅ Successfully converted %d entries from PebbleDB to BadgerDB!\n", c.stats.TotalKeys)
+	c.printFinalStats()
 	return nil
 }
 
@@ -317,13 +429,122 @@ func (c *DatabaseConverter) denamespaceDatabase() error {
 	}
 
 	fmt.Printf("Removing namespace: %s\n", hex.EncodeToString(c.config.Namespace))
-	
+
 	// For now, delegate to convertSubnetToCoreth with namespace stripping
 	return c.convertSubnetToCoreth()
 }
 
 // Helper methods
 
+// resolveBackendTypes fills in the source and destination types left unset.
+// The leveldb conversions are named after their types, so types that were set
+// must match them.
+func (c *DatabaseConverter) resolveBackendTypes() error {
+	types, fixed := keyValueConversions[c.config.ConversionType]
+	if !fixed {
+		types = [2]DatabaseType{PebbleDB, BadgerDB}
+	}
+	for i, side := range []struct {
+		name string
+		typ  *DatabaseType
+	}{{"source", &c.config.SourceType}, {"destination", &c.config.DestType}} {
+		switch {
+		case *side.typ == "":
+			*side.typ = types[i]
+		case fixed && *side.typ != types[i]:
+			return fmt.Errorf("%s conversions need a %s %s, not %s", c.config.ConversionType, types[i], side.name, *side.typ)
+		}
+	}
+	return nil
+}
+
+// resolveNamespace detects the source namespace when none was configured
+func (c *DatabaseConverter) resolveNamespace() error {
+	if len(c.config.Namespace) > 0 {
+		return nil
+	}
+
+	namespace, err := DetectNamespaceAt(c.config.SourceType, c.config.SourcePath)
+	switch {
+	case errors.Is(err, ErrNoNamespace) && c.config.ConversionType != DenamespaceDB:
+		fmt.Printf("No namespace detected, keys will be copied unchanged\n\n")
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to detect namespace: %w", err)
+	}
+
+	c.config.Namespace = namespace
+	fmt.Printf("Detected namespace: %x\n\n", namespace)
+	return nil
+}
+
+// loadCheckpoint sets up checkpointing for this run. When resuming it restores the
+// saved stats and returns the checkpoint to continue from.
+func (c *DatabaseConverter) loadCheckpoint() (*Checkpoint, error) {
+	checkpoint, err := NewCheckpointer(c.config.SourcePath, c.config.DestPath, c.checkpointConfig())
+	if err != nil {
+		return nil, err
+	}
+	c.checkpoint = checkpoint
+
+	if !c.config.Resume {
+		if _, err := os.Stat(checkpoint.Path()); err == nil {
+			fmt.Printf("Ignoring existing checkpoint %s (use --resume to continue from it)\n\n", checkpoint.Path())
+		}
+		return nil, nil
+	}
+
+	saved, err := checkpoint.Load()
+	if err != nil {
+		return nil, fmt.Errorf("cannot resume: %w", err)
+	}
+	if saved == nil {
+		fmt.Printf("No checkpoint found at %s, starting from the beginning\n\n", checkpoint.Path())
+		return nil, nil
+	}
+
+	startTime := c.stats.StartTime
+	if len(saved.Stats) > 0 {
+		if err := json.Unmarshal(saved.Stats, c.stats); err != nil {
+			return nil, fmt.Errorf("failed to restore checkpoint stats: %w", err)
+		}
+	}
+	c.stats.StartTime = startTime
+
+	fmt.Printf("Resuming from checkpoint saved %s\n", saved.UpdatedAt.Format(time.RFC3339))
+	fmt.Printf("  Phase: %s, keys already copied: %d", saved.Phase, c.stats.TotalKeys)
+	done := 0
+	for _, r := range saved.Ranges {
+		if r.Done {
+			done++
+		}
+	}
+	fmt.Printf(", ranges complete: %d/%d\n\n", done, len(saved.Ranges))
+	return saved, nil
+}
+
+// checkpointConfig returns the settings that must match for a checkpoint to be
+// resumed. The worker count is left out: a resumed run reuses the saved ranges.
+func (c *DatabaseConverter) checkpointConfig() interface{} {
+	return struct {
+		SourcePath     string
+		DestPath       string
+		SourceType     DatabaseType
+		DestType       DatabaseType
+		ConversionType ConversionType
+		Namespace      string
+		FixCanonical   bool
+	}{
+		SourcePath:     c.config.SourcePath,
+		DestPath:       c.config.DestPath,
+		SourceType:     c.config.SourceType,
+		DestType:       c.config.DestType,
+		ConversionType: c.config.ConversionType,
+		Namespace:      hex.EncodeToString(c.config.Namespace),
+		FixCanonical:   c.config.FixCanonical,
+	}
+}
+
 func (c *DatabaseConverter) isHeaderKey(key []byte) bool {
 	return len(key) == 41 && key[0] == 'h' && key[9] != 'n'
 }
@@ -345,24 +566,24 @@ func (c *DatabaseConverter) canonicalKey(number uint64) []byte {
 	return key
 }
 
-func (c *DatabaseConverter) updateStats(key []byte) {
+func updateStats(stats *ConversionStats, key []byte) {
 	switch {
 	case len(key) == 41 && key[0] == 'h' && key[9] != 'n':
-		c.stats.Headers++
+		stats.Headers++
 	case len(key) == 10 && key[0] == 'h' && key[9] == 'n':
-		c.stats.Canonical++
+		stats.Canonical++
 	case len(key) == 41 && key[0] == 'b':
-		c.stats.Bodies++
+		stats.Bodies++
 	case len(key) == 41 && key[0] == 'r':
-		c.stats.Receipts++
+		stats.Receipts++
 	case len(key) == 33 && key[0] == 'H':
-		c.stats.HashToNumber++
+		stats.HashToNumber++
 	case len(key) == 33 && key[0] == 'n':
-		c.stats.StateNodes++
+		stats.StateNodes++
 	case len(key) >= 2 && key[0] == 'c' && key[1] == 'o':
-		c.stats.Code++
+		stats.Code++
 	default:
-		c.stats.Other++
+		stats.Other++
 	}
 }
 
@@ -424,4 +645,4 @@ func (c *DatabaseConverter) convertBadgerToPebble() error {
 func (c *DatabaseConverter) addNamespaceToDatabase() error {
 	// TODO: Implement adding namespace
 	return fmt.Errorf("add namespace operation not yet implemented")
-}
\ No newline at end of file
+}
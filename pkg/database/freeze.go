@@ -0,0 +1,199 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+)
+
+// freezeChunk is the number of blocks moved into the freezer per write
+const freezeChunk = 10000
+
+// FreezeStats reports what Freeze moved
+type FreezeStats struct {
+	From   uint64 // first block frozen by this run
+	To     uint64 // last block frozen by this run
+	Blocks uint64
+	Bytes  int64
+}
+
+// AncientPath returns the default freezer directory of a chaindata directory
+func AncientPath(dbPath string) string {
+	return filepath.Join(dbPath, "ancient")
+}
+
+// Freeze moves the canonical headers, bodies and receipts of every block below
+// `below` from kv into the geth freezer at ancientDir, then deletes them and
+// their canonical hash entries from kv, as geth's own freezer does. Hash to
+// number entries and the genesis block stay in kv, so the result reads
+// correctly through rawdb.Open(kv, ...) and accessors such as rawdb.ReadBlock.
+// Blocks that are already frozen are skipped, and key-value copies an
+// interrupted run left of them are deleted, so such a run can simply be
+// repeated. progress, when set, receives a line per frozen chunk.
+func Freeze(kv ethdb.KeyValueStore, ancientDir string, below uint64, progress io.Writer) (FreezeStats, error) {
+	db := rawdb.NewDatabase(kv)
+
+	head, ok := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadBlockHash(db))
+	if !ok {
+		return FreezeStats{}, fmt.Errorf("head block not found, cannot freeze")
+	}
+	if below > head+1 {
+		return FreezeStats{}, fmt.Errorf("cannot freeze below %d, head block is %d", below, head)
+	}
+
+	// The freezer is opened over an empty store so that geth's background
+	// freezer never sees a head block and leaves the tables to us
+	frdb, err := rawdb.Open(memorydb.New(), rawdb.OpenOptions{Ancient: ancientDir})
+	if err != nil {
+		return FreezeStats{}, fmt.Errorf("failed to open freezer: %w", err)
+	}
+	defer frdb.Close()
+
+	frozen, err := frdb.Ancients()
+	if err != nil {
+		return FreezeStats{}, fmt.Errorf("failed to get ancients count: %w", err)
+	}
+	if frozen > 0 {
+		frozenGenesis, err := frdb.Ancient(rawdb.ChainFreezerHashTable, 0)
+		if err != nil {
+			return FreezeStats{}, fmt.Errorf("failed to read frozen genesis: %w", err)
+		}
+		if genesis := rawdb.ReadCanonicalHash(db, 0); common.BytesToHash(frozenGenesis) != genesis {
+			return FreezeStats{}, fmt.Errorf("freezer genesis %x does not match database genesis %s", frozenGenesis, genesis.Hex())
+		}
+	}
+
+	// A run interrupted between syncing the freezer and deleting the
+	// key-value copies leaves blocks in both; finish that move first
+	leftover, err := deleteFrozenLeftovers(kv, db, frdb, frozen)
+	if err != nil {
+		return FreezeStats{}, err
+	}
+	if progress != nil && leftover > 0 {
+		fmt.Fprintf(progress, "Deleted the key-value copies of %d already frozen blocks\n", leftover)
+	}
+
+	stats := FreezeStats{From: frozen}
+	if frozen >= below {
+		if progress != nil {
+			fmt.Fprintf(progress, "Blocks below %d are already frozen\n", below)
+		}
+		return stats, nil
+	}
+
+	start := time.Now()
+	for first := frozen; first < below; first += freezeChunk {
+		last := min(first+freezeChunk, below) - 1
+
+		hashes := make([]common.Hash, 0, last-first+1)
+		size, err := frdb.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+			for number := first; number <= last; number++ {
+				hash, err := appendFrozenBlock(op, db, number)
+				if err != nil {
+					return err
+				}
+				hashes = append(hashes, hash)
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+		if err := frdb.SyncAncient(); err != nil {
+			return stats, fmt.Errorf("failed to flush freezer: %w", err)
+		}
+
+		// Only drop the key-value copies once the freezer is on disk
+		batch := kv.NewBatch()
+		for i, hash := range hashes {
+			number := first + uint64(i)
+			if number == 0 {
+				continue // geth keeps the genesis block in the key-value store
+			}
+			rawdb.DeleteBlockWithoutNumber(batch, hash, number)
+			rawdb.DeleteCanonicalHash(batch, number)
+		}
+		if err := batch.Write(); err != nil {
+			return stats, fmt.Errorf("failed to delete frozen blocks: %w", err)
+		}
+
+		stats.To = last
+		stats.Blocks += uint64(len(hashes))
+		stats.Bytes += size
+		if progress != nil {
+			fmt.Fprintf(progress, "  Frozen blocks %d-%d (%.1f MB, %s)\n", first, last,
+				float64(stats.Bytes)/(1024*1024), time.Since(start).Round(time.Second))
+		}
+	}
+	return stats, nil
+}
+
+// deleteFrozenLeftovers deletes the key-value copies of frozen blocks. Runs
+// delete each chunk once it is frozen, so leftovers are always the newest
+// frozen blocks and the walk down from the freezer's end stops at the first
+// block that is gone from kv.
+func deleteFrozenLeftovers(kv ethdb.KeyValueStore, db ethdb.Reader, frdb ethdb.AncientReader, frozen uint64) (uint64, error) {
+	batch := kv.NewBatch()
+	var deleted uint64
+	for number := frozen - 1; number > 0 && number < frozen; number-- {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			break
+		}
+		frozenHash, err := frdb.Ancient(rawdb.ChainFreezerHashTable, number)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read frozen hash of block %d: %w", number, err)
+		}
+		if common.BytesToHash(frozenHash) != hash {
+			return 0, fmt.Errorf("block %d is frozen as %x but canonical as %s", number, frozenHash, hash.Hex())
+		}
+		rawdb.DeleteBlockWithoutNumber(batch, hash, number)
+		rawdb.DeleteCanonicalHash(batch, number)
+		deleted++
+	}
+	if err := batch.Write(); err != nil {
+		return 0, fmt.Errorf("failed to delete frozen blocks: %w", err)
+	}
+	return deleted, nil
+}
+
+// appendFrozenBlock adds the canonical block at number to the freezer tables
+func appendFrozenBlock(op ethdb.AncientWriteOp, db ethdb.Reader, number uint64) (common.Hash, error) {
+	hash := rawdb.ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return hash, fmt.Errorf("canonical hash missing, can't freeze block %d", number)
+	}
+	header := rawdb.ReadHeaderRLP(db, hash, number)
+	if len(header) == 0 {
+		return hash, fmt.Errorf("block header missing, can't freeze block %d", number)
+	}
+	body := rawdb.ReadBodyRLP(db, hash, number)
+	if len(body) == 0 {
+		return hash, fmt.Errorf("block body missing, can't freeze block %d", number)
+	}
+	receipts := rawdb.ReadReceiptsRLP(db, hash, number)
+	if len(receipts) == 0 {
+		return hash, fmt.Errorf("block receipts missing, can't freeze block %d", number)
+	}
+
+	for _, item := range []struct {
+		table string
+		data  []byte
+	}{
+		{rawdb.ChainFreezerHashTable, hash.Bytes()},
+		{rawdb.ChainFreezerHeaderTable, header},
+		{rawdb.ChainFreezerBodiesTable, body},
+		{rawdb.ChainFreezerReceiptTable, receipts},
+	} {
+		if err := op.AppendRaw(item.table, number, item.data); err != nil {
+			return hash, fmt.Errorf("can't append block %d %s: %w", number, item.table, err)
+		}
+	}
+	return hash, nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/rlp"
+)
+
+// Indexes of the header fields shared by the geth, coreth and Subnet-EVM layouts
+const (
+	HeaderParentField      = 0
+	HeaderRootField        = 3
+	HeaderTxHashField      = 4
+	HeaderReceiptHashField = 5
+	HeaderDifficultyField  = 7
+	HeaderNumberField      = 8
+	HeaderGasLimitField    = 9
+	HeaderGasUsedField     = 10
+	HeaderTimeField        = 11
+)
+
+// HeaderHashField reads one of the hash fields of an encoded header, e.g.
+// HeaderRootField, without decoding the layout-specific fields after them
+func HeaderHashField(header []byte, index int) (common.Hash, error) {
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(header, &fields); err != nil {
+		return common.Hash{}, fmt.Errorf("invalid header: %w", err)
+	}
+	if len(fields) <= index {
+		return common.Hash{}, fmt.Errorf("invalid header: %d fields", len(fields))
+	}
+	var hash common.Hash
+	if err := rlp.DecodeBytes(fields[index], &hash); err != nil {
+		return common.Hash{}, fmt.Errorf("invalid header field %d: %w", index, err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/luxfi/geth/ethdb"
+)
+
+// convertKeyValueStore copies every key from the source to the destination
+// backend with the same range workers and checkpoints as the pebble
+// conversions. When a namespace is configured only the keys under it are
+// copied, with the namespace removed.
+func (c *DatabaseConverter) convertKeyValueStore() error {
+	saved, err := c.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	src, err := OpenKeyValueStore(c.config.SourceType, c.config.SourcePath, BackendOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := OpenKeyValueStore(c.config.DestType, c.config.DestPath, BackendOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to open destination database: %w", err)
+	}
+	defer dst.Close()
+
+	c.ranges = c.planRanges(nil, saved)
+	if ns := c.config.Namespace; len(ns) > 0 {
+		fmt.Printf("Copying keys under namespace %x without the prefix\n", ns)
+		if saved == nil || len(saved.Ranges) == 0 {
+			c.ranges[0].Start = ns
+			c.ranges[len(c.ranges)-1].End = PrefixEnd(ns)
+		}
+	}
+	fmt.Printf("Copying %d key ranges in parallel...\n", len(c.ranges))
+	if err := c.copyRanges(keyValueCopier(src, dst)); err != nil {
+		return err
+	}
+
+	if err := c.checkpoint.Clear(); err != nil {
+		log.Printf("Failed to remove checkpoint %s: %v", c.checkpoint.Path(), err)
+	}
+	fmt.Printf("\n✅ Successfully converted %d entries from %s to %s!\n",
+		c.stats.TotalKeys, c.config.SourceType, c.config.DestType)
+	c.printFinalStats()
+	return nil
+}
+
+// keyValueCopier copies between ethdb key-value stores
+func keyValueCopier(src ethdb.Iteratee, dst ethdb.Batcher) rangeCopier {
+	return rangeCopier{
+		iterate: func(r *RangeProgress) (rangeIterator, error) {
+			return &kvIterator{db: src, start: r.Start, end: r.End}, nil
+		},
+		newBatch: func() rangeBatch { return kvBatch{dst.NewBatch()} },
+	}
+}
+
+// kvIterator walks one key range of an ethdb store like a bounded pebble iterator
+type kvIterator struct {
+	db    ethdb.Iteratee
+	start []byte
+	end   []byte
+	it    ethdb.Iterator
+}
+
+func (i *kvIterator) seek(key []byte) bool {
+	if i.it != nil {
+		i.it.Release()
+	}
+	i.it = i.db.NewIterator(nil, key)
+	return i.Next()
+}
+
+func (i *kvIterator) First() bool            { return i.seek(i.start) }
+func (i *kvIterator) SeekGE(key []byte) bool { return i.seek(key) }
+func (i *kvIterator) Key() []byte            { return i.it.Key() }
+func (i *kvIterator) Value() []byte          { return i.it.Value() }
+func (i *kvIterator) Error() error           { return i.it.Error() }
+
+func (i *kvIterator) Next() bool {
+	return i.it.Next() && (i.end == nil || bytes.Compare(i.it.Key(), i.end) < 0)
+}
+
+func (i *kvIterator) Close() error {
+	if i.it != nil {
+		i.it.Release()
+	}
+	return nil
+}
+
+// kvBatch gives an ethdb batch the methods of a badger write batch
+type kvBatch struct {
+	ethdb.Batch
+}
+
+func (b kvBatch) Set(key, value []byte) error { return b.Put(key, value) }
+func (b kvBatch) Flush() error                { return b.Write() }
+func (b kvBatch) Cancel()                     { b.Reset() }
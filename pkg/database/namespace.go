@@ -0,0 +1,199 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// NamespaceLength is the size of the chain ID prefix SubnetEVM puts in front of every key
+const NamespaceLength = 32
+
+const (
+	// keysPerSeek is how many keys are read after each seek point
+	keysPerSeek = 64
+	// maxSeeksPerByte bounds how many prefixes are skipped within one first byte
+	maxSeeksPerByte = 16
+	// minNamespaceSamples filters out prefixes shared by only a few hash-keyed entries
+	minNamespaceSamples = 8
+	// canonicalScanLimit bounds the search for a canonical entry under a candidate
+	canonicalScanLimit = 100000
+)
+
+// ErrNoNamespace is returned when no namespace could be confirmed in a database
+var ErrNoNamespace = errors.New("no namespace detected")
+
+// NamespaceCandidate is a key prefix that appears often enough to be a namespace
+type NamespaceCandidate struct {
+	Prefix []byte
+	// Samples is how many of the sampled keys start with the prefix
+	Samples int
+	// Confirmed is set once a canonical hash entry was decoded under the prefix
+	Confirmed      bool
+	CanonicalBlock uint64
+	CanonicalHash  common.Hash
+}
+
+// DetectNamespaces samples keys across the whole keyspace and returns the
+// 32-byte prefixes they share, most frequent first. Each candidate is checked
+// for an `h`+num+`n` canonical entry, which only a real chain namespace has.
+func DetectNamespaces(db ethdb.Iteratee) ([]NamespaceCandidate, error) {
+	counts := make(map[string]int)
+	total := 0
+	for b := 0; b < 256; b++ {
+		start := []byte{byte(b)}
+		for seeks := 0; start != nil && seeks < maxSeeksPerByte; seeks++ {
+			var err error
+			if start, err = sampleKeys(db, start, counts, &total); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Hash-keyed tables rarely repeat a 32-byte prefix; the ones that do are
+	// weeded out by the canonical check below.
+	threshold := minNamespaceSamples
+	if total < threshold {
+		threshold = 1
+	}
+
+	var candidates []NamespaceCandidate
+	for prefix, count := range counts {
+		if count < threshold {
+			continue
+		}
+		candidate := NamespaceCandidate{Prefix: []byte(prefix), Samples: count}
+		if err := confirmNamespace(db, &candidate); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Samples != candidates[j].Samples {
+			return candidates[i].Samples > candidates[j].Samples
+		}
+		return bytes.Compare(candidates[i].Prefix, candidates[j].Prefix) < 0
+	})
+	return candidates, nil
+}
+
+// sampleKeys reads up to keysPerSeek keys from start that share its first
+// byte and counts their 32-byte prefixes. When a prefix repeats often enough
+// to be a namespace, it returns the key after that prefix so the next seek
+// reaches the chains sorted behind a large one; otherwise it returns nil.
+func sampleKeys(db ethdb.Iteratee, start []byte, counts map[string]int, total *int) ([]byte, error) {
+	iter := db.NewIterator(nil, start)
+	defer iter.Release()
+
+	var skip []byte
+	local := make(map[string]int)
+	for n := 0; n < keysPerSeek && iter.Next(); n++ {
+		key := iter.Key()
+		if key[0] != start[0] {
+			break
+		}
+		*total++
+		if len(key) <= NamespaceLength {
+			continue
+		}
+		prefix := string(key[:NamespaceLength])
+		counts[prefix]++
+		local[prefix]++
+		if local[prefix] == minNamespaceSamples {
+			skip = []byte(prefix)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if skip == nil {
+		return nil, nil
+	}
+	next := PrefixEnd(skip)
+	if next == nil || next[0] != start[0] {
+		return nil, nil
+	}
+	return next, nil
+}
+
+// confirmNamespace scans the header table under the candidate prefix for the
+// first canonical number-to-hash entry.
+func confirmNamespace(db ethdb.Iteratee, candidate *NamespaceCandidate) error {
+	prefix := append(bytes.Clone(candidate.Prefix), 'h')
+	iter := db.NewIterator(prefix, nil)
+	defer iter.Release()
+
+	for n := 0; n < canonicalScanLimit && iter.Next(); n++ {
+		key := iter.Key()[len(candidate.Prefix):]
+		if len(key) != 10 || key[9] != 'n' || len(iter.Value()) != common.HashLength {
+			continue
+		}
+		candidate.Confirmed = true
+		candidate.CanonicalBlock = binary.BigEndian.Uint64(key[1:9])
+		candidate.CanonicalHash = common.BytesToHash(iter.Value())
+		return nil
+	}
+	return iter.Error()
+}
+
+// IsNamespace reports whether a canonical entry is stored under prefix, as it
+// is under every chain namespace
+func IsNamespace(db ethdb.Iteratee, prefix []byte) (bool, error) {
+	candidate := NamespaceCandidate{Prefix: prefix}
+	if err := confirmNamespace(db, &candidate); err != nil {
+		return false, err
+	}
+	return candidate.Confirmed, nil
+}
+
+// DetectNamespace returns the single confirmed namespace of a database. It fails
+// with ErrNoNamespace when none is found and when several chains share the store.
+func DetectNamespace(db ethdb.Iteratee) ([]byte, error) {
+	candidates, err := DetectNamespaces(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var confirmed [][]byte
+	for _, c := range candidates {
+		if c.Confirmed {
+			confirmed = append(confirmed, c.Prefix)
+		}
+	}
+	switch len(confirmed) {
+	case 0:
+		return nil, ErrNoNamespace
+	case 1:
+		return confirmed[0], nil
+	default:
+		return nil, fmt.Errorf("found %d namespaces (%x), specify one explicitly", len(confirmed), confirmed)
+	}
+}
+
+// DetectNamespaceAt opens the database at path read-only and detects its namespace
+func DetectNamespaceAt(dbType DatabaseType, path string) ([]byte, error) {
+	kv, err := OpenKeyValueStore(dbType, path, BackendOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer kv.Close()
+	return DetectNamespace(kv)
+}
+
+// PrefixEnd returns the first key after every key with the prefix, or nil
+// when there is none
+func PrefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// splitKeyspace divides the source keyspace into at most n contiguous ranges.
+// Boundaries are taken from the SST files on disk so each range holds roughly
+// the same amount of data. Databases with too few tables to split that way,
+// and sources other than pebble, passed as a nil db, are cut on the first key
+// byte after the namespace instead.
+func splitKeyspace(db *pebble.DB, n int, namespace []byte) []RangeProgress {
+	if n <= 1 {
+		return []RangeProgress{{}}
+	}
+
+	var bounds [][]byte
+	if db != nil {
+		bounds = tableBounds(db, n)
+	}
+	if len(bounds) == 0 {
+		for i := 1; i < n && i < 256; i++ {
+			bound := append(bytes.Clone(namespace), byte(i*256/n))
+			bounds = appendBound(bounds, bound)
+		}
+	}
+
+	ranges := make([]RangeProgress, 0, len(bounds)+1)
+	var start []byte
+	for _, bound := range bounds {
+		ranges = append(ranges, RangeProgress{Start: start, End: bound})
+		start = bound
+	}
+	return append(ranges, RangeProgress{Start: start})
+}
+
+// tableBounds picks n-1 range boundaries from the smallest keys of the SST
+// files, or none when there are too few files
+func tableBounds(db *pebble.DB, n int) [][]byte {
+	levels, err := db.SSTables()
+	if err != nil {
+		return nil
+	}
+	type table struct {
+		smallest []byte
+		size     uint64
+	}
+	var (
+		tables []table
+		total  uint64
+	)
+	for _, level := range levels {
+		for _, t := range level {
+			tables = append(tables, table{smallest: t.Smallest.UserKey, size: t.Size})
+			total += t.Size
+		}
+	}
+	if len(tables) < 2*n {
+		return nil
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		return bytes.Compare(tables[i].smallest, tables[j].smallest) < 0
+	})
+	var (
+		bounds [][]byte
+		seen   uint64
+		next   = 1
+	)
+	for _, t := range tables {
+		if next >= n {
+			break
+		}
+		if seen >= total*uint64(next)/uint64(n) {
+			bounds = appendBound(bounds, t.smallest)
+			next++
+		}
+		seen += t.size
+	}
+	return bounds
+}
+
+// appendBound adds a boundary only if it is strictly greater than the previous
+// one, so no range ends up empty or inverted.
+func appendBound(bounds [][]byte, bound []byte) [][]byte {
+	if len(bound) == 0 {
+		return bounds
+	}
+	if len(bounds) > 0 && bytes.Compare(bound, bounds[len(bounds)-1]) <= 0 {
+		return bounds
+	}
+	return append(bounds, bytes.Clone(bound))
+}
+
+// planRanges returns the key ranges to copy, reusing the ones from a saved
+// checkpoint so a resumed run continues each range where it stopped.
+func (c *DatabaseConverter) planRanges(pdb *pebble.DB, saved *Checkpoint) []RangeProgress {
+	if saved != nil && len(saved.Ranges) > 0 {
+		return saved.Ranges
+	}
+	return splitKeyspace(pdb, c.config.Workers, c.config.Namespace)
+}
+
+// runRanges calls fn for every range on its own goroutine and waits for all of
+// them. Once one worker fails the others stop at their next key.
+func (c *DatabaseConverter) runRanges(ranges []RangeProgress, fn func(r *RangeProgress) error) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(ranges))
+	)
+	c.failed.Store(false)
+	for i := range ranges {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(&ranges[i]); err != nil {
+				errs[i] = err
+				c.failed.Store(true)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// rangeIterator is the part of a pebble iterator the copy workers use
+type rangeIterator interface {
+	First() bool
+	SeekGE(key []byte) bool
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Close() error
+}
+
+// rangeBatch is the part of a badger write batch the copy workers use
+type rangeBatch interface {
+	Set(key, value []byte) error
+	Flush() error
+	Cancel()
+}
+
+// rangeCopier opens the source iterator and destination batches of the copy
+// workers
+type rangeCopier struct {
+	iterate  func(r *RangeProgress) (rangeIterator, error)
+	newBatch func() rangeBatch
+}
+
+// pebbleToBadger copies from a pebble source into a badger destination
+func pebbleToBadger(pdb *pebble.DB, bdb *badger.DB) rangeCopier {
+	return rangeCopier{
+		iterate: func(r *RangeProgress) (rangeIterator, error) {
+			return pdb.NewIter(&pebble.IterOptions{LowerBound: r.Start, UpperBound: r.End})
+		},
+		newBatch: func() rangeBatch { return bdb.NewWriteBatch() },
+	}
+}
+
+// copyRanges copies every planned range into the destination. When a worker
+// fails the progress committed by all of them is saved before returning.
+func (c *DatabaseConverter) copyRanges(copier rangeCopier) error {
+	err := c.runRanges(c.ranges, func(r *RangeProgress) error {
+		return c.copyRange(copier, r)
+	})
+	if err == nil {
+		return nil
+	}
+	if saveErr := c.checkpoint.SaveRanges("copy", c.ranges, c.stats); saveErr != nil {
+		log.Printf("Failed to save checkpoint: %v", saveErr)
+	}
+	return err
+}
+
+// stripNamespace removes the configured namespace prefix from a key
+func (c *DatabaseConverter) stripNamespace(key []byte) []byte {
+	ns := c.config.Namespace
+	if len(ns) > 0 && len(key) > len(ns) && bytes.Equal(key[:len(ns)], ns) {
+		return key[len(ns):]
+	}
+	return key
+}
+
+// scanBlocks finds every header in the source and records its hash by number
+func (c *DatabaseConverter) scanBlocks(pdb *pebble.DB, ranges []RangeProgress) (map[uint64]common.Hash, error) {
+	var (
+		mu       sync.Mutex
+		blockMap = make(map[uint64]common.Hash)
+	)
+	err := c.runRanges(ranges, func(r *RangeProgress) error {
+		iter, err := pdb.NewIter(&pebble.IterOptions{LowerBound: r.Start, UpperBound: r.End})
+		if err != nil {
+			return err
+		}
+		defer iter.Close()
+
+		local := make(map[uint64]common.Hash)
+		for iter.First(); iter.Valid(); iter.Next() {
+			if c.failed.Load() {
+				return nil
+			}
+			key := c.stripNamespace(iter.Key())
+			if c.isHeaderKey(key) {
+				blockNum, hash := c.parseHeaderKey(key)
+				if blockNum > 0 {
+					local[blockNum] = hash
+				}
+			}
+		}
+		if err := iter.Error(); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for blockNum, hash := range local {
+			blockMap[blockNum] = hash
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for blockNum, hash := range blockMap {
+		if blockNum > c.stats.LastBlockNum {
+			c.stats.LastBlockNum = blockNum
+			c.stats.LastBlockHash = hash
+		}
+	}
+	return blockMap, nil
+}
+
+// copyRange copies one key range into the destination through its own write
+// batch. Counts are kept locally and folded into the shared stats whenever a
+// batch is committed.
+func (c *DatabaseConverter) copyRange(copier rangeCopier, r *RangeProgress) error {
+	if r.Done {
+		return nil
+	}
+
+	iter, err := copier.iterate(r)
+	if err != nil {
+		return fmt.Errorf("failed to create iterator: %w", err)
+	}
+	defer iter.Close()
+
+	valid := iter.First()
+	if len(r.LastKey) > 0 {
+		// Skip everything up to and including the last committed key
+		valid = iter.SeekGE(r.LastKey)
+		if valid && bytes.Equal(iter.Key(), r.LastKey) {
+			valid = iter.Next()
+		}
+	}
+
+	var (
+		local      ConversionStats
+		batch      = copier.newBatch()
+		batchCount = 0
+		lastKey    []byte
+	)
+	for ; valid; valid = iter.Next() {
+		if c.failed.Load() {
+			batch.Cancel()
+			return nil
+		}
+		origKey := iter.Key()
+		key := bytes.Clone(c.stripNamespace(origKey))
+
+		if err := batch.Set(key, bytes.Clone(iter.Value())); err != nil {
+			batch.Cancel()
+			return fmt.Errorf("failed to set key: %w", err)
+		}
+
+		updateStats(&local, key)
+		local.TotalKeys++
+		batchCount++
+		lastKey = append(lastKey[:0], origKey...)
+
+		// Flush batch periodically
+		if batchCount >= c.config.BatchSize {
+			if err := batch.Flush(); err != nil {
+				return fmt.Errorf("failed to flush batch: %w", err)
+			}
+			if err := c.commitRange(r, lastKey, &local, false); err != nil {
+				return err
+			}
+			batch = copier.newBatch()
+			batchCount = 0
+		}
+	}
+	if err := iter.Error(); err != nil {
+		batch.Cancel()
+		return fmt.Errorf("failed to iterate source: %w", err)
+	}
+
+	// Flush final batch
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("failed to flush final batch: %w", err)
+	}
+	return c.commitRange(r, lastKey, &local, true)
+}
+
+// commitRange records a flushed batch: it merges the worker's counts into the
+// shared stats, advances the range and saves the checkpoint. With a
+// CheckpointInterval set, a batch that does not complete its range only saves
+// once that interval has passed since the last save.
+func (c *DatabaseConverter) commitRange(r *RangeProgress, lastKey []byte, local *ConversionStats, done bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.add(local)
+	*local = ConversionStats{}
+	if lastKey != nil {
+		r.LastKey = bytes.Clone(lastKey)
+	}
+	r.Done = done
+
+	if c.config.Verbose && c.stats.TotalKeys/100000 > c.reported {
+		c.reported = c.stats.TotalKeys / 100000
+		c.printProgress()
+	}
+
+	if !done && time.Since(c.savedAt) < c.config.CheckpointInterval {
+		return nil
+	}
+	c.savedAt = time.Now()
+	if err := c.checkpoint.SaveRanges("copy", c.ranges, c.stats); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// add accumulates the key counters of other into s
+func (s *ConversionStats) add(other *ConversionStats) {
+	s.TotalKeys += other.TotalKeys
+	s.Headers += other.Headers
+	s.Bodies += other.Bodies
+	s.Receipts += other.Receipts
+	s.Canonical += other.Canonical
+	s.HashToNumber += other.HashToNumber
+	s.StateNodes += other.StateNodes
+	s.Code += other.Code
+	s.Other += other.Other
+}
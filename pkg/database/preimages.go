@@ -0,0 +1,324 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+)
+
+// PreimageConfig controls BuildPreimages
+type PreimageConfig struct {
+	// Root is the state whose account addresses are recovered
+	Root common.Hash
+	// To is the last canonical block scanned; 0 means the head block
+	To uint64
+	// Addresses are extra candidates, e.g. the alloc of a genesis file
+	Addresses []common.Address
+	// Progress receives periodic status lines when set
+	Progress io.Writer
+}
+
+// PreimageStats reports what BuildPreimages found
+type PreimageStats struct {
+	Accounts uint64
+	// Known accounts already had a preimage
+	Known uint64
+	// Recovered accounts had a preimage written
+	Recovered uint64
+	Blocks    uint64
+	// Missing counts the heights without a canonical hash, such as those
+	// below the first block of a block-range copy
+	Missing      uint64
+	Transactions uint64
+	Logs         uint64
+	// Candidates counts every address checked, including repeats
+	Candidates uint64
+}
+
+// Resolved returns the percentage of accounts whose address is now known
+func (s PreimageStats) Resolved() float64 {
+	if s.Accounts == 0 {
+		return 100
+	}
+	return 100 * float64(s.Known+s.Recovered) / float64(s.Accounts)
+}
+
+// preimageBuilder matches candidate addresses against the accounts of a state
+type preimageBuilder struct {
+	db       ethdb.KeyValueStore
+	batch    ethdb.Batch
+	hashes   []common.Hash
+	resolved []bool
+	stats    PreimageStats
+}
+
+// BuildPreimages recovers the addresses of the accounts in the state at
+// config.Root and writes them as "secure-key-" preimages, so that dumps of the
+// secure trie can show addresses. Candidates are the genesis alloc, the
+// sender, recipient and created contract of every canonical transaction, and
+// the emitter of every log together with the topics and aligned data words
+// that hold an address. Only candidates that are accounts of the state are
+// written.
+//
+// Heights without a canonical block are skipped and counted. The preimages
+// found before an error or cancellation are still written.
+//
+// Every account hash of the state is held in memory, 33 bytes per account.
+// Contracts created by other contracts are only found when they emitted a
+// log or were passed in one.
+func BuildPreimages(ctx context.Context, db ethdb.KeyValueStore, config PreimageConfig) (*PreimageStats, error) {
+	hashes, err := state.AccountHashes(ctx, db, config.Root)
+	if err != nil {
+		return nil, err
+	}
+	b := &preimageBuilder{
+		db:       db,
+		batch:    db.NewBatch(),
+		hashes:   hashes,
+		resolved: make([]bool, len(hashes)),
+	}
+	b.stats.Accounts = uint64(len(hashes))
+	for i, hash := range hashes {
+		if ok, _ := db.Has(preimageKey(hash)); ok {
+			b.resolved[i] = true
+			b.stats.Known++
+		}
+	}
+	if config.Progress != nil {
+		fmt.Fprintf(config.Progress, "  State has %d accounts, %d with a preimage\n", b.stats.Accounts, b.stats.Known)
+	}
+
+	err = b.scan(ctx, config)
+	if writeErr := b.batch.Write(); writeErr != nil && err == nil {
+		err = fmt.Errorf("failed to write batch: %w", writeErr)
+	}
+	return &b.stats, err
+}
+
+// scan checks the extra addresses, the stored genesis and every canonical
+// block up to config.To
+func (b *preimageBuilder) scan(ctx context.Context, config PreimageConfig) error {
+	to := config.To
+	if to == 0 {
+		var err error
+		if to, err = headBlockNumber(b.db); err != nil {
+			return err
+		}
+	}
+
+	for _, address := range config.Addresses {
+		if err := b.check(address); err != nil {
+			return err
+		}
+	}
+	if err := b.checkGenesis(); err != nil {
+		return err
+	}
+	for number := uint64(0); number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := b.checkBlock(number); err != nil {
+			return err
+		}
+		if config.Progress != nil && number%100000 == 0 {
+			fmt.Fprintf(config.Progress, "  Scanned block %d, %d preimages recovered\n", number, b.stats.Recovered)
+		}
+		if number == to {
+			break // avoid wrapping around at the maximum block number
+		}
+	}
+	return nil
+}
+
+// check writes the preimage of address when it is an account without one
+func (b *preimageBuilder) check(address common.Address) error {
+	b.stats.Candidates++
+	hash := crypto.Keccak256Hash(address.Bytes())
+	i, found := slices.BinarySearchFunc(b.hashes, hash, func(x, y common.Hash) int {
+		return bytes.Compare(x[:], y[:])
+	})
+	if !found || b.resolved[i] {
+		return nil
+	}
+	b.resolved[i] = true
+	b.stats.Recovered++
+	if err := b.batch.Put(preimageKey(hash), address.Bytes()); err != nil {
+		return err
+	}
+	if b.batch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	if err := b.batch.Write(); err != nil {
+		return fmt.Errorf("failed to write batch: %w", err)
+	}
+	b.batch.Reset()
+	return nil
+}
+
+// checkWord checks a 32-byte word that holds a left-padded address
+func (b *preimageBuilder) checkWord(word []byte) error {
+	if !bytes.Equal(word[:12], make([]byte, 12)) || bytes.Equal(word[12:], make([]byte, common.AddressLength)) {
+		return nil
+	}
+	return b.check(common.BytesToAddress(word[12:]))
+}
+
+// checkGenesis checks the alloc of the genesis stored with the chain, if any
+func (b *preimageBuilder) checkGenesis() error {
+	genesis, err := b.db.Get(canonicalHashKey(0))
+	if err != nil || len(genesis) != common.HashLength {
+		return nil
+	}
+	data, err := b.db.Get(append([]byte("ethereum-genesis-"), genesis...))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	addresses, err := GenesisAllocAddresses(data)
+	if err != nil {
+		return fmt.Errorf("stored genesis: %w", err)
+	}
+	for _, address := range addresses {
+		if err := b.check(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBlock checks the transactions and logs of a canonical block. Blocks
+// whose body or receipts are missing are checked with what is there.
+func (b *preimageBuilder) checkBlock(number uint64) error {
+	value, err := b.db.Get(canonicalHashKey(number))
+	if err != nil || len(value) != common.HashLength {
+		b.stats.Missing++
+		return nil
+	}
+	blockKey := append(binary.BigEndian.AppendUint64(nil, number), value...)
+	b.stats.Blocks++
+
+	if body, err := b.db.Get(append([]byte("b"), blockKey...)); err == nil && len(body) > 0 {
+		txs, err := bodyTransactions(body)
+		if err != nil {
+			return fmt.Errorf("block #%d: %w", number, err)
+		}
+		for _, tx := range txs {
+			if err := b.checkTransaction(tx); err != nil {
+				return err
+			}
+		}
+	}
+
+	if data, err := b.db.Get(append([]byte("r"), blockKey...)); err == nil && len(data) > 0 {
+		receipts, _, err := DecodeStoredReceipts(data)
+		if err != nil {
+			return fmt.Errorf("block #%d: %w", number, err)
+		}
+		for _, receipt := range receipts {
+			for _, log := range receipt.Logs {
+				if err := b.checkLog(log); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkTransaction checks the sender, recipient and created contract of tx.
+// A sender that cannot be recovered is skipped.
+func (b *preimageBuilder) checkTransaction(tx *types.Transaction) error {
+	b.stats.Transactions++
+	if to := tx.To(); to != nil {
+		if err := b.check(*to); err != nil {
+			return err
+		}
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil
+	}
+	if err := b.check(from); err != nil {
+		return err
+	}
+	if tx.To() == nil {
+		return b.check(crypto.CreateAddress(from, tx.Nonce()))
+	}
+	return nil
+}
+
+// checkLog checks the emitter of a log and the addresses passed in it
+func (b *preimageBuilder) checkLog(log *types.Log) error {
+	b.stats.Logs++
+	if err := b.check(log.Address); err != nil {
+		return err
+	}
+	for _, topic := range log.Topics {
+		if err := b.checkWord(topic[:]); err != nil {
+			return err
+		}
+	}
+	for i := 0; i+common.HashLength <= len(log.Data); i += common.HashLength {
+		if err := b.checkWord(log.Data[i : i+common.HashLength]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenesisAllocAddresses returns the addresses of a genesis alloc, given
+// either a whole genesis file or the alloc alone as stored with a chain
+func GenesisAllocAddresses(data []byte) ([]common.Address, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %w", err)
+	}
+	if alloc, ok := fields["alloc"]; ok {
+		fields = nil
+		if err := json.Unmarshal(alloc, &fields); err != nil {
+			return nil, fmt.Errorf("invalid genesis alloc: %w", err)
+		}
+	}
+	addresses := make([]common.Address, 0, len(fields))
+	for key := range fields {
+		if !common.IsHexAddress(key) {
+			return nil, fmt.Errorf("invalid genesis alloc address %q", key)
+		}
+		addresses = append(addresses, common.HexToAddress(key))
+	}
+	return addresses, nil
+}
+
+// bodyTransactions decodes the transactions of a block body. Only the leading
+// transaction list is read, so the extra fields of coreth bodies are ignored.
+func bodyTransactions(body []byte) (types.Transactions, error) {
+	fields, _, err := rlp.SplitList(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	_, _, rest, err := rlp.Split(fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body transactions: %w", err)
+	}
+	var txs types.Transactions
+	if err := rlp.DecodeBytes(fields[:len(fields)-len(rest)], &txs); err != nil {
+		return nil, fmt.Errorf("invalid body transactions: %w", err)
+	}
+	return txs, nil
+}
+
+// preimageKey = "secure-key-" + hash
+func preimageKey(hash common.Hash) []byte {
+	return append([]byte("secure-key-"), hash.Bytes()...)
+}
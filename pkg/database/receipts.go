@@ -0,0 +1,288 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/trie"
+)
+
+// Stored receipt layouts, named by the database version that introduced them.
+// Subnet-EVM inherited the older ones from geth; coreth and geth now store
+// only the status, cumulative gas and logs.
+const (
+	ReceiptSchemaV3     = "v3"     // status, cumulative gas, bloom, tx hash, contract address, logs, gas used
+	ReceiptSchemaV4     = "v4"     // status, cumulative gas, tx hash, contract address, logs, gas used
+	ReceiptSchemaStored = "stored" // status, cumulative gas, logs
+)
+
+// maxReceiptFailures caps the failures kept in a ReceiptStats
+const maxReceiptFailures = 100
+
+// ReceiptFailure is a block whose stored receipts could not be converted
+type ReceiptFailure struct {
+	Number uint64
+	Hash   common.Hash
+	Reason string
+}
+
+func (f ReceiptFailure) String() string {
+	return fmt.Sprintf("#%d %s: %s", f.Number, f.Hash.Hex(), f.Reason)
+}
+
+// ReceiptStats reports what ConvertReceipts did
+type ReceiptStats struct {
+	Blocks uint64
+	// Schemas counts the receipt lists found in each source layout
+	Schemas map[string]uint64
+	// Reencoded counts the receipt lists whose bytes changed
+	Reencoded uint64
+	// Invalid counts the receipt lists that failed validation. The first
+	// maxReceiptFailures of them are listed in Failures.
+	Invalid uint64
+	// Dropped counts the invalid receipt lists that were deleted
+	Dropped  uint64
+	Failures []ReceiptFailure
+}
+
+// ConvertReceipts validates and re-encodes every r+num+hash receipt list in
+// kv. Each list is decoded in whichever stored layout it was written with, its
+// receipt root is derived again, using the transaction types from the block
+// body, and compared against the ReceiptHash of the block's header. Lists that
+// match are rewritten in the coreth/geth storage layout. Lists that do not, or
+// whose header or body is missing, are reported and left as they are, unless
+// dropInvalid is set, in which case they are deleted.
+func ConvertReceipts(kv ethdb.KeyValueStore, batchSize int, dropInvalid bool) (*ReceiptStats, error) {
+	stats := &ReceiptStats{Schemas: make(map[string]uint64)}
+
+	it := kv.NewIterator([]byte("r"), nil)
+	defer it.Release()
+
+	batch := kv.NewBatch()
+	pending := 0
+	for it.Next() {
+		key := it.Key()
+		if len(key) != 1+8+common.HashLength {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[1:9])
+		hash := common.BytesToHash(key[9:])
+		stats.Blocks++
+
+		enc, schema, err := convertReceiptList(kv, number, hash, it.Value())
+		switch {
+		case err != nil:
+			stats.Invalid++
+			if len(stats.Failures) < maxReceiptFailures {
+				stats.Failures = append(stats.Failures, ReceiptFailure{Number: number, Hash: hash, Reason: err.Error()})
+			}
+			if !dropInvalid {
+				continue
+			}
+			stats.Dropped++
+			err = batch.Delete(bytes.Clone(key))
+		case !bytes.Equal(enc, it.Value()):
+			stats.Schemas[schema]++
+			stats.Reencoded++
+			err = batch.Put(bytes.Clone(key), enc)
+		default:
+			stats.Schemas[schema]++
+			continue
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to write receipts of block %d: %w", number, err)
+		}
+
+		if pending++; pending >= batchSize {
+			if err := batch.Write(); err != nil {
+				return stats, fmt.Errorf("failed to flush receipts batch: %w", err)
+			}
+			batch.Reset()
+			pending = 0
+		}
+	}
+	if err := it.Error(); err != nil {
+		return stats, fmt.Errorf("failed to iterate receipts: %w", err)
+	}
+	if err := batch.Write(); err != nil {
+		return stats, fmt.Errorf("failed to flush final receipts batch: %w", err)
+	}
+	return stats, nil
+}
+
+// convertReceiptList decodes a stored receipt list, checks it against the
+// header's receipt root and returns it in the storage layout of coreth and geth
+func convertReceiptList(db ethdb.KeyValueReader, number uint64, hash common.Hash, data []byte) ([]byte, string, error) {
+	blockKey := append(binary.BigEndian.AppendUint64(nil, number), hash.Bytes()...)
+	header, _ := db.Get(append([]byte("h"), blockKey...))
+	if len(header) == 0 {
+		return nil, "", errors.New("header is missing")
+	}
+	root, err := HeaderHashField(header, HeaderReceiptHashField)
+	if err != nil {
+		return nil, "", err
+	}
+	body, _ := db.Get(append([]byte("b"), blockKey...))
+	if len(body) == 0 {
+		return nil, "", errors.New("body is missing")
+	}
+	txTypes, err := bodyTxTypes(body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	receipts, schema, err := DecodeStoredReceipts(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(receipts) != len(txTypes) {
+		return nil, schema, fmt.Errorf("%d receipts for %d transactions", len(receipts), len(txTypes))
+	}
+	for i, r := range receipts {
+		r.Type = txTypes[i]
+		r.Bloom = types.CreateBloom(r)
+	}
+	if derived := types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil)); derived != root {
+		return nil, schema, fmt.Errorf("receipt root %s does not match header %s", derived.Hex(), root.Hex())
+	}
+
+	stored := make([]*types.ReceiptForStorage, len(receipts))
+	for i, r := range receipts {
+		stored[i] = (*types.ReceiptForStorage)(r)
+	}
+	enc, err := rlp.EncodeToBytes(stored)
+	if err != nil {
+		return nil, schema, fmt.Errorf("failed to encode receipts: %w", err)
+	}
+	return enc, schema, nil
+}
+
+// bodyTxTypes returns the type of every transaction in a block body. Only the
+// leading transaction list is read, so the extra fields of coreth bodies are
+// ignored.
+func bodyTxTypes(body []byte) ([]uint8, error) {
+	fields, _, err := rlp.SplitList(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	txs, _, err := rlp.SplitList(fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body transactions: %w", err)
+	}
+	var txTypes []uint8
+	for len(txs) > 0 {
+		kind, content, rest, err := rlp.Split(txs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body transaction: %w", err)
+		}
+		switch {
+		case kind == rlp.List:
+			txTypes = append(txTypes, types.LegacyTxType)
+		case len(content) > 0:
+			txTypes = append(txTypes, content[0])
+		default:
+			return nil, errors.New("empty typed transaction in body")
+		}
+		txs = rest
+	}
+	return txTypes, nil
+}
+
+// DecodeStoredReceipts decodes a receipt list in any of the stored layouts and
+// returns the name of the layout. Every receipt of a list must use the same one.
+func DecodeStoredReceipts(data []byte) ([]*types.Receipt, string, error) {
+	var list []rlp.RawValue
+	if err := rlp.DecodeBytes(data, &list); err != nil {
+		return nil, "", fmt.Errorf("invalid receipt list: %w", err)
+	}
+	schema := ReceiptSchemaStored
+	receipts := make([]*types.Receipt, len(list))
+	for i, item := range list {
+		var fields []rlp.RawValue
+		if err := rlp.DecodeBytes(item, &fields); err != nil {
+			return nil, "", fmt.Errorf("invalid receipt %d: %w", i, err)
+		}
+
+		var (
+			s      string
+			status []byte
+			logs   rlp.RawValue
+			r      = new(types.Receipt)
+			err    error
+		)
+		switch len(fields) {
+		case 3:
+			s, logs = ReceiptSchemaStored, fields[2]
+		case 6:
+			s, logs = ReceiptSchemaV4, fields[4]
+		case 7:
+			s, logs = ReceiptSchemaV3, fields[5]
+		default:
+			return nil, "", fmt.Errorf("receipt %d has %d fields, not a known layout", i, len(fields))
+		}
+		if i > 0 && s != schema {
+			return nil, "", fmt.Errorf("receipt %d is %s, earlier receipts are %s", i, s, schema)
+		}
+		schema = s
+
+		if err = rlp.DecodeBytes(fields[0], &status); err == nil {
+			err = rlp.DecodeBytes(fields[1], &r.CumulativeGasUsed)
+		}
+		if err == nil {
+			r.Logs, err = decodeStoredLogs(logs)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid receipt %d: %w", i, err)
+		}
+		switch {
+		case len(status) == common.HashLength:
+			r.PostState = status
+		case bytes.Equal(status, []byte{0x01}):
+			r.Status = types.ReceiptStatusSuccessful
+		case len(status) == 0:
+			r.Status = types.ReceiptStatusFailed
+		default:
+			return nil, "", fmt.Errorf("invalid receipt %d status %x", i, status)
+		}
+		receipts[i] = r
+	}
+	return receipts, schema, nil
+}
+
+// decodeStoredLogs decodes a log list. Older layouts stored the block and
+// transaction context after the address, topics and data; it is dropped.
+func decodeStoredLogs(data []byte) ([]*types.Log, error) {
+	var list []rlp.RawValue
+	if err := rlp.DecodeBytes(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid logs: %w", err)
+	}
+	logs := make([]*types.Log, len(list))
+	for i, item := range list {
+		var fields []rlp.RawValue
+		if err := rlp.DecodeBytes(item, &fields); err != nil {
+			return nil, fmt.Errorf("invalid log %d: %w", i, err)
+		}
+		if len(fields) != 3 && len(fields) != 8 {
+			return nil, fmt.Errorf("log %d has %d fields, not a known layout", i, len(fields))
+		}
+		log := new(types.Log)
+		err := rlp.DecodeBytes(fields[0], &log.Address)
+		if err == nil {
+			err = rlp.DecodeBytes(fields[1], &log.Topics)
+		}
+		if err == nil {
+			err = rlp.DecodeBytes(fields[2], &log.Data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid log %d: %w", i, err)
+		}
+		logs[i] = log
+	}
+	return logs, nil
+}
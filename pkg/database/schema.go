@@ -0,0 +1,216 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/luxfi/geth/common"
+)
+
+// metadataKeys are the singleton keys geth and the EVM plugins keep at the top
+// level of the database.
+var metadataKeys = map[string]bool{
+	"DatabaseVersion":            true,
+	"LastHeader":                 true,
+	"LastBlock":                  true,
+	"LastFast":                   true,
+	"LastFinalized":              true,
+	"LastStateID":                true,
+	"LastPivot":                  true,
+	"TrieSync":                   true,
+	"SnapshotDisabled":           true,
+	"SnapshotRoot":               true,
+	"SnapshotJournal":            true,
+	"SnapshotGenerator":          true,
+	"SnapshotRecovery":           true,
+	"SnapshotSyncStatus":         true,
+	"SkeletonSyncStatus":         true,
+	"TrieJournal":                true,
+	"TransactionIndexTail":       true,
+	"FastTransactionLookupLimit": true,
+	"InvalidBlock":               true,
+	"unclean-shutdown":           true,
+	"eth2-transition":            true,
+	"SnapSyncStatus":             true,
+}
+
+// vmMetadataKeys are written by the C-chain VM and its consensus engine rather
+// than by geth, in ethdb or in the VM's own metadata database.
+var vmMetadataKeys = map[string]bool{
+	"last_accepted_key":    true,
+	"AcceptorTipKey":       true,
+	"snowman_lastAccepted": true,
+	"height":               true,
+	"lastAccepted":         true,
+	"lastAcceptedHeight":   true,
+	"initialized":          true,
+}
+
+// namedPrefixes are the multi-byte rawdb prefixes, checked before the single
+// byte ones since several of them start with the same letter.
+var namedPrefixes = []struct {
+	prefix string
+	kind   string
+}{
+	{"secure-key-", "preimage"},
+	{"ethereum-config-", "chain-config"},
+	{"ethereum-genesis-", "genesis-state"},
+	{"clique-", "clique-snapshot"},
+	{"fm-", "filter-maps"},
+	{"iB", "bloombits-meta"},
+}
+
+// NamedPrefixes returns the multi-byte table prefixes KeyKind recognises
+func NamedPrefixes() [][]byte {
+	prefixes := make([][]byte, len(namedPrefixes))
+	for i, p := range namedPrefixes {
+		prefixes[i] = []byte(p.prefix)
+	}
+	return prefixes
+}
+
+// KeyKind names the rawdb table a key belongs to, such as "header",
+// "canonical" or "receipts". Keys must already have any namespace removed.
+func KeyKind(key []byte) string {
+	if metadataKeys[string(key)] {
+		return "metadata"
+	}
+	if vmMetadataKeys[string(key)] {
+		return "vm-metadata"
+	}
+	// No named table has 32-byte keys, so a hash node that happens to start
+	// with one of their prefixes is still a trie node
+	if len(key) == 32 {
+		return "trie-node-legacy"
+	}
+	for _, p := range namedPrefixes {
+		if bytes.HasPrefix(key, []byte(p.prefix)) {
+			return p.kind
+		}
+	}
+	if len(key) == 0 {
+		return "other"
+	}
+
+	switch key[0] {
+	case 'h':
+		switch {
+		case len(key) == 10 && key[9] == 'n':
+			return "canonical"
+		case len(key) == 42 && key[41] == 't':
+			return "td"
+		case len(key) == 41:
+			return "header"
+		}
+	case 'H':
+		if len(key) == 33 {
+			return "hash-to-number"
+		}
+	case 'b':
+		if len(key) == 41 {
+			return "body"
+		}
+	case 'r':
+		if len(key) == 41 {
+			return "receipts"
+		}
+	case 'l':
+		if len(key) == 33 {
+			return "tx-lookup"
+		}
+	case 'B':
+		return "bloombits"
+	case 'a':
+		if len(key) == 33 {
+			return "snapshot-account"
+		}
+	case 'o':
+		if len(key) == 65 {
+			return "snapshot-storage"
+		}
+	case 'c':
+		if len(key) == 33 {
+			return "code"
+		}
+	case 'S':
+		if len(key) == 9 {
+			return "skeleton-header"
+		}
+	case 'A':
+		return "trie-node-account"
+	case 'O':
+		return "trie-node-storage"
+	case 'L':
+		return "state-id"
+	case 'm':
+		return "state-history-index"
+	case 'v':
+		return "verkle"
+	}
+	return "other"
+}
+
+// KeyInfo is a key decoded against the rawdb schema
+type KeyInfo struct {
+	Kind string
+	// Namespace is the Subnet-EVM chain prefix that was removed, if any
+	Namespace []byte
+	// Number is the block number of block-keyed tables
+	Number *uint64
+	// Hash is the block, transaction, code, trie node or account hash in the key
+	Hash common.Hash
+	// Slot is the storage slot hash of snapshot storage keys
+	Slot common.Hash
+	// Path is the trie path of path-scheme trie nodes
+	Path []byte
+	// Key is the key with any namespace removed
+	Key []byte
+}
+
+// DecodeKey classifies a key like KeyKind and extracts the block number and
+// hashes it contains. A key that starts with one of namespaces is decoded
+// without it; any other prefix is left alone, since path-scheme trie node keys
+// can be longer than a namespace too.
+func DecodeKey(key []byte, namespaces [][]byte) KeyInfo {
+	info := KeyInfo{Kind: KeyKind(key), Key: key}
+	for _, ns := range namespaces {
+		if len(key) > len(ns) && bytes.HasPrefix(key, ns) {
+			info = KeyInfo{Kind: KeyKind(key[len(ns):]), Namespace: ns, Key: key[len(ns):]}
+			break
+		}
+	}
+
+	k := info.Key
+	number := func() *uint64 {
+		n := binary.BigEndian.Uint64(k[1:9])
+		return &n
+	}
+	switch info.Kind {
+	case "canonical", "skeleton-header":
+		info.Number = number()
+	case "header", "td", "body", "receipts":
+		info.Number = number()
+		info.Hash = common.BytesToHash(k[9:41])
+	case "hash-to-number", "tx-lookup", "snapshot-account", "code":
+		info.Hash = common.BytesToHash(k[1:])
+	case "snapshot-storage":
+		info.Hash = common.BytesToHash(k[1:33])
+		info.Slot = common.BytesToHash(k[33:])
+	case "trie-node-legacy":
+		info.Hash = common.BytesToHash(k)
+	case "trie-node-account":
+		info.Path = k[1:]
+	case "trie-node-storage":
+		if len(k) >= 1+common.HashLength {
+			info.Hash = common.BytesToHash(k[1 : 1+common.HashLength])
+			info.Path = k[1+common.HashLength:]
+		}
+	case "preimage":
+		info.Hash = common.BytesToHash(k[len("secure-key-"):])
+	case "chain-config":
+		info.Hash = common.BytesToHash(k[len("ethereum-config-"):])
+	case "genesis-state":
+		info.Hash = common.BytesToHash(k[len("ethereum-genesis-"):])
+	}
+	return info
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/rlp"
+)
+
+// decodeValue describes a value according to the table its key belongs to. The
+// first string is a one-line summary, the second lists any decoded fields.
+func decodeValue(info database.KeyInfo, value []byte) (string, string) {
+	switch info.Kind {
+	case "header", "skeleton-header":
+		return decodeHeader(value)
+	case "td":
+		td := new(big.Int)
+		if err := rlp.DecodeBytes(value, td); err != nil {
+			return invalid("total difficulty", err)
+		}
+		return "total difficulty " + td.String(), ""
+	case "canonical":
+		return "block hash " + hashString(value), ""
+	case "hash-to-number":
+		if len(value) != 8 {
+			return invalid("block number", fmt.Errorf("%d bytes", len(value)))
+		}
+		return fmt.Sprintf("block #%d", binary.BigEndian.Uint64(value)), ""
+	case "body":
+		return decodeBody(value)
+	case "receipts":
+		items, err := listItems(value)
+		if err != nil {
+			return invalid("receipt list", err)
+		}
+		return fmt.Sprintf("%d receipts", items), ""
+	case "tx-lookup":
+		switch {
+		case len(value) <= 8:
+			return fmt.Sprintf("included in block #%d", new(big.Int).SetBytes(value).Uint64()), ""
+		case len(value) == common.HashLength:
+			return "included in block " + hashString(value), "legacy lookup entry"
+		}
+		return fmt.Sprintf("%d bytes", len(value)), "legacy RLP lookup entry"
+	case "code":
+		return fmt.Sprintf("%d bytes of code", len(value)), hashCheck(info.Hash, value)
+	case "snapshot-account":
+		account, err := types.FullAccount(value)
+		if err != nil {
+			return invalid("snapshot account", err)
+		}
+		return "account", accountString(account)
+	case "snapshot-storage":
+		var slot []byte
+		if err := rlp.DecodeBytes(value, &slot); err != nil {
+			return invalid("storage slot", err)
+		}
+		return fmt.Sprintf("storage value 0x%x", slot), ""
+	case "trie-node-legacy":
+		summary, details := decodeTrieNode(value)
+		return summary, strings.TrimPrefix(details+"; "+hashCheck(info.Hash, value), "; ")
+	case "trie-node-account", "trie-node-storage":
+		summary, details := decodeTrieNode(value)
+		return summary, strings.TrimPrefix(fmt.Sprintf("%s; path %x", details, info.Path), "; ")
+	case "preimage":
+		if len(value) == common.AddressLength {
+			return "address " + common.BytesToAddress(value).Hex(), hashCheck(info.Hash, value)
+		}
+		return fmt.Sprintf("preimage 0x%x", value), hashCheck(info.Hash, value)
+	case "chain-config":
+		var config struct {
+			ChainID *big.Int `json:"chainId"`
+		}
+		if err := json.Unmarshal(value, &config); err != nil {
+			return invalid("chain config", err)
+		}
+		return fmt.Sprintf("chain config, chain ID %v", config.ChainID), string(value)
+	case "metadata", "vm-metadata":
+		return decodeMetadata(value), ""
+	}
+	return fmt.Sprintf("%d bytes", len(value)), ""
+}
+
+func decodeHeader(value []byte) (string, string) {
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(value, &fields); err != nil {
+		return invalid("header", err)
+	}
+	if len(fields) <= database.HeaderTimeField {
+		return invalid("header", fmt.Errorf("%d fields", len(fields)))
+	}
+	var (
+		parent, root, txHash, receiptHash common.Hash
+		difficulty, number                big.Int
+		gasLimit, gasUsed, time           uint64
+	)
+	for _, f := range []struct {
+		index int
+		out   interface{}
+	}{
+		{database.HeaderParentField, &parent},
+		{database.HeaderRootField, &root},
+		{database.HeaderTxHashField, &txHash},
+		{database.HeaderReceiptHashField, &receiptHash},
+		{database.HeaderDifficultyField, &difficulty},
+		{database.HeaderNumberField, &number},
+		{database.HeaderGasLimitField, &gasLimit},
+		{database.HeaderGasUsedField, &gasUsed},
+		{database.HeaderTimeField, &time},
+	} {
+		if err := rlp.DecodeBytes(fields[f.index], f.out); err != nil {
+			return invalid("header", fmt.Errorf("field %d: %w", f.index, err))
+		}
+	}
+	summary := fmt.Sprintf("header #%s (%d fields), hash %s", number.String(), len(fields), crypto.Keccak256Hash(value).Hex())
+	details := fmt.Sprintf("parent=%s root=%s txHash=%s receiptHash=%s difficulty=%s gasLimit=%d gasUsed=%d time=%d",
+		parent.Hex(), root.Hex(), txHash.Hex(), receiptHash.Hex(), difficulty.String(), gasLimit, gasUsed, time)
+	return summary, details
+}
+
+// decodeBody counts the transactions and uncles. Coreth bodies carry extra
+// fields after them, which are only counted.
+func decodeBody(value []byte) (string, string) {
+	content, _, err := rlp.SplitList(value)
+	if err != nil {
+		return invalid("body", err)
+	}
+	var counts []int
+	for len(content) > 0 {
+		kind, item, rest, err := rlp.Split(content)
+		if err != nil {
+			return invalid("body", err)
+		}
+		n := -1
+		if kind == rlp.List {
+			if n, err = rlp.CountValues(item); err != nil {
+				return invalid("body", err)
+			}
+		}
+		counts = append(counts, n)
+		content = rest
+	}
+	if len(counts) < 2 || counts[0] < 0 || counts[1] < 0 {
+		return invalid("body", fmt.Errorf("%d fields", len(counts)))
+	}
+	return fmt.Sprintf("%d transactions, %d uncles", counts[0], counts[1]), fmt.Sprintf("%d fields", len(counts))
+}
+
+// decodeTrieNode names the node type of an encoded MPT node. Leaves holding
+// an account are decoded as one.
+func decodeTrieNode(value []byte) (string, string) {
+	var elems []rlp.RawValue
+	if err := rlp.DecodeBytes(value, &elems); err != nil {
+		return invalid("trie node", err)
+	}
+	switch len(elems) {
+	case 17:
+		children := 0
+		for _, e := range elems[:16] {
+			if !bytes.Equal(e, rlp.EmptyString) {
+				children++
+			}
+		}
+		return fmt.Sprintf("branch node, %d children", children), ""
+	case 2:
+		var key, val []byte
+		if err := rlp.DecodeBytes(elems[0], &key); err != nil || len(key) == 0 {
+			return invalid("short node", err)
+		}
+		if key[0]>>4 < 2 {
+			return fmt.Sprintf("extension node, key 0x%x", key), ""
+		}
+		if err := rlp.DecodeBytes(elems[1], &val); err != nil {
+			return invalid("leaf node", err)
+		}
+		var account types.StateAccount
+		if err := rlp.DecodeBytes(val, &account); err == nil {
+			return fmt.Sprintf("account leaf, key 0x%x", key), accountString(&account)
+		}
+		return fmt.Sprintf("leaf node, key 0x%x", key), fmt.Sprintf("value 0x%x", val)
+	}
+	return invalid("trie node", fmt.Errorf("%d elements", len(elems)))
+}
+
+// decodeMetadata guesses the encoding of a singleton value from its length
+func decodeMetadata(value []byte) string {
+	switch len(value) {
+	case common.HashLength:
+		return "hash " + hashString(value)
+	case 8:
+		return fmt.Sprintf("number %d", binary.BigEndian.Uint64(value))
+	case 1:
+		return fmt.Sprintf("flag %d", value[0])
+	}
+	var number uint64
+	if err := rlp.DecodeBytes(value, &number); err == nil {
+		return fmt.Sprintf("RLP number %d", number)
+	}
+	return fmt.Sprintf("%d bytes: %q", len(value), value)
+}
+
+func accountString(account *types.StateAccount) string {
+	return fmt.Sprintf("nonce=%d balance=%s root=%s codeHash=0x%x",
+		account.Nonce, account.Balance, account.Root.Hex(), account.CodeHash)
+}
+
+func hashString(value []byte) string {
+	if len(value) != common.HashLength {
+		return fmt.Sprintf("0x%x (%d bytes, not a hash)", value, len(value))
+	}
+	return common.BytesToHash(value).Hex()
+}
+
+// hashCheck reports whether value hashes to the hash in its key
+func hashCheck(hash common.Hash, value []byte) string {
+	if crypto.Keccak256Hash(value) == hash {
+		return "keccak256 matches key"
+	}
+	return "keccak256 does not match key"
+}
+
+func listItems(value []byte) (int, error) {
+	content, _, err := rlp.SplitList(value)
+	if err != nil {
+		return 0, err
+	}
+	return rlp.CountValues(content)
+}
+
+func invalid(what string, err error) (string, string) {
+	if err == nil {
+		return "invalid " + what, ""
+	}
+	return "invalid " + what, err.Error()
+}
@@ -2,10 +2,18 @@
 package db
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 
 	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
 	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
 )
 
 // Inspector provides tools for low-level database inspection.
@@ -72,39 +80,43 @@ type InspectResult struct {
 	Type    string
 	Decoded string
 	Details string
+	// Namespace is the Subnet-EVM chain prefix of namespaced keys
+	Namespace []byte
+	// Number is the block number in block-keyed tables
+	Number *uint64
+	// Hash is the block, transaction, code, trie node or account hash in the key
+	Hash common.Hash
 }
 
-// InspectKey decodes and analyzes a specific database key.
+// InspectKey decodes a key against the geth and coreth rawdb schema, with or
+// without a Subnet-EVM namespace, and decodes its value where the table's
+// encoding is known. A leading 32-byte prefix is only removed when the
+// database holds a canonical entry under it.
 func (i *Inspector) InspectKey(key []byte) (*InspectResult, error) {
 	value, err := i.db.Get(key)
 	if err != nil {
 		return nil, fmt.Errorf("key not found: %w", err)
 	}
 
-	// Basic inspection - in the future, we can add more sophisticated decoding
-	result := &InspectResult{
-		Type:    "raw",
-		Decoded: fmt.Sprintf("%d bytes", len(value)),
-	}
-
-	// Try to identify common key types
-	if len(key) > 0 {
-		switch key[0] {
-		case 'h':
-			result.Type = "header"
-		case 'b':
-			result.Type = "body"
-		case 'r':
-			result.Type = "receipt"
-		case 'a':
-			result.Type = "account"
-		case 'H':
-			result.Type = "canonical-hash"
-		case 'n':
-			result.Type = "number-to-hash"
+	var namespaces [][]byte
+	if len(key) > database.NamespaceLength {
+		prefix := key[:database.NamespaceLength]
+		ok, err := database.IsNamespace(i.db, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("namespace check failed: %w", err)
+		}
+		if ok {
+			namespaces = [][]byte{prefix}
 		}
 	}
-
+	info := database.DecodeKey(key, namespaces)
+	result := &InspectResult{
+		Type:      info.Kind,
+		Namespace: info.Namespace,
+		Number:    info.Number,
+		Hash:      info.Hash,
+	}
+	result.Decoded, result.Details = decodeValue(info, value)
 	return result, nil
 }
 
@@ -114,65 +126,262 @@ type TipInfo struct {
 	Hash       []byte
 	ParentHash []byte
 	Timestamp  uint64
+	// Source names the candidate the tip was taken from
+	Source string
+	// Candidates lists every head signal found in the database
+	Candidates []TipCandidate
+}
+
+// Disagree reports whether the head signals point at different blocks
+func (t *TipInfo) Disagree() bool {
+	for _, c := range t.Candidates {
+		if c.Err != "" || c.Hash != t.Candidates[0].Hash {
+			return true
+		}
+	}
+	return false
+}
+
+// TipCandidate is the block one head signal points at
+type TipCandidate struct {
+	Source     string
+	Number     uint64
+	Hash       common.Hash
+	ParentHash common.Hash
+	Timestamp  uint64
+	// Err says why the candidate could not be resolved to a header
+	Err string
 }
 
-// FindTip finds the highest block in the database.
+// Head signals, in the order the tip is chosen from
+const (
+	TipLastBlock     = "LastBlock"
+	TipLastHeader    = "LastHeader"
+	TipLastFast      = "LastFast"
+	TipCanonical     = "highest canonical"
+	TipHighestHeader = "highest header"
+)
+
+// FindTip gathers every head signal: the LastBlock, LastHeader and LastFast
+// pointers, the highest h+num+n canonical entry, found by binary search over
+// heights, and the highest header key present. Each is resolved to its
+// header's hash, parent and timestamp. The tip is taken from the first signal
+// that resolves, in that order; use Disagree and Candidates to find databases
+// whose signals point at different blocks.
 func (i *Inspector) FindTip() (*TipInfo, error) {
-	// This is a simplified implementation
-	// In a real implementation, we would use rawdb functions to find the actual tip
-	return &TipInfo{
-		Height:     0,
-		Hash:       []byte{},
-		ParentHash: []byte{},
-		Timestamp:  0,
-	}, nil
+	tip := new(TipInfo)
+	for _, key := range []string{TipLastBlock, TipLastHeader, TipLastFast} {
+		tip.Candidates = append(tip.Candidates, i.headPointer(key))
+	}
+
+	canonical, ok, err := i.highestCanonical(nil)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		tip.Candidates = append(tip.Candidates, i.canonicalCandidate(canonical))
+	} else {
+		tip.Candidates = append(tip.Candidates, TipCandidate{Source: TipCanonical, Err: "no canonical entries"})
+	}
+
+	header, err := i.highestHeader()
+	if err != nil {
+		return nil, err
+	}
+	tip.Candidates = append(tip.Candidates, header)
+
+	for _, c := range tip.Candidates {
+		if c.Err == "" {
+			tip.Source = c.Source
+			tip.Height = c.Number
+			tip.Hash = c.Hash.Bytes()
+			tip.ParentHash = c.ParentHash.Bytes()
+			tip.Timestamp = c.Timestamp
+			return tip, nil
+		}
+	}
+	return tip, errors.New("no head signal resolves to a header")
 }
 
-// Stats holds database statistics.
-type Stats struct {
-	TotalKeys    uint64
-	TotalSize    uint64
-	KeyTypes     map[string]uint64
-	LatestBlock  uint64
+// headPointer resolves a LastBlock style pointer. Some of our tools stored the
+// height instead of the hash, which is resolved through the canonical table.
+func (i *Inspector) headPointer(key string) TipCandidate {
+	c := TipCandidate{Source: key}
+	value, err := i.db.Get([]byte(key))
+	switch {
+	case err != nil || len(value) == 0:
+		c.Err = "not set"
+		return c
+	case len(value) == 8:
+		c = i.canonicalCandidate(binary.BigEndian.Uint64(value))
+		c.Source = key
+		if c.Err == "" {
+			c.Err = fmt.Sprintf("stores height %d instead of a hash", c.Number)
+		}
+		return c
+	case len(value) != common.HashLength:
+		c.Err = fmt.Sprintf("invalid %d-byte value", len(value))
+		return c
+	}
+	c.Hash = common.BytesToHash(value)
+
+	number, err := i.db.Get(append([]byte("H"), c.Hash.Bytes()...))
+	if err != nil || len(number) != 8 {
+		c.Err = "no hash-to-number entry"
+		return c
+	}
+	c.Number = binary.BigEndian.Uint64(number)
+	i.resolveHeader(&c)
+	return c
 }
 
-// GetStats gathers statistics about the database.
-func (i *Inspector) GetStats() (*Stats, error) {
-	stats := &Stats{
-		KeyTypes: make(map[string]uint64),
+// canonicalCandidate resolves the canonical block at number
+func (i *Inspector) canonicalCandidate(number uint64) TipCandidate {
+	c := TipCandidate{Source: TipCanonical, Number: number}
+	c.Hash = rawdb.ReadCanonicalHash(i.db, number)
+	if c.Hash == (common.Hash{}) {
+		c.Err = fmt.Sprintf("no canonical hash for block %d", number)
+		return c
 	}
+	i.resolveHeader(&c)
+	return c
+}
 
-	iter := i.db.NewIterator(nil, nil)
-	defer iter.Release()
+// resolveHeader fills in the parent and timestamp from the candidate's header
+func (i *Inspector) resolveHeader(c *TipCandidate) {
+	value := rawdb.ReadHeaderRLP(i.db, c.Hash, c.Number)
+	if len(value) == 0 {
+		c.Err = "header missing"
+		return
+	}
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(value, &fields); err != nil || len(fields) <= database.HeaderTimeField {
+		c.Err = "invalid header"
+		return
+	}
+	if rlp.DecodeBytes(fields[database.HeaderParentField], &c.ParentHash) != nil ||
+		rlp.DecodeBytes(fields[database.HeaderTimeField], &c.Timestamp) != nil {
+		c.Err = "invalid header"
+	}
+}
 
-	for iter.Next() {
-		stats.TotalKeys++
-		stats.TotalSize += uint64(len(iter.Key()) + len(iter.Value()))
-
-		// Categorize keys by type
-		if len(iter.Key()) > 0 {
-			switch iter.Key()[0] {
-			case 'h':
-				stats.KeyTypes["header"]++
-			case 'b':
-				stats.KeyTypes["body"]++
-			case 'r':
-				stats.KeyTypes["receipt"]++
-			case 'a':
-				stats.KeyTypes["account"]++
-			case 'H':
-				stats.KeyTypes["canonical-hash"]++
-			case 'n':
-				stats.KeyTypes["number-to-hash"]++
-			default:
-				stats.KeyTypes["other"]++
+// highestCanonical finds the highest h+num+n entry under namespace, assuming
+// the canonical table is contiguous from genesis, or from the end of an
+// attached freezer, which holds the blocks below it: the distance from there
+// is doubled until an entry is missing, then the gap is bisected.
+func (i *Inspector) highestCanonical(namespace []byte) (uint64, bool, error) {
+	has := func(number uint64) (bool, error) {
+		return i.db.Has(append(bytes.Clone(namespace), canonicalKey(number)...))
+	}
+	var base uint64
+	if frozen, err := i.db.Ancients(); err == nil && len(namespace) == 0 {
+		base = frozen
+	}
+	ok, err := has(base)
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		if base > 0 {
+			return base - 1, true, nil
+		}
+		return 0, false, nil
+	}
+	lo, step := base, uint64(1)
+	var hi uint64
+	for {
+		if step > math.MaxUint64-base {
+			return lo, true, nil
+		}
+		hi = base + step
+		ok, err := has(hi)
+		if err != nil {
+			return 0, false, err
+		}
+		if !ok {
+			break
+		}
+		lo = hi
+		step *= 2
+	}
+	// Invariant: lo is present, hi is missing
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := has(mid)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, true, nil
+}
+
+// highestHeader bisects the block numbers for the highest one with a header
+// key. Every probe seeks to h+num and skips the canonical and TD entries until
+// it reaches a header. When the highest number holds several headers the
+// canonical one is preferred.
+func (i *Inspector) highestHeader() (TipCandidate, error) {
+	c := TipCandidate{Source: TipHighestHeader}
+	// firstHeader returns the first header key at or above number
+	firstHeader := func(number uint64) ([]byte, error) {
+		iter := i.db.NewIterator([]byte("h"), binary.BigEndian.AppendUint64(nil, number))
+		defer iter.Release()
+		for iter.Next() {
+			if key := iter.Key(); len(key) == 41 {
+				return bytes.Clone(key), nil
 			}
 		}
+		return nil, iter.Error()
 	}
 
-	if err := iter.Error(); err != nil {
-		return nil, fmt.Errorf("iterator error: %w", err)
+	key, err := firstHeader(0)
+	if err != nil {
+		return c, err
+	}
+	if key == nil {
+		c.Err = "no headers"
+		return c, nil
+	}
+	lo, hi := binary.BigEndian.Uint64(key[1:9]), uint64(math.MaxUint64)
+	// Invariant: a header exists at lo, none above hi
+	for lo < hi {
+		mid := lo + (hi-lo)/2 + 1
+		key, err := firstHeader(mid)
+		if err != nil {
+			return c, err
+		}
+		if key == nil {
+			hi = mid - 1
+		} else {
+			lo = binary.BigEndian.Uint64(key[1:9])
+		}
 	}
 
-	return stats, nil
+	c.Number = lo
+	if canonical, err := i.db.Get(canonicalKey(lo)); err == nil && len(canonical) == common.HashLength {
+		if ok, _ := i.db.Has(headerKey(lo, common.BytesToHash(canonical))); ok {
+			c.Hash = common.BytesToHash(canonical)
+		}
+	}
+	if c.Hash == (common.Hash{}) {
+		key, err := firstHeader(lo)
+		if err != nil {
+			return c, err
+		}
+		c.Hash = common.BytesToHash(key[9:])
+	}
+	i.resolveHeader(&c)
+	return c, nil
+}
+
+func canonicalKey(number uint64) []byte {
+	return append(binary.BigEndian.AppendUint64([]byte("h"), number), 'n')
+}
+
+func headerKey(number uint64, hash common.Hash) []byte {
+	return append(binary.BigEndian.AppendUint64([]byte("h"), number), hash.Bytes()...)
 }
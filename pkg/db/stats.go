@@ -0,0 +1,443 @@
+package db
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/common/hexutil"
+)
+
+const (
+	// DefaultStatsBucketSize is the number of blocks in a height bucket
+	DefaultStatsBucketSize = 100_000
+	// DefaultStatsTop is how many of the largest contracts and values are kept
+	DefaultStatsTop = 20
+	// sampleChunk is the number of heights in one sampled slice of a block table
+	sampleChunk = 1024
+)
+
+// StatsOptions provides options for gathering statistics.
+type StatsOptions struct {
+	// BucketSize is the number of blocks per height bucket
+	BucketSize uint64
+	// Top is how many of the largest contracts and values are reported
+	Top int
+	// SampleRate scans one in SampleRate slices of every table and scales the
+	// counts up by the same factor. 0 or 1 scans every key.
+	SampleRate int
+}
+
+// SizeStat counts keys and their key plus value bytes
+type SizeStat struct {
+	Keys  uint64 `json:"keys"`
+	Bytes uint64 `json:"bytes"`
+}
+
+func (s *SizeStat) add(size, weight uint64) {
+	s.Keys += weight
+	s.Bytes += size * weight
+}
+
+// HeightBucket is the storage used by the blocks [From, To]
+type HeightBucket struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+	SizeStat
+}
+
+// ContractSize is the storage of one contract, from its snapshot storage and
+// path-scheme storage trie entries
+type ContractSize struct {
+	AccountHash common.Hash `json:"accountHash"`
+	// Address is resolved from the preimage table when present
+	Address *common.Address `json:"address,omitempty"`
+	SizeStat
+}
+
+// ValueSize is a single large value
+type ValueSize struct {
+	Key  hexutil.Bytes `json:"key"`
+	Kind string        `json:"kind"`
+	Size int           `json:"size"`
+}
+
+// Stats holds database statistics.
+type Stats struct {
+	TotalKeys   uint64 `json:"totalKeys"`
+	TotalSize   uint64 `json:"totalSize"`
+	LatestBlock uint64 `json:"latestBlock"`
+	// SampleRate is set when the figures are estimates from a sampled scan
+	SampleRate int `json:"sampleRate,omitempty"`
+	// Categories is keyed by rawdb table, as named by database.KeyKind
+	Categories map[string]*SizeStat `json:"categories"`
+	// Namespaces is keyed by hex namespace, with "none" for plain keys
+	Namespaces    map[string]*SizeStat `json:"namespaces"`
+	BucketSize    uint64               `json:"bucketSize"`
+	Heights       []*HeightBucket      `json:"heights"`
+	Contracts     []*ContractSize      `json:"contracts"`
+	LargestValues []*ValueSize         `json:"largestValues"`
+
+	// HashSchemeTries is set when hash-scheme trie nodes were found. They are
+	// keyed by node hash alone, so their storage is missing from Contracts.
+	HashSchemeTries bool `json:"hashSchemeTries,omitempty"`
+}
+
+// Print writes the statistics as tables, largest first
+func (s *Stats) Print(w io.Writer) {
+	estimate := ""
+	if s.SampleRate > 1 {
+		estimate = fmt.Sprintf(" (estimated from 1 in %d slices)", s.SampleRate)
+	}
+	fmt.Fprintf(w, "Total: %d keys, %s%s\n", s.TotalKeys, common.StorageSize(s.TotalSize), estimate)
+	if s.LatestBlock > 0 {
+		fmt.Fprintf(w, "Latest canonical block: %d\n", s.LatestBlock)
+	}
+
+	printSizes := func(title string, sizes map[string]*SizeStat) {
+		names := make([]string, 0, len(sizes))
+		for name := range sizes {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(a, b int) bool { return sizes[names[a]].Bytes > sizes[names[b]].Bytes })
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %-66s %12d keys %12s %5.1f%%\n", name, sizes[name].Keys,
+				common.StorageSize(sizes[name].Bytes), s.percent(sizes[name].Bytes))
+		}
+	}
+	printSizes("Categories", s.Categories)
+	printSizes("Namespaces", s.Namespaces)
+
+	if len(s.Heights) > 0 {
+		fmt.Fprintf(w, "\nBlock heights:\n")
+		for _, b := range s.Heights {
+			fmt.Fprintf(w, "  %10d-%-10d %12d keys %12s %5.1f%%\n", b.From, b.To, b.Keys,
+				common.StorageSize(b.Bytes), s.percent(b.Bytes))
+		}
+	}
+	if len(s.Contracts) > 0 {
+		fmt.Fprintf(w, "\nLargest contracts by storage:\n")
+		for _, c := range s.Contracts {
+			name := c.AccountHash.Hex()
+			if c.Address != nil {
+				name = c.Address.Hex()
+			}
+			fmt.Fprintf(w, "  %-66s %12d keys %12s\n", name, c.Keys, common.StorageSize(c.Bytes))
+		}
+	}
+	if s.HashSchemeTries {
+		fmt.Fprintf(w, "\nHash-scheme trie nodes (%s) cannot be attributed to contracts; the contract\n"+
+			"sizes only cover snapshot and path-scheme storage.\n", common.StorageSize(s.Categories["trie-node-legacy"].Bytes))
+	}
+	if len(s.LargestValues) > 0 {
+		fmt.Fprintf(w, "\nLargest values:\n")
+		for _, v := range s.LargestValues {
+			fmt.Fprintf(w, "  %12s %-20s %x\n", common.StorageSize(v.Size), v.Kind, []byte(v.Key))
+		}
+	}
+}
+
+func (s *Stats) percent(size uint64) float64 {
+	if s.TotalSize == 0 {
+		return 0
+	}
+	return 100 * float64(size) / float64(s.TotalSize)
+}
+
+// GetStats gathers the key counts and sizes of the database per rawdb table,
+// namespace and block-height bucket, with the largest contracts and values.
+// Namespaces are detected with database.DetectNamespaces. With a SampleRate
+// the keyspace is cut into slices, of heights for the block tables and of the
+// two bytes after the table prefix for the hash-keyed ones, and only one in
+// SampleRate of them is read.
+func (i *Inspector) GetStats(opts StatsOptions) (*Stats, error) {
+	if opts.BucketSize == 0 {
+		opts.BucketSize = DefaultStatsBucketSize
+	}
+	if opts.Top <= 0 {
+		opts.Top = DefaultStatsTop
+	}
+
+	candidates, err := database.DetectNamespaces(i.db)
+	if err != nil {
+		return nil, fmt.Errorf("namespace detection failed: %w", err)
+	}
+	var namespaces [][]byte
+	for _, c := range candidates {
+		if c.Confirmed {
+			namespaces = append(namespaces, c.Prefix)
+		}
+	}
+
+	c := &statsCollector{
+		opts:       opts,
+		namespaces: namespaces,
+		heights:    make(map[uint64]*HeightBucket),
+		contracts:  make(map[common.Hash]*SizeStat),
+		stats: &Stats{
+			Categories: make(map[string]*SizeStat),
+			Namespaces: make(map[string]*SizeStat),
+			BucketSize: opts.BucketSize,
+		},
+	}
+	ranges := []scanRange{{weight: 1}}
+	if opts.SampleRate > 1 {
+		c.stats.SampleRate = opts.SampleRate
+		// The chunk holding the head is usually skipped, so the latest block
+		// is the head the plan was cut up to
+		if ranges, c.stats.LatestBlock, err = i.sampleRanges(namespaces, opts.SampleRate); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range ranges {
+		if err := i.scanRange(r, c.add); err != nil {
+			return nil, fmt.Errorf("iterator error: %w", err)
+		}
+	}
+	return c.finish(i), nil
+}
+
+// scanRange is the keys [start, end) of a scan, each counted weight times.
+// A nil end is unbounded.
+type scanRange struct {
+	start, end []byte
+	weight     uint64
+}
+
+func (i *Inspector) scanRange(r scanRange, fn func(key, value []byte, weight uint64)) error {
+	iter := i.db.NewIterator(nil, r.start)
+	defer iter.Release()
+
+	for iter.Next() {
+		if r.end != nil && bytes.Compare(iter.Key(), r.end) >= 0 {
+			break
+		}
+		fn(iter.Key(), iter.Value(), r.weight)
+	}
+	return iter.Error()
+}
+
+// sampleRanges plans a sampled scan of the plain keyspace and of every
+// namespace. The block tables are cut into runs of sampleChunk heights up to
+// the highest canonical block; their keys above it, which are mostly legacy
+// trie nodes, are read in full. The other single-byte tables and the named
+// tables are cut on the two bytes after their prefix. Each plan starts at a
+// random slice so repeated runs do not always skip the same data. The highest
+// canonical block of any of them is returned with the plan.
+func (i *Inspector) sampleRanges(namespaces [][]byte, rate int) ([]scanRange, uint64, error) {
+	var (
+		ranges []scanRange
+		latest uint64
+	)
+	for _, root := range append([][]byte{nil}, namespaces...) {
+		var named [][]byte
+		for _, prefix := range database.NamedPrefixes() {
+			named = append(named, append(bytes.Clone(root), prefix...))
+		}
+		excluded := named
+		if root == nil {
+			excluded = append(excluded, namespaces...)
+		}
+		head, hasHead, err := i.highestCanonical(root)
+		if err != nil {
+			return nil, 0, err
+		}
+		if hasHead {
+			latest = max(latest, head)
+		}
+
+		var tables []scanRange
+		for b := 0; b < 256; b++ {
+			prefix := append(bytes.Clone(root), byte(b))
+			if !hasHead || (b != 'h' && b != 'b' && b != 'r') {
+				tables = append(tables, hashSlices(prefix, rate)...)
+				continue
+			}
+			for chunk := uint64(rand.IntN(rate)); chunk*sampleChunk <= head; chunk += uint64(rate) {
+				tables = append(tables, scanRange{
+					start:  binary.BigEndian.AppendUint64(bytes.Clone(prefix), chunk*sampleChunk),
+					end:    binary.BigEndian.AppendUint64(bytes.Clone(prefix), (chunk+1)*sampleChunk),
+					weight: uint64(rate),
+				})
+			}
+			tables = append(tables, scanRange{
+				start:  binary.BigEndian.AppendUint64(bytes.Clone(prefix), head+1),
+				end:    database.PrefixEnd(prefix),
+				weight: 1,
+			})
+		}
+		ranges = append(ranges, carve(tables, excluded)...)
+		for _, prefix := range named {
+			ranges = append(ranges, hashSlices(prefix, rate)...)
+		}
+	}
+	return ranges, latest, nil
+}
+
+// hashSlices cuts the keys under prefix into 256*rate slices on the two bytes
+// that follow it, at most 65536, and picks one in rate of them
+func hashSlices(prefix []byte, rate int) []scanRange {
+	slices := min(256*rate, 1<<16)
+	bound := func(slice int) []byte {
+		if slice == slices {
+			return database.PrefixEnd(prefix)
+		}
+		return binary.BigEndian.AppendUint16(bytes.Clone(prefix), uint16(slice*(1<<16)/slices))
+	}
+	var ranges []scanRange
+	for s := rand.IntN(rate); s < slices; s += rate {
+		ranges = append(ranges, scanRange{start: bound(s), end: bound(s + 1), weight: uint64(rate)})
+	}
+	return ranges
+}
+
+// carve removes the keys under each of the excluded prefixes from the ranges
+func carve(ranges []scanRange, excluded [][]byte) []scanRange {
+	for _, prefix := range excluded {
+		from, to := prefix, database.PrefixEnd(prefix)
+		var out []scanRange
+		for _, r := range ranges {
+			overlaps := (r.end == nil || bytes.Compare(from, r.end) < 0) &&
+				(to == nil || bytes.Compare(r.start, to) < 0)
+			if !overlaps {
+				out = append(out, r)
+				continue
+			}
+			if bytes.Compare(r.start, from) < 0 {
+				out = append(out, scanRange{start: r.start, end: from, weight: r.weight})
+			}
+			if to != nil && (r.end == nil || bytes.Compare(to, r.end) < 0) {
+				out = append(out, scanRange{start: to, end: r.end, weight: r.weight})
+			}
+		}
+		ranges = out
+	}
+	return ranges
+}
+
+// statsCollector accumulates the statistics of the scanned keys
+type statsCollector struct {
+	opts       StatsOptions
+	namespaces [][]byte
+	stats      *Stats
+	heights    map[uint64]*HeightBucket
+	contracts  map[common.Hash]*SizeStat
+	largest    valueHeap
+}
+
+func (c *statsCollector) add(key, value []byte, weight uint64) {
+	size := uint64(len(key) + len(value))
+	c.stats.TotalKeys += weight
+	c.stats.TotalSize += size * weight
+
+	info := database.DecodeKey(key, c.namespaces)
+
+	category := c.stats.Categories[info.Kind]
+	if category == nil {
+		category = new(SizeStat)
+		c.stats.Categories[info.Kind] = category
+	}
+	category.add(size, weight)
+
+	name := "none"
+	if info.Namespace != nil {
+		name = hex.EncodeToString(info.Namespace)
+	}
+	namespace := c.stats.Namespaces[name]
+	if namespace == nil {
+		namespace = new(SizeStat)
+		c.stats.Namespaces[name] = namespace
+	}
+	namespace.add(size, weight)
+
+	if info.Number != nil {
+		index := *info.Number / c.opts.BucketSize
+		bucket := c.heights[index]
+		if bucket == nil {
+			bucket = &HeightBucket{From: index * c.opts.BucketSize, To: (index+1)*c.opts.BucketSize - 1}
+			c.heights[index] = bucket
+		}
+		bucket.add(size, weight)
+		if info.Kind == "canonical" && *info.Number > c.stats.LatestBlock {
+			c.stats.LatestBlock = *info.Number
+		}
+	}
+
+	if info.Kind == "snapshot-storage" || info.Kind == "trie-node-storage" {
+		contract := c.contracts[info.Hash]
+		if contract == nil {
+			contract = new(SizeStat)
+			c.contracts[info.Hash] = contract
+		}
+		contract.add(size, weight)
+	}
+
+	if c.largest.Len() < c.opts.Top || len(value) > c.largest[0].Size {
+		heap.Push(&c.largest, &ValueSize{Key: bytes.Clone(key), Kind: info.Kind, Size: len(value)})
+		if c.largest.Len() > c.opts.Top {
+			heap.Pop(&c.largest)
+		}
+	}
+}
+
+// finish sorts the collected figures and resolves the addresses of the
+// largest contracts from their preimages
+func (c *statsCollector) finish(i *Inspector) *Stats {
+	s := c.stats
+	s.HashSchemeTries = s.Categories["trie-node-legacy"] != nil
+	for _, b := range c.heights {
+		s.Heights = append(s.Heights, b)
+	}
+	sort.Slice(s.Heights, func(a, b int) bool { return s.Heights[a].From < s.Heights[b].From })
+
+	for hash, size := range c.contracts {
+		s.Contracts = append(s.Contracts, &ContractSize{AccountHash: hash, SizeStat: *size})
+	}
+	sort.Slice(s.Contracts, func(a, b int) bool {
+		if s.Contracts[a].Bytes != s.Contracts[b].Bytes {
+			return s.Contracts[a].Bytes > s.Contracts[b].Bytes
+		}
+		return bytes.Compare(s.Contracts[a].AccountHash[:], s.Contracts[b].AccountHash[:]) < 0
+	})
+	if len(s.Contracts) > c.opts.Top {
+		s.Contracts = s.Contracts[:c.opts.Top]
+	}
+	for _, contract := range s.Contracts {
+		for _, ns := range append([][]byte{nil}, c.namespaces...) {
+			key := append(append(bytes.Clone(ns), "secure-key-"...), contract.AccountHash.Bytes()...)
+			if preimage, err := i.db.Get(key); err == nil && len(preimage) == common.AddressLength {
+				address := common.BytesToAddress(preimage)
+				contract.Address = &address
+				break
+			}
+		}
+	}
+
+	s.LargestValues = make([]*ValueSize, len(c.largest))
+	copy(s.LargestValues, c.largest)
+	sort.Slice(s.LargestValues, func(a, b int) bool { return s.LargestValues[a].Size > s.LargestValues[b].Size })
+	return s
+}
+
+// valueHeap is a min-heap of values by size, so the smallest of the largest
+// values seen so far is the one replaced
+type valueHeap []*ValueSize
+
+func (h valueHeap) Len() int           { return len(h) }
+func (h valueHeap) Less(a, b int) bool { return h[a].Size < h[b].Size }
+func (h valueHeap) Swap(a, b int)      { h[a], h[b] = h[b], h[a] }
+func (h *valueHeap) Push(x any)        { *h = append(*h, x.(*ValueSize)) }
+func (h *valueHeap) Pop() any {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
@@ -0,0 +1,178 @@
+// Package invariant checks the chain database invariants geth and coreth rely
+// on at startup, and plans fixes for the ones that can be repaired offline.
+package invariant
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/luxfi/geth/ethdb"
+)
+
+// Violation is a single broken invariant
+type Violation struct {
+	Invariant string
+	Message   string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("[%s] %s", v.Invariant, v.Message)
+}
+
+// Invariant is a rule a chain database must satisfy
+type Invariant interface {
+	Name() string
+	// Check returns every violation of the rule found in db
+	Check(db ethdb.Database) ([]Violation, error)
+}
+
+// Fixer is implemented by invariants that can be repaired. Fix only plans the
+// writes; nothing changes until the plan is applied.
+type Fixer interface {
+	Invariant
+	Fix(db ethdb.Database) (*Plan, error)
+}
+
+// Step is one write of a Plan. A nil Value deletes the key.
+type Step struct {
+	Description string
+	Key         []byte
+	Value       []byte
+}
+
+// Plan is the list of writes that repair an invariant
+type Plan struct {
+	Invariant string
+	Steps     []Step
+}
+
+// Put adds a write of value under key
+func (p *Plan) Put(description string, key, value []byte) {
+	p.Steps = append(p.Steps, Step{Description: description, Key: key, Value: value})
+}
+
+// Print writes a preview of the plan
+func (p *Plan) Print(w io.Writer) {
+	for _, s := range p.Steps {
+		fmt.Fprintf(w, "  [%s] %s\n", p.Invariant, s.Description)
+	}
+}
+
+// Apply performs every write of the plan in one batch
+func (p *Plan) Apply(db ethdb.KeyValueStore) error {
+	batch := db.NewBatch()
+	for _, s := range p.Steps {
+		var err error
+		if s.Value == nil {
+			err = batch.Delete(s.Key)
+		} else {
+			err = batch.Put(s.Key, s.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Invariant, err)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("%s: failed to apply fix: %w", p.Invariant, err)
+	}
+	return nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Invariant
+)
+
+// Register adds an invariant to the set returned by All. Invariants run in
+// the order they were registered; registering a name twice replaces it.
+func Register(inv Invariant) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for i, existing := range registry {
+		if existing.Name() == inv.Name() {
+			registry[i] = inv
+			return
+		}
+	}
+	registry = append(registry, inv)
+}
+
+// All returns the registered invariants
+func All() []Invariant {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Invariant(nil), registry...)
+}
+
+// Select returns the registered invariants with the given names, in
+// registration order. An unknown name is an error listing the valid ones.
+func Select(names []string) ([]Invariant, error) {
+	all := All()
+	known := make(map[string]bool, len(all))
+	valid := make([]string, len(all))
+	for i, inv := range all {
+		known[inv.Name()] = true
+		valid[i] = inv.Name()
+	}
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown invariant %q (valid: %s)", name, strings.Join(valid, ", "))
+		}
+		selected[name] = true
+	}
+	var invariants []Invariant
+	for _, inv := range all {
+		if selected[inv.Name()] {
+			invariants = append(invariants, inv)
+		}
+	}
+	return invariants, nil
+}
+
+// Result is the outcome of checking one invariant
+type Result struct {
+	Invariant  Invariant
+	Violations []Violation
+	Err        error
+}
+
+// Check runs every invariant against db. A failing check is recorded in its
+// result and does not stop the others.
+func Check(db ethdb.Database, invariants []Invariant) []Result {
+	results := make([]Result, 0, len(invariants))
+	for _, inv := range invariants {
+		violations, err := inv.Check(db)
+		results = append(results, Result{Invariant: inv, Violations: violations, Err: err})
+	}
+	return results
+}
+
+// PlanFixes collects the fix plans of every violated invariant that has one.
+// The names of violated invariants without a fix are returned separately.
+func PlanFixes(db ethdb.Database, results []Result) ([]*Plan, []string, error) {
+	var (
+		plans   []*Plan
+		unfixed []string
+	)
+	for _, r := range results {
+		if len(r.Violations) == 0 {
+			continue
+		}
+		fixer, ok := r.Invariant.(Fixer)
+		if !ok {
+			unfixed = append(unfixed, r.Invariant.Name())
+			continue
+		}
+		plan, err := fixer.Fix(db)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", r.Invariant.Name(), err)
+		}
+		if plan != nil && len(plan.Steps) > 0 {
+			plans = append(plans, plan)
+		}
+	}
+	return plans, unfixed, nil
+}
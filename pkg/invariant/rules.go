@@ -0,0 +1,272 @@
+package invariant
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// maxViolations caps the violations a single rule reports
+const maxViolations = 100
+
+// Raw database keys matching rawdb
+var (
+	headHeaderKey    = []byte("LastHeader")
+	headBlockKey     = []byte("LastBlock")
+	headFastBlockKey = []byte("LastFast")
+	configPrefix     = []byte("ethereum-config-")
+	headerPrefix     = []byte("h")
+	headerHashSuffix = []byte("n")
+)
+
+func init() {
+	Register(&headRule{name: "head-block", key: headBlockKey, needBody: true})
+	Register(&headRule{name: "head-header", key: headHeaderKey})
+	Register(&headRule{name: "head-fast-block", key: headFastBlockKey, needBody: true})
+	Register(genesisRule{})
+	Register(canonicalRule{})
+	Register(blockDataRule{})
+	Register(chainConfigRule{})
+}
+
+// collector gathers violations up to maxViolations and counts the rest
+type collector struct {
+	name       string
+	violations []Violation
+	dropped    int
+}
+
+func (c *collector) add(format string, args ...interface{}) {
+	if len(c.violations) >= maxViolations {
+		c.dropped++
+		return
+	}
+	c.violations = append(c.violations, Violation{Invariant: c.name, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *collector) result() []Violation {
+	if c.dropped > 0 {
+		c.violations = append(c.violations, Violation{
+			Invariant: c.name,
+			Message:   fmt.Sprintf("... and %d more", c.dropped),
+		})
+	}
+	return c.violations
+}
+
+// forEachCanonical calls fn for every h+num+n entry in the key-value store in
+// block order
+func forEachCanonical(db ethdb.Iteratee, fn func(number uint64, hash common.Hash) error) error {
+	it := db.NewIterator(headerPrefix, nil)
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		if len(key) != 1+8+1 || !bytes.HasSuffix(key, headerHashSuffix) {
+			continue
+		}
+		if err := fn(binary.BigEndian.Uint64(key[1:9]), common.BytesToHash(it.Value())); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// canonicalTip walks the canonical chain up from genesis and returns the last
+// block before the first gap or missing header (or body, when needBody is set)
+func canonicalTip(db ethdb.Database, needBody bool) (uint64, common.Hash, bool) {
+	var (
+		tip   uint64
+		found common.Hash
+	)
+	for number := uint64(0); ; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) || !rawdb.HasHeader(db, hash, number) {
+			break
+		}
+		if needBody && !rawdb.HasBody(db, hash, number) {
+			break
+		}
+		tip, found = number, hash
+	}
+	return tip, found, found != (common.Hash{})
+}
+
+// headRule checks one of the head pointers. The pointer must name a known,
+// canonical block with a header, and with a body for the block heads.
+type headRule struct {
+	name     string
+	key      []byte
+	needBody bool
+}
+
+func (r *headRule) Name() string { return r.name }
+
+func (r *headRule) Check(db ethdb.Database) ([]Violation, error) {
+	c := &collector{name: r.name}
+	data, _ := db.Get(r.key)
+	if len(data) != common.HashLength {
+		c.add("%s is not set", r.key)
+		return c.result(), nil
+	}
+	hash := common.BytesToHash(data)
+	number, ok := rawdb.ReadHeaderNumber(db, hash)
+	switch {
+	case !ok:
+		c.add("%s points at %s, which has no block number", r.key, hash.Hex())
+	case !rawdb.HasHeader(db, hash, number):
+		c.add("%s points at #%d %s, which has no header", r.key, number, hash.Hex())
+	case rawdb.ReadCanonicalHash(db, number) != hash:
+		c.add("%s points at #%d %s, which is not canonical", r.key, number, hash.Hex())
+	case r.needBody && !rawdb.HasBody(db, hash, number):
+		c.add("%s points at #%d %s, which has no body", r.key, number, hash.Hex())
+	}
+	return c.result(), nil
+}
+
+// Fix points the head at the highest canonical block reachable from genesis
+func (r *headRule) Fix(db ethdb.Database) (*Plan, error) {
+	number, hash, ok := canonicalTip(db, r.needBody)
+	if !ok {
+		return nil, fmt.Errorf("no canonical block to point %s at", r.key)
+	}
+	plan := &Plan{Invariant: r.name}
+	plan.Put(fmt.Sprintf("set %s to #%d %s", r.key, number, hash.Hex()), r.key, hash.Bytes())
+	return plan, nil
+}
+
+// genesisRule checks that block 0 is canonical and its header hashes to it
+type genesisRule struct{}
+
+func (genesisRule) Name() string { return "genesis" }
+
+func (genesisRule) Check(db ethdb.Database) ([]Violation, error) {
+	c := &collector{name: "genesis"}
+	hash := rawdb.ReadCanonicalHash(db, 0)
+	if hash == (common.Hash{}) {
+		c.add("no canonical hash for block 0")
+		return c.result(), nil
+	}
+	data := rawdb.ReadHeaderRLP(db, hash, 0)
+	if len(data) == 0 {
+		c.add("genesis header %s is missing", hash.Hex())
+		return c.result(), nil
+	}
+	header, err := migration.DecodeHeaderFields(data, hash)
+	switch {
+	case err != nil:
+		c.add("genesis header %s is invalid: %v", hash.Hex(), err)
+	case header.Number == nil || header.Number.Sign() != 0:
+		c.add("genesis header %s has number %v", hash.Hex(), header.Number)
+	}
+	return c.result(), nil
+}
+
+// canonicalRule checks that the canonical hashes have no gaps and that every
+// canonical header links to the one before it
+type canonicalRule struct{}
+
+func (canonicalRule) Name() string { return "canonical-continuity" }
+
+func (canonicalRule) Check(db ethdb.Database) ([]Violation, error) {
+	c := &collector{name: "canonical-continuity"}
+	var (
+		next   uint64
+		parent common.Hash
+	)
+	err := forEachCanonical(db, func(number uint64, hash common.Hash) error {
+		switch {
+		case number == next+1:
+			c.add("no canonical hash for block #%d", next)
+			parent = common.Hash{}
+		case number != next:
+			c.add("no canonical hash for blocks #%d-#%d", next, number-1)
+			parent = common.Hash{}
+		}
+		next = number + 1
+
+		data := rawdb.ReadHeaderRLP(db, hash, number)
+		if len(data) == 0 {
+			parent = common.Hash{}
+			return nil // reported by block-data
+		}
+		header, err := migration.DecodeHeaderFields(data, hash)
+		if err != nil {
+			c.add("canonical header #%d %s is invalid: %v", number, hash.Hex(), err)
+			parent = common.Hash{}
+			return nil
+		}
+		if number > 0 && parent != (common.Hash{}) && header.ParentHash != parent {
+			c.add("canonical header #%d %s has parent %s, but #%d is %s",
+				number, hash.Hex(), header.ParentHash.Hex(), number-1, parent.Hex())
+		}
+		parent = hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.result(), nil
+}
+
+// blockDataRule checks that every canonical block has a header, body and receipts
+type blockDataRule struct{}
+
+func (blockDataRule) Name() string { return "block-data" }
+
+func (blockDataRule) Check(db ethdb.Database) ([]Violation, error) {
+	c := &collector{name: "block-data"}
+	err := forEachCanonical(db, func(number uint64, hash common.Hash) error {
+		var missing []string
+		if !rawdb.HasHeader(db, hash, number) {
+			missing = append(missing, "header")
+		}
+		if !rawdb.HasBody(db, hash, number) {
+			missing = append(missing, "body")
+		}
+		if !rawdb.HasReceipts(db, hash, number) {
+			missing = append(missing, "receipts")
+		}
+		if len(missing) > 0 {
+			c.add("canonical block #%d %s has no %v", number, hash.Hex(), missing)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.result(), nil
+}
+
+// chainConfigRule checks that the chain config is stored under the genesis hash
+type chainConfigRule struct{}
+
+func (chainConfigRule) Name() string { return "chain-config" }
+
+func (chainConfigRule) Check(db ethdb.Database) ([]Violation, error) {
+	c := &collector{name: "chain-config"}
+	genesis := rawdb.ReadCanonicalHash(db, 0)
+	if genesis == (common.Hash{}) {
+		c.add("cannot look up the chain config without a genesis hash")
+		return c.result(), nil
+	}
+	data, _ := db.Get(append(bytes.Clone(configPrefix), genesis.Bytes()...))
+	if len(data) == 0 {
+		c.add("no chain config stored for genesis %s", genesis.Hex())
+		return c.result(), nil
+	}
+	var config struct {
+		ChainID *json.Number `json:"chainId"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		c.add("chain config for genesis %s is not valid JSON: %v", genesis.Hex(), err)
+	} else if config.ChainID == nil {
+		c.add("chain config for genesis %s has no chainId", genesis.Hex())
+	}
+	return c.result(), nil
+}
@@ -1,12 +1,12 @@
 package migration
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 
-	// "github.com/luxfi/database/badgerdb"
-	// "github.com/luxfi/database/pebbledb"
+	"github.com/luxfi/genesis/pkg/database"
 	"github.com/luxfi/geth/ethdb"
-	// "github.com/prometheus/client_golang/prometheus"
 )
 
 // Strategy defines the interface for a specific migration process.
@@ -17,11 +17,29 @@ type Strategy interface {
 	Migrate(source ethdb.Database, dest ethdb.Database) error
 }
 
+// Resumable is implemented by strategies that can continue an interrupted migration.
+type Resumable interface {
+	// SetCheckpoint hands the strategy the checkpointer to save progress with and
+	// the checkpoint to continue from, which is nil for a fresh run.
+	SetCheckpoint(checkpointer *database.Checkpointer, resume *database.Checkpoint)
+}
+
 // Config holds the configuration for a migration.
 type Config struct {
 	SourceDBPath string
 	DestDBPath   string
 	Strategy     Strategy
+
+	// SourceType and DestType select the storage backend for each side.
+	// An empty SourceType is detected from the directory contents and an
+	// empty DestType defaults to PebbleDB.
+	SourceType    database.DatabaseType
+	DestType      database.DatabaseType
+	SourceOptions database.BackendOptions
+	DestOptions   database.BackendOptions
+
+	// Resume continues from the checkpoint left by an interrupted run
+	Resume bool
 }
 
 // Migrator manages the overall migration process.
@@ -36,74 +54,200 @@ func NewMigrator(cfg Config) (*Migrator, error) {
 	if cfg.Strategy == nil {
 		return nil, fmt.Errorf("a migration strategy must be provided")
 	}
+	if cfg.SourceDBPath == "" || cfg.DestDBPath == "" {
+		return nil, fmt.Errorf("both source and destination paths must be provided")
+	}
+	if cfg.SourceType == "" {
+		cfg.SourceType = database.DetectDatabaseType(cfg.SourceDBPath)
+	}
+	if cfg.DestType == "" {
+		cfg.DestType = database.PebbleDB
+	}
+
+	// The source is never written to
+	cfg.SourceOptions.ReadOnly = true
+	if cfg.SourceOptions.Namespace == "" {
+		cfg.SourceOptions.Namespace = "migration/source/"
+	}
+	if cfg.DestOptions.Namespace == "" {
+		cfg.DestOptions.Namespace = "migration/dest/"
+	}
+
+	source, err := database.OpenEthDB(cfg.SourceType, cfg.SourceDBPath, cfg.SourceOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source database: %w", err)
+	}
+
+	dest, err := database.OpenEthDB(cfg.DestType, cfg.DestDBPath, cfg.DestOptions)
+	if err != nil {
+		source.Close()
+		return nil, fmt.Errorf("failed to open destination database: %w", err)
+	}
 
-	// TODO: Fix database initialization with proper parameters
-	// For now, return a simple migrator without opening databases
 	return &Migrator{
 		cfg:    cfg,
-		source: nil,
-		dest:   nil,
+		source: source,
+		dest:   dest,
 	}, nil
 }
 
 // Run executes the migration using the configured strategy.
 func (m *Migrator) Run() error {
 	fmt.Printf("Starting migration with strategy: %s\n", m.cfg.Strategy.Name())
-	fmt.Printf("Source: %s\n", m.cfg.SourceDBPath)
-	fmt.Printf("Destination: %s\n", m.cfg.DestDBPath)
+	fmt.Printf("Source: %s (%s)\n", m.cfg.SourceDBPath, m.cfg.SourceType)
+	fmt.Printf("Destination: %s (%s)\n", m.cfg.DestDBPath, m.cfg.DestType)
+
+	checkpointer, err := m.setupCheckpoint()
+	if err != nil {
+		return err
+	}
 
-	err := m.cfg.Strategy.Migrate(m.source, m.dest)
+	err = m.cfg.Strategy.Migrate(m.source, m.dest)
 
 	if err != nil {
 		return fmt.Errorf("migration strategy '%s' failed: %w", m.cfg.Strategy.Name(), err)
 	}
 
+	if checkpointer != nil {
+		if err := checkpointer.Clear(); err != nil {
+			fmt.Printf("Warning: failed to remove checkpoint %s: %v\n", checkpointer.Path(), err)
+		}
+	}
+
 	fmt.Println("Migration completed successfully.")
 	return nil
 }
 
+// setupCheckpoint hands a checkpointer to strategies that support resuming
+func (m *Migrator) setupCheckpoint() (*database.Checkpointer, error) {
+	resumable, ok := m.cfg.Strategy.(Resumable)
+	if !ok {
+		if m.cfg.Resume {
+			return nil, fmt.Errorf("migration strategy '%s' does not support resuming", m.cfg.Strategy.Name())
+		}
+		return nil, nil
+	}
+
+	checkpointer, err := database.NewCheckpointer(m.cfg.SourceDBPath, m.cfg.DestDBPath, struct {
+		SourceDBPath string
+		DestDBPath   string
+		SourceType   database.DatabaseType
+		DestType     database.DatabaseType
+		Strategy     string
+	}{m.cfg.SourceDBPath, m.cfg.DestDBPath, m.cfg.SourceType, m.cfg.DestType, m.cfg.Strategy.Name()})
+	if err != nil {
+		return nil, err
+	}
+
+	var saved *database.Checkpoint
+	if m.cfg.Resume {
+		saved, err = checkpointer.Load()
+		if err != nil {
+			return nil, fmt.Errorf("cannot resume: %w", err)
+		}
+		if saved == nil {
+			fmt.Printf("No checkpoint found at %s, starting from the beginning\n", checkpointer.Path())
+		} else {
+			fmt.Printf("Resuming from checkpoint saved %s (last key %x)\n", saved.UpdatedAt.Format("2006-01-02 15:04:05"), []byte(saved.LastKey))
+		}
+	}
+
+	resumable.SetCheckpoint(checkpointer, saved)
+	return checkpointer, nil
+}
+
 // Close closes the database connections.
 func (m *Migrator) Close() {
-	m.source.Close()
-	m.dest.Close()
+	if m.source != nil {
+		m.source.Close()
+	}
+	if m.dest != nil {
+		m.dest.Close()
+	}
 }
 
 // --- Example Strategy: FullCopy ---
 
 // FullCopyStrategy implements a simple, full copy of a database.
-type FullCopyStrategy struct{}
+type FullCopyStrategy struct {
+	checkpointer *database.Checkpointer
+	resume       *database.Checkpoint
+}
+
+// fullCopyStats is the progress saved with each FullCopy checkpoint
+type fullCopyStats struct {
+	Keys int `json:"keys"`
+}
 
 func (s *FullCopyStrategy) Name() string { return "FullCopy" }
 
+// SetCheckpoint implements Resumable.
+func (s *FullCopyStrategy) SetCheckpoint(checkpointer *database.Checkpointer, resume *database.Checkpoint) {
+	s.checkpointer = checkpointer
+	s.resume = resume
+}
+
 func (s *FullCopyStrategy) Migrate(source ethdb.Database, dest ethdb.Database) error {
-	// This is a simplified implementation. A real implementation would use batching.
-	iter := source.NewIterator(nil, nil)
+	var stats fullCopyStats
+	var start []byte
+	if s.resume != nil {
+		start = s.resume.LastKey
+		if len(s.resume.Stats) > 0 {
+			if err := json.Unmarshal(s.resume.Stats, &stats); err != nil {
+				return fmt.Errorf("failed to restore checkpoint stats: %w", err)
+			}
+		}
+	}
+
+	iter := source.NewIterator(nil, start)
 	defer iter.Release()
 
 	batch := dest.NewBatch()
-	count := 0
+	count := stats.Keys
+	var lastKey []byte
 
 	for iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
 
+		// The iterator starts at the last committed key, which is already copied
+		if start != nil && bytes.Equal(key, start) {
+			continue
+		}
+
 		if err := batch.Put(key, value); err != nil {
 			return err
 		}
+		count++
+		lastKey = append(lastKey[:0], key...)
+
 		if batch.ValueSize() > 10*1024*1024 { // Write every 10MB
-			if err := batch.Write(); err != nil {
+			if err := s.commit(batch, lastKey, count); err != nil {
 				return err
 			}
 			batch.Reset()
 			fmt.Printf("Committed %d key-value pairs...\n", count)
 		}
-		count++
 	}
 
-	if err := batch.Write(); err != nil {
+	if err := s.commit(batch, lastKey, count); err != nil {
 		return err
 	}
 
 	fmt.Printf("Total key-value pairs migrated: %d\n", count)
 	return iter.Error()
 }
+
+// commit writes the batch and records the last key it contained
+func (s *FullCopyStrategy) commit(batch ethdb.Batch, lastKey []byte, count int) error {
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if s.checkpointer == nil || lastKey == nil {
+		return nil
+	}
+	if err := s.checkpointer.Save("copy", lastKey, fullCopyStats{Keys: count}); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
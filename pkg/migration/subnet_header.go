@@ -1,13 +1,110 @@
 package migration
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"math/big"
 
 	"github.com/luxfi/geth/common"
 	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/rlp"
 )
 
-// SubnetEVMHeader represents a header from SubnetEVM which may have additional fields
+// legacyHeaderFields is the number of fields every header layout starts with
+const legacyHeaderFields = 15
+
+// ErrHeaderHashMismatch is returned when a converted header no longer hashes to
+// the hash it was stored under.
+var ErrHeaderHashMismatch = errors.New("header hash mismatch")
+
+// ErrUnsupportedLayout is returned for a header whose optional fields match none
+// of the known layouts. Such a header may well be valid, it just cannot be
+// decoded in full.
+var ErrUnsupportedLayout = errors.New("unsupported header layout")
+
+// HeaderLayout names one of the RLP encodings a header can have. Layouts differ
+// only in which optional fields follow the 15 legacy fields, and in what order.
+type HeaderLayout string
+
+const (
+	LayoutLegacy          HeaderLayout = "legacy"
+	LayoutLondon          HeaderLayout = "london"
+	LayoutShanghai        HeaderLayout = "shanghai"
+	LayoutCancun          HeaderLayout = "cancun"
+	LayoutPrague          HeaderLayout = "prague"
+	LayoutSubnetEVM       HeaderLayout = "subnet-evm"
+	LayoutSubnetEVMCancun HeaderLayout = "subnet-evm-cancun"
+	LayoutCorethAP1       HeaderLayout = "coreth-apricot1"
+	LayoutCorethAP3       HeaderLayout = "coreth-apricot3"
+	LayoutCorethAP4       HeaderLayout = "coreth-apricot4"
+	LayoutCorethCancun    HeaderLayout = "coreth-cancun"
+
+	// LayoutUnsupported marks a header of which only the legacy fields were read
+	LayoutUnsupported HeaderLayout = "unsupported"
+)
+
+// headerField identifies an optional header field
+type headerField int
+
+const (
+	fieldBaseFee headerField = iota
+	fieldBlockGasCost
+	fieldExtDataHash
+	fieldExtDataGasUsed
+	fieldWithdrawalsHash
+	fieldBlobGasUsed
+	fieldExcessBlobGas
+	fieldParentBeaconRoot
+	fieldRequestsHash
+)
+
+// maxFieldSize is the largest encoded size a field may have; hashes must be exact
+func (f headerField) maxFieldSize() (size int, exact bool) {
+	switch f {
+	case fieldExtDataHash, fieldWithdrawalsHash, fieldParentBeaconRoot, fieldRequestsHash:
+		return common.HashLength, true
+	case fieldBlobGasUsed, fieldExcessBlobGas:
+		return 8, false
+	default:
+		return 32, false
+	}
+}
+
+// headerLayouts lists every known layout in detection order. Layouts with the
+// same number of fields are told apart by field sizes, so the ones with
+// 32-byte hash fields come first.
+var headerLayouts = []struct {
+	layout HeaderLayout
+	fields []headerField
+}{
+	{LayoutLegacy, nil},
+	{LayoutCorethAP1, []headerField{fieldExtDataHash}},
+	{LayoutLondon, []headerField{fieldBaseFee}},
+	{LayoutCorethAP3, []headerField{fieldExtDataHash, fieldBaseFee}},
+	{LayoutShanghai, []headerField{fieldBaseFee, fieldWithdrawalsHash}},
+	{LayoutSubnetEVM, []headerField{fieldBaseFee, fieldBlockGasCost}},
+	{LayoutCorethAP4, []headerField{fieldExtDataHash, fieldBaseFee, fieldExtDataGasUsed, fieldBlockGasCost}},
+	{LayoutCancun, []headerField{fieldBaseFee, fieldWithdrawalsHash, fieldBlobGasUsed, fieldExcessBlobGas, fieldParentBeaconRoot}},
+	{LayoutSubnetEVMCancun, []headerField{fieldBaseFee, fieldBlockGasCost, fieldBlobGasUsed, fieldExcessBlobGas, fieldParentBeaconRoot}},
+	{LayoutPrague, []headerField{fieldBaseFee, fieldWithdrawalsHash, fieldBlobGasUsed, fieldExcessBlobGas, fieldParentBeaconRoot, fieldRequestsHash}},
+	{LayoutCorethCancun, []headerField{fieldExtDataHash, fieldBaseFee, fieldExtDataGasUsed, fieldBlockGasCost, fieldBlobGasUsed, fieldExcessBlobGas, fieldParentBeaconRoot}},
+}
+
+func layoutFields(layout HeaderLayout) ([]headerField, bool) {
+	for _, l := range headerLayouts {
+		if l.layout == layout {
+			return l.fields, true
+		}
+	}
+	return nil, false
+}
+
+// SubnetEVMHeader represents a header from SubnetEVM which may have additional fields.
+// It decodes any known layout and encodes back to exactly the same bytes, so the
+// header keeps its hash.
 type SubnetEVMHeader struct {
 	ParentHash  common.Hash      `json:"parentHash"       gencodec:"required"`
 	UncleHash   common.Hash      `json:"sha3Uncles"       gencodec:"required"`
@@ -24,50 +121,344 @@ type SubnetEVMHeader struct {
 	Extra       []byte           `json:"extraData"        gencodec:"required"`
 	MixDigest   common.Hash      `json:"mixHash"`
 	Nonce       types.BlockNonce `json:"nonce"`
-	
+
 	// EIP-1559 fields
-	BaseFee *big.Int `json:"baseFeePerGas" rlp:"optional"`
-	
-	// Additional SubnetEVM fields
-	BlockGasCost         *big.Int    `json:"blockGasCost"         rlp:"optional"`
-	ExtDataHash          common.Hash `json:"extDataHash"          rlp:"optional"`
-	BlockExtraData       []byte      `json:"blockExtraData"       rlp:"optional"`
-	
-	// EIP-4844 fields (may be present in newer versions)
-	BlobGasUsed          *uint64     `json:"blobGasUsed"          rlp:"optional"`
-	ExcessBlobGas        *uint64     `json:"excessBlobGas"        rlp:"optional"`
-	
+	BaseFee *big.Int `json:"baseFeePerGas"`
+
+	// Additional SubnetEVM and coreth fields
+	BlockGasCost   *big.Int    `json:"blockGasCost"`
+	ExtDataHash    common.Hash `json:"extDataHash"`
+	ExtDataGasUsed *big.Int    `json:"extDataGasUsed"`
+
+	// EIP-4844 fields
+	BlobGasUsed   *uint64 `json:"blobGasUsed"`
+	ExcessBlobGas *uint64 `json:"excessBlobGas"`
+
 	// EIP-4895 fields
-	WithdrawalsHash      *common.Hash `json:"withdrawalsHash"      rlp:"optional"`
-	
+	WithdrawalsHash *common.Hash `json:"withdrawalsHash"`
+
 	// EIP-4788 fields
-	ParentBeaconBlockRoot *common.Hash `json:"parentBeaconBlockRoot" rlp:"optional"`
+	ParentBeaconBlockRoot *common.Hash `json:"parentBeaconBlockRoot"`
+
+	// EIP-7685 fields
+	RequestsHash *common.Hash `json:"requestsHash"`
+
+	// Layout is the encoding the header was decoded from and is encoded with
+	Layout HeaderLayout `json:"-"`
+}
+
+// fieldRef returns a pointer to the struct field backing an optional field
+func (h *SubnetEVMHeader) fieldRef(f headerField) interface{} {
+	switch f {
+	case fieldBaseFee:
+		return &h.BaseFee
+	case fieldBlockGasCost:
+		return &h.BlockGasCost
+	case fieldExtDataHash:
+		return &h.ExtDataHash
+	case fieldExtDataGasUsed:
+		return &h.ExtDataGasUsed
+	case fieldWithdrawalsHash:
+		return &h.WithdrawalsHash
+	case fieldBlobGasUsed:
+		return &h.BlobGasUsed
+	case fieldExcessBlobGas:
+		return &h.ExcessBlobGas
+	case fieldParentBeaconRoot:
+		return &h.ParentBeaconBlockRoot
+	case fieldRequestsHash:
+		return &h.RequestsHash
+	}
+	panic(fmt.Sprintf("unknown header field %d", f))
+}
+
+// fieldValue returns the value to encode for an optional field, or nil if unset
+func (h *SubnetEVMHeader) fieldValue(f headerField) interface{} {
+	switch f {
+	case fieldBaseFee:
+		return optional(h.BaseFee)
+	case fieldBlockGasCost:
+		return optional(h.BlockGasCost)
+	case fieldExtDataHash:
+		return h.ExtDataHash
+	case fieldExtDataGasUsed:
+		return optional(h.ExtDataGasUsed)
+	case fieldWithdrawalsHash:
+		return optional(h.WithdrawalsHash)
+	case fieldBlobGasUsed:
+		return optional(h.BlobGasUsed)
+	case fieldExcessBlobGas:
+		return optional(h.ExcessBlobGas)
+	case fieldParentBeaconRoot:
+		return optional(h.ParentBeaconBlockRoot)
+	case fieldRequestsHash:
+		return optional(h.RequestsHash)
+	}
+	panic(fmt.Sprintf("unknown header field %d", f))
+}
+
+// optional turns a typed nil pointer into an untyped nil so unset fields can be detected
+func optional[T any](v *T) interface{} {
+	if v == nil {
+		return nil
+	}
+	return v
+}
+
+func (h *SubnetEVMHeader) legacyRefs() []interface{} {
+	return []interface{}{
+		&h.ParentHash, &h.UncleHash, &h.Coinbase, &h.Root, &h.TxHash, &h.ReceiptHash,
+		&h.Bloom, &h.Difficulty, &h.Number, &h.GasLimit, &h.GasUsed, &h.Time,
+		&h.Extra, &h.MixDigest, &h.Nonce,
+	}
+}
+
+// DecodeRLP implements rlp.Decoder, detecting the layout from the field count and sizes
+func (h *SubnetEVMHeader) DecodeRLP(s *rlp.Stream) error {
+	var raw []rlp.RawValue
+	if err := s.Decode(&raw); err != nil {
+		return err
+	}
+	if len(raw) < legacyHeaderFields {
+		return fmt.Errorf("header has %d fields, need at least %d", len(raw), legacyHeaderFields)
+	}
+
+	layout, fields, err := detectLayout(raw[legacyHeaderFields:])
+	if err != nil {
+		return err
+	}
+
+	*h = SubnetEVMHeader{Layout: layout}
+	for i, ref := range h.legacyRefs() {
+		if err := rlp.DecodeBytes(raw[i], ref); err != nil {
+			return fmt.Errorf("header field %d: %w", i, err)
+		}
+	}
+	for i, f := range fields {
+		if err := rlp.DecodeBytes(raw[legacyHeaderFields+i], h.fieldRef(f)); err != nil {
+			return fmt.Errorf("header field %d: %w", legacyHeaderFields+i, err)
+		}
+	}
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder, writing the fields of the header's layout.
+// Headers built by hand without a layout get the one matching their set fields.
+func (h *SubnetEVMHeader) EncodeRLP(w io.Writer) error {
+	layout := h.Layout
+	if layout == "" {
+		if layout = h.inferLayout(); layout == "" {
+			return errors.New("no header layout matches the fields that are set")
+		}
+	}
+	fields, ok := layoutFields(layout)
+	if !ok {
+		return fmt.Errorf("unknown header layout %q", layout)
+	}
+
+	list := []interface{}{
+		h.ParentHash, h.UncleHash, h.Coinbase, h.Root, h.TxHash, h.ReceiptHash,
+		h.Bloom, h.Difficulty, h.Number, h.GasLimit, h.GasUsed, h.Time,
+		h.Extra, h.MixDigest, h.Nonce,
+	}
+	for i, f := range fields {
+		value := h.fieldValue(f)
+		if value == nil {
+			return fmt.Errorf("%s header is missing field %d", layout, legacyHeaderFields+i)
+		}
+		list = append(list, value)
+	}
+	return rlp.Encode(w, list)
+}
+
+// inferLayout picks the layout whose optional fields are exactly the set ones
+func (h *SubnetEVMHeader) inferLayout() HeaderLayout {
+	isSet := func(f headerField) bool {
+		if f == fieldExtDataHash {
+			return h.ExtDataHash != (common.Hash{})
+		}
+		return h.fieldValue(f) != nil
+	}
+	for _, l := range headerLayouts {
+		want := make(map[headerField]bool, len(l.fields))
+		for _, f := range l.fields {
+			want[f] = true
+		}
+		match := true
+		for f := fieldBaseFee; f <= fieldRequestsHash; f++ {
+			if isSet(f) != want[f] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return l.layout
+		}
+	}
+	return ""
+}
+
+// detectLayout finds the first layout whose field count and sizes fit the
+// optional fields of an encoded header.
+func detectLayout(optional []rlp.RawValue) (HeaderLayout, []headerField, error) {
+	for _, l := range headerLayouts {
+		if len(l.fields) != len(optional) {
+			continue
+		}
+		fits := true
+		for i, f := range l.fields {
+			kind, content, _, err := rlp.Split(optional[i])
+			if err != nil || kind == rlp.List {
+				fits = false
+				break
+			}
+			size, exact := f.maxFieldSize()
+			if len(content) > size || (exact && len(content) != size) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return l.layout, l.fields, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w with %d fields", ErrUnsupportedLayout, legacyHeaderFields+len(optional))
+}
+
+// Hash returns the keccak256 hash of the header in its own layout
+func (h *SubnetEVMHeader) Hash() common.Hash {
+	enc, err := rlp.EncodeToBytes(h)
+	if err != nil {
+		return common.Hash{}
+	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// ConvertHeader decodes a stored header in its own layout and checks that it
+// can be carried into the converted database as it is: the header must
+// re-encode to the same bytes and hash to the hash in its key. Headers are
+// never rewritten, since any change would change their hash, so the returned
+// encoding is always the stored one. Headers in a layout that is not known
+// fail with ErrUnsupportedLayout.
+func ConvertHeader(data []byte, hash common.Hash) (*SubnetEVMHeader, []byte, error) {
+	var header SubnetEVMHeader
+	if err := rlp.DecodeBytes(data, &header); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	enc, err := rlp.EncodeToBytes(&header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to re-encode header: %w", err)
+	}
+	if got := crypto.Keccak256Hash(enc); got != hash || !bytes.Equal(enc, data) {
+		return nil, nil, fmt.Errorf("%w: block %v (%s layout) stored as %s, re-encodes to %s",
+			ErrHeaderHashMismatch, header.Number, header.Layout, hash.Hex(), got.Hex())
+	}
+	return &header, enc, nil
 }
 
-// ToStandardHeader converts SubnetEVM header to standard geth header
-func (h *SubnetEVMHeader) ToStandardHeader() *types.Header {
+// DecodeHeaderFields decodes the 15 fields every header layout starts with and
+// checks that the stored header hashes to hash. It reads headers in any layout,
+// including unsupported ones, for callers that only follow parent links or
+// sum difficulties. The returned header has no layout and cannot be encoded.
+func DecodeHeaderFields(data []byte, hash common.Hash) (*SubnetEVMHeader, error) {
+	if got := crypto.Keccak256Hash(data); got != hash {
+		return nil, fmt.Errorf("%w: stored as %s, hashes to %s", ErrHeaderHashMismatch, hash.Hex(), got.Hex())
+	}
+	var raw []rlp.RawValue
+	if err := rlp.DecodeBytes(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	if len(raw) < legacyHeaderFields {
+		return nil, fmt.Errorf("header has %d fields, need at least %d", len(raw), legacyHeaderFields)
+	}
+	header := &SubnetEVMHeader{Layout: LayoutUnsupported}
+	for i, ref := range header.legacyRefs() {
+		if err := rlp.DecodeBytes(raw[i], ref); err != nil {
+			return nil, fmt.Errorf("header field %d: %w", i, err)
+		}
+	}
+	return header, nil
+}
+
+// ToStandardHeader converts the header to a geth header with the same hash. The
+// geth header has no room for BlockGasCost or the coreth ExtData fields, so
+// headers in the Subnet-EVM and coreth layouts are refused.
+func (h *SubnetEVMHeader) ToStandardHeader() (*types.Header, error) {
+	layout := h.Layout
+	if layout == "" {
+		layout = h.inferLayout()
+	}
+	fields, ok := layoutFields(layout)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedLayout, layout)
+	}
+	for _, f := range fields {
+		switch f {
+		case fieldBlockGasCost, fieldExtDataHash, fieldExtDataGasUsed:
+			return nil, fmt.Errorf("%s header has fields a geth header cannot hold", layout)
+		}
+	}
+
 	header := &types.Header{
-		ParentHash:  h.ParentHash,
-		UncleHash:   h.UncleHash,
-		Coinbase:    h.Coinbase,
-		Root:        h.Root,
-		TxHash:      h.TxHash,
-		ReceiptHash: h.ReceiptHash,
-		Bloom:       h.Bloom,
-		Difficulty:  h.Difficulty,
-		Number:      h.Number,
-		GasLimit:    h.GasLimit,
-		GasUsed:     h.GasUsed,
-		Time:        h.Time,
-		Extra:       h.Extra,
-		MixDigest:   h.MixDigest,
-		Nonce:       h.Nonce,
-	}
-	
+		ParentHash:       h.ParentHash,
+		UncleHash:        h.UncleHash,
+		Coinbase:         h.Coinbase,
+		Root:             h.Root,
+		TxHash:           h.TxHash,
+		ReceiptHash:      h.ReceiptHash,
+		Bloom:            h.Bloom,
+		Difficulty:       h.Difficulty,
+		Number:           h.Number,
+		GasLimit:         h.GasLimit,
+		GasUsed:          h.GasUsed,
+		Time:             h.Time,
+		Extra:            h.Extra,
+		MixDigest:        h.MixDigest,
+		Nonce:            h.Nonce,
+		WithdrawalsHash:  h.WithdrawalsHash,
+		BlobGasUsed:      h.BlobGasUsed,
+		ExcessBlobGas:    h.ExcessBlobGas,
+		ParentBeaconRoot: h.ParentBeaconBlockRoot,
+		RequestsHash:     h.RequestsHash,
+	}
+
 	// Copy optional fields if present
 	if h.BaseFee != nil {
 		header.BaseFee = new(big.Int).Set(h.BaseFee)
 	}
-	
-	return header
-}
\ No newline at end of file
+
+	return header, nil
+}
+
+// LayoutRange is a run of consecutive blocks that share one header layout
+type LayoutRange struct {
+	Layout HeaderLayout
+	From   uint64
+	To     uint64
+}
+
+// LayoutTracker records which header layout was seen for each block range
+type LayoutTracker struct {
+	ranges []LayoutRange
+}
+
+// Observe records the layout of a block. Blocks must be observed in order.
+func (t *LayoutTracker) Observe(number uint64, layout HeaderLayout) {
+	if n := len(t.ranges); n > 0 && t.ranges[n-1].Layout == layout && t.ranges[n-1].To+1 == number {
+		t.ranges[n-1].To = number
+		return
+	}
+	t.ranges = append(t.ranges, LayoutRange{Layout: layout, From: number, To: number})
+}
+
+// Ranges returns the recorded layout ranges in block order
+func (t *LayoutTracker) Ranges() []LayoutRange {
+	return t.ranges
+}
+
+// Print writes one line per layout range
+func (t *LayoutTracker) Print(w io.Writer) {
+	for _, r := range t.ranges {
+		fmt.Fprintf(w, "  blocks %d-%d: %s\n", r.From, r.To, r.Layout)
+	}
+}
@@ -1,19 +1,61 @@
 package migration
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"runtime"
 	"sort"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/state"
 	"github.com/luxfi/geth/common"
-	"github.com/luxfi/geth/rlp"
 )
 
 // SubnetToCChain migrates SubnetEVM database to C-chain format
 type SubnetToCChain struct {
-	sourceDB *pebble.DB
-	targetDB *pebble.DB
+	sourceDB   *pebble.DB
+	targetDB   *pebble.DB
+	sourcePath string
+	targetPath string
+
+	// Resume continues from the checkpoint left by an interrupted run
+	Resume bool
+
+	// FromBlock and ToBlock limit the migration to the canonical blocks in
+	// that range, plus genesis, and the state reachable from the root at
+	// ToBlock. Both 0 migrates everything; ToBlock 0 alone means the last block.
+	// Such migrations are not checkpointed. They also store every block under
+	// the keys rawdb reads and point the head pointers at the last one.
+	FromBlock uint64
+	ToBlock   uint64
+
+	checkpointer *database.Checkpointer
+	stats        subnetMigrationStats
+	layouts      LayoutTracker
+
+	// head is the last block migrated and headRoot its state root
+	head     blockInfo
+	headRoot common.Hash
+}
+
+// subnetNamespace is the prefix of every key in the SubnetEVM database
+var subnetNamespace = []byte{
+	0x33, 0x7f, 0xb7, 0x3f, 0x9b, 0xcd, 0xac, 0x8c,
+	0x31, 0xa2, 0xd5, 0xf7, 0xb8, 0x77, 0xab, 0x1e,
+	0x8a, 0x2b, 0x7f, 0x2a, 0x1e, 0x9b, 0xf0, 0x2a,
+	0x0a, 0x0e, 0x6c, 0x6f, 0xd1, 0x64, 0xf1, 0xd1,
+}
+
+// subnetMigrationStats is the progress saved with each checkpoint
+type subnetMigrationStats struct {
+	Blocks       int `json:"blocks"`
+	StateEntries int `json:"stateEntries"`
 }
 
 // NewSubnetToCChain creates a new migrator
@@ -36,8 +78,10 @@ func NewSubnetToCChain(sourcePath, targetPath string) (*SubnetToCChain, error) {
 	}
 
 	return &SubnetToCChain{
-		sourceDB: sourceDB,
-		targetDB: targetDB,
+		sourceDB:   sourceDB,
+		targetDB:   targetDB,
+		sourcePath: sourcePath,
+		targetPath: targetPath,
 	}, nil
 }
 
@@ -55,6 +99,22 @@ func (m *SubnetToCChain) Close() {
 func (m *SubnetToCChain) Migrate() error {
 	fmt.Println("Starting SubnetEVM to C-chain migration...")
 
+	partial := m.ranged()
+	if partial && m.Resume {
+		return fmt.Errorf("block-range migrations cannot be resumed, start them again instead")
+	}
+
+	// A range run's checkpoint would look like a full run's, and resuming a
+	// full run from it would skip every block below FromBlock
+	var resume *database.Checkpoint
+	if !partial {
+		saved, err := m.loadCheckpoint()
+		if err != nil {
+			return err
+		}
+		resume = saved
+	}
+
 	// Step 1: Find all blocks
 	blocks, err := m.findAllBlocks()
 	if err != nil {
@@ -62,6 +122,22 @@ func (m *SubnetToCChain) Migrate() error {
 	}
 	fmt.Printf("Found %d blocks to migrate\n", len(blocks))
 
+	// Skip blocks committed before the checkpoint
+	var stateStart []byte
+	if resume != nil {
+		switch resume.Phase {
+		case "blocks":
+			last := binary.BigEndian.Uint64(resume.LastKey)
+			skip := sort.Search(len(blocks), func(i int) bool { return blocks[i].Number > last })
+			blocks = blocks[skip:]
+			fmt.Printf("Resuming after block %d, %d blocks remaining\n", last, len(blocks))
+		case "state":
+			blocks = nil
+			stateStart = resume.LastKey
+			fmt.Printf("Resuming state migration after key %x\n", stateStart)
+		}
+	}
+
 	// Step 2: Migrate blocks in order
 	batch := m.targetDB.NewBatch()
 	for i, blockInfo := range blocks {
@@ -70,12 +146,16 @@ func (m *SubnetToCChain) Migrate() error {
 		}
 
 		// Commit batch every 1000 blocks
-		if (i+1)%1000 == 0 {
+		if (i+1)%1000 == 0 || i == len(blocks)-1 {
 			if err := batch.Commit(pebble.Sync); err != nil {
 				return fmt.Errorf("failed to commit batch at block %d: %w", blockInfo.Number, err)
 			}
+			m.stats.Blocks += (i % 1000) + 1
+			if err := m.saveCheckpoint("blocks", encodeNumber(blockInfo.Number)); err != nil {
+				return err
+			}
 			batch = m.targetDB.NewBatch()
-			fmt.Printf("Migrated %d blocks...\n", i+1)
+			fmt.Printf("Migrated %d blocks...\n", m.stats.Blocks)
 		}
 	}
 
@@ -83,16 +163,84 @@ func (m *SubnetToCChain) Migrate() error {
 	if err := batch.Commit(pebble.Sync); err != nil {
 		return fmt.Errorf("failed to commit final batch: %w", err)
 	}
+	if len(m.layouts.Ranges()) > 0 {
+		fmt.Println("Header layouts:")
+		m.layouts.Print(os.Stdout)
+	}
 
 	// Step 3: Migrate state data
-	if err := m.migrateState(); err != nil {
+	if partial {
+		err = m.migrateStateAtHead()
+	} else {
+		err = m.migrateState(stateStart)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to migrate state: %w", err)
 	}
 
+	if m.checkpointer != nil {
+		if err := m.checkpointer.Clear(); err != nil {
+			fmt.Printf("Warning: failed to remove checkpoint %s: %v\n", m.checkpointer.Path(), err)
+		}
+	}
+
 	fmt.Println("Migration complete!")
 	return nil
 }
 
+// loadCheckpoint sets up checkpointing and returns the checkpoint to resume from, if any
+func (m *SubnetToCChain) loadCheckpoint() (*database.Checkpoint, error) {
+	checkpointer, err := database.NewCheckpointer(m.sourcePath, m.targetPath, struct {
+		SourcePath string
+		TargetPath string
+	}{m.sourcePath, m.targetPath})
+	if err != nil {
+		return nil, err
+	}
+	m.checkpointer = checkpointer
+
+	if !m.Resume {
+		return nil, nil
+	}
+	saved, err := checkpointer.Load()
+	if err != nil {
+		return nil, fmt.Errorf("cannot resume: %w", err)
+	}
+	if saved == nil {
+		fmt.Printf("No checkpoint found at %s, starting from the beginning\n", checkpointer.Path())
+		return nil, nil
+	}
+	if len(saved.Stats) > 0 {
+		if err := json.Unmarshal(saved.Stats, &m.stats); err != nil {
+			return nil, fmt.Errorf("failed to restore checkpoint stats: %w", err)
+		}
+	}
+	return saved, nil
+}
+
+// saveCheckpoint records progress after a committed batch, unless the run is
+// not checkpointed
+func (m *SubnetToCChain) saveCheckpoint(phase string, lastKey []byte) error {
+	if m.checkpointer == nil {
+		return nil
+	}
+	if err := m.checkpointer.Save(phase, lastKey, m.stats); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ranged reports whether only a block range is migrated
+func (m *SubnetToCChain) ranged() bool {
+	return m.FromBlock > 0 || m.ToBlock > 0
+}
+
+func encodeNumber(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
+
 type blockInfo struct {
 	Number uint64
 	Hash   common.Hash
@@ -136,24 +284,29 @@ func (m *SubnetToCChain) findAllBlocks() ([]blockInfo, error) {
 		return blocks[i].Number < blocks[j].Number
 	})
 
-	return blocks, nil
+	return m.limitBlocks(blocks), nil
+}
+
+// limitBlocks keeps genesis and the blocks in [FromBlock, ToBlock]
+func (m *SubnetToCChain) limitBlocks(blocks []blockInfo) []blockInfo {
+	if m.FromBlock == 0 && m.ToBlock == 0 {
+		return blocks
+	}
+	limited := blocks[:0]
+	for _, b := range blocks {
+		if b.Number == 0 || (b.Number >= m.FromBlock && (m.ToBlock == 0 || b.Number <= m.ToBlock)) {
+			limited = append(limited, b)
+		}
+	}
+	return limited
 }
 
 // migrateBlock migrates a single block and its associated data
 func (m *SubnetToCChain) migrateBlock(info blockInfo, batch *pebble.Batch) error {
 	// Construct SubnetEVM header key
-	// Pattern: 0x33[31 bytes padding]68<8-byte-number><32-byte-hash>
-	// The padding is a specific pattern used by SubnetEVM
-	padding := []byte{
-		0x7f, 0xb7, 0x3f, 0x9b, 0xcd, 0xac, 0x8c, 0x31,
-		0xa2, 0xd5, 0xf7, 0xb8, 0x77, 0xab, 0x1e, 0x8a,
-		0x2b, 0x7f, 0x2a, 0x1e, 0x9b, 0xf0, 0x2a, 0x0a,
-		0x0e, 0x6c, 0x6f, 0xd1, 0x64, 0xf1, 0xd1,
-	}
-	
+	// Pattern: <32-byte namespace>68<8-byte-number><32-byte-hash>
 	subnetHeaderKey := make([]byte, 73)
-	subnetHeaderKey[0] = 0x33
-	copy(subnetHeaderKey[1:32], padding)
+	copy(subnetHeaderKey[:32], subnetNamespace)
 	subnetHeaderKey[32] = 0x68 // 'h' for header
 	
 	numBytes := make([]byte, 8)
@@ -168,20 +321,14 @@ func (m *SubnetToCChain) migrateBlock(info blockInfo, batch *pebble.Batch) error
 	}
 	defer closer.Close()
 
-	// Decode header using SubnetEVM format
-	var subnetHeader SubnetEVMHeader
-	if err := rlp.DecodeBytes(headerData, &subnetHeader); err != nil {
-		return fmt.Errorf("failed to decode header: %w", err)
-	}
-	
-	// Convert to standard header for verification
-	header := subnetHeader.ToStandardHeader()
-	
-	// Re-encode as standard header for C-chain
-	standardHeaderData, err := rlp.EncodeToBytes(header)
+	// Decode the header in whatever layout it was written and re-encode it,
+	// failing if the result no longer matches the hash in its key
+	subnetHeader, convertedHeader, err := ConvertHeader(headerData, info.Hash)
 	if err != nil {
-		return fmt.Errorf("failed to re-encode header: %w", err)
+		return err
 	}
+	m.layouts.Observe(info.Number, subnetHeader.Layout)
+	m.head, m.headRoot = info, subnetHeader.Root
 
 	// Create C-chain canonical hash key
 	canonicalKey := append([]byte("H"), numBytes...)
@@ -191,7 +338,7 @@ func (m *SubnetToCChain) migrateBlock(info blockInfo, batch *pebble.Batch) error
 
 	// Create C-chain header key with standard header data
 	headerKey := append([]byte("h"), append(info.Hash.Bytes(), numBytes...)...)
-	if err := batch.Set(headerKey, standardHeaderData, nil); err != nil {
+	if err := batch.Set(headerKey, convertedHeader, nil); err != nil {
 		return err
 	}
 
@@ -200,8 +347,10 @@ func (m *SubnetToCChain) migrateBlock(info blockInfo, batch *pebble.Batch) error
 	copy(subnetBodyKey, subnetHeaderKey)
 	subnetBodyKey[32] = 0x62 // 'b' for body
 
+	var body, receipts []byte
 	if bodyData, closer, err := m.sourceDB.Get(subnetBodyKey); err == nil {
 		defer closer.Close()
+		body = bodyData
 		bodyKey := append([]byte("b"), append(info.Hash.Bytes(), numBytes...)...)
 		if err := batch.Set(bodyKey, bodyData, nil); err != nil {
 			return err
@@ -215,17 +364,44 @@ func (m *SubnetToCChain) migrateBlock(info blockInfo, batch *pebble.Batch) error
 
 	if receiptData, closer, err := m.sourceDB.Get(subnetReceiptKey); err == nil {
 		defer closer.Close()
+		receipts = receiptData
 		receiptKey := append([]byte("r"), append(info.Hash.Bytes(), numBytes...)...)
 		if err := batch.Set(receiptKey, receiptData, nil); err != nil {
 			return err
 		}
 	}
 
+	if m.ranged() {
+		return writeRawdbBlock(batch, info, convertedHeader, body, receipts)
+	}
 	return nil
 }
 
-// migrateState migrates state trie data
-func (m *SubnetToCChain) migrateState() error {
+// writeRawdbBlock stores a migrated block under the keys rawdb reads: its
+// canonical and number entries, and its header, body and receipts keyed by
+// number and hash
+func writeRawdbBlock(batch *pebble.Batch, info blockInfo, header, body, receipts []byte) error {
+	number := encodeNumber(info.Number)
+	numHash := append(bytes.Clone(number), info.Hash.Bytes()...)
+	for _, entry := range []struct{ key, value []byte }{
+		{append(append([]byte("h"), number...), 'n'), info.Hash.Bytes()},
+		{append([]byte("H"), info.Hash.Bytes()...), number},
+		{append([]byte("h"), numHash...), header},
+		{append([]byte("b"), numHash...), body},
+		{append([]byte("r"), numHash...), receipts},
+	} {
+		if len(entry.value) == 0 {
+			continue
+		}
+		if err := batch.Set(entry.key, entry.value, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateState migrates state trie data, starting after the given source key when resuming
+func (m *SubnetToCChain) migrateState(start []byte) error {
 	fmt.Println("Migrating state data...")
 	
 	// SubnetEVM state data uses prefix 0x337f
@@ -239,9 +415,17 @@ func (m *SubnetToCChain) migrateState() error {
 	defer iter.Close()
 
 	batch := m.targetDB.NewBatch()
-	count := 0
+	count := m.stats.StateEntries
 
-	for iter.First(); iter.Valid(); iter.Next() {
+	valid := iter.First()
+	if start != nil {
+		valid = iter.SeekGE(start)
+		if valid && bytes.Equal(iter.Key(), start) {
+			valid = iter.Next()
+		}
+	}
+
+	for ; valid; valid = iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
 
@@ -259,6 +443,10 @@ func (m *SubnetToCChain) migrateState() error {
 			if err := batch.Commit(pebble.Sync); err != nil {
 				return fmt.Errorf("failed to commit state batch: %w", err)
 			}
+			m.stats.StateEntries = count
+			if err := m.saveCheckpoint("state", key); err != nil {
+				return err
+			}
 			batch = m.targetDB.NewBatch()
 			fmt.Printf("Migrated %d state entries...\n", count)
 		}
@@ -270,4 +458,82 @@ func (m *SubnetToCChain) migrateState() error {
 
 	fmt.Printf("Migrated %d state entries\n", count)
 	return nil
-}
\ No newline at end of file
+}
+
+// migrateStateAtHead copies only the state trie reachable from the root of the
+// last migrated block, keyed by node hash as coreth reads it, and points the
+// head pointers at that block
+func (m *SubnetToCChain) migrateStateAtHead() error {
+	if m.head.Hash == (common.Hash{}) {
+		return fmt.Errorf("no blocks found in range %d-%d", m.FromBlock, m.ToBlock)
+	}
+	fmt.Printf("Migrating state at block %d (root %s)...\n", m.head.Number, m.headRoot.Hex())
+
+	// state.Copy writes through ethdb, so the target is handed to a geth
+	// pebble store for the copy and reopened for later runs afterwards
+	if err := m.targetDB.Close(); err != nil {
+		return fmt.Errorf("failed to close target database: %w", err)
+	}
+	m.targetDB = nil
+	copyErr := m.copyHeadState()
+	targetDB, err := pebble.Open(m.targetPath, &pebble.Options{})
+	if err != nil {
+		return fmt.Errorf("failed to reopen target database: %w", err)
+	}
+	m.targetDB = targetDB
+	return copyErr
+}
+
+// copyHeadState writes the head pointers and the state at the head root
+// through a geth store over the closed target
+func (m *SubnetToCChain) copyHeadState() error {
+	dst, err := database.OpenKeyValueStore(database.PebbleDB, m.targetPath, database.BackendOptions{})
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	for _, key := range []string{"LastHeader", "LastBlock", "LastFast", "AcceptorTipKey"} {
+		if err := dst.Put([]byte(key), m.head.Hash.Bytes()); err != nil {
+			return fmt.Errorf("failed to write %s: %w", key, err)
+		}
+	}
+
+	src := state.NewPrefixReader(pebbleReader{m.sourceDB}, subnetNamespace)
+	stats, err := state.Copy(context.Background(), src, dst, state.CopyConfig{
+		Root:     m.headRoot,
+		Workers:  runtime.NumCPU(),
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Migrated state: %s\n", stats)
+	return nil
+}
+
+// pebbleReader serves Has and Get from a pebble database
+type pebbleReader struct {
+	db *pebble.DB
+}
+
+func (r pebbleReader) Has(key []byte) (bool, error) {
+	_, closer, err := r.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+func (r pebbleReader) Get(key []byte) ([]byte, error) {
+	value, closer, err := r.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return bytes.Clone(value), nil
+}
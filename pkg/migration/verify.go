@@ -0,0 +1,171 @@
+package migration
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// VerifyConfig controls how two databases are compared
+type VerifyConfig struct {
+	// PrefixA and PrefixB restrict each side to keys under the prefix and strip it
+	// before comparing, e.g. the 32-byte namespace of a SubnetEVM database.
+	PrefixA []byte
+	PrefixB []byte
+	// Samples is the number of example keys kept for each kind of difference
+	Samples int
+}
+
+// KindDiff counts the differences found for one rawdb key kind
+type KindDiff struct {
+	Kind      string
+	Matched   uint64
+	Missing   uint64 // present in A, absent from B
+	Extra     uint64 // present in B, absent from A
+	Differing uint64 // present in both with different values
+
+	MissingSamples   [][]byte
+	ExtraSamples     [][]byte
+	DifferingSamples [][]byte
+}
+
+// Mismatches returns the total number of differences for this kind
+func (d *KindDiff) Mismatches() uint64 {
+	return d.Missing + d.Extra + d.Differing
+}
+
+// VerifyReport is the result of comparing two databases
+type VerifyReport struct {
+	KeysA uint64
+	KeysB uint64
+	Kinds map[string]*KindDiff
+}
+
+// Mismatches returns the total number of differences across all kinds
+func (r *VerifyReport) Mismatches() uint64 {
+	var total uint64
+	for _, d := range r.Kinds {
+		total += d.Mismatches()
+	}
+	return total
+}
+
+// Sorted returns the per-kind results ordered by name
+func (r *VerifyReport) Sorted() []*KindDiff {
+	kinds := make([]*KindDiff, 0, len(r.Kinds))
+	for _, d := range r.Kinds {
+		kinds = append(kinds, d)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].Kind < kinds[j].Kind })
+	return kinds
+}
+
+// Print writes a human readable summary of the report
+func (r *VerifyReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Keys in A: %d\n", r.KeysA)
+	fmt.Fprintf(w, "Keys in B: %d\n\n", r.KeysB)
+	fmt.Fprintf(w, "%-22s %12s %10s %10s %10s\n", "KIND", "MATCHED", "MISSING", "EXTRA", "DIFFERING")
+	for _, d := range r.Sorted() {
+		fmt.Fprintf(w, "%-22s %12d %10d %10d %10d\n", d.Kind, d.Matched, d.Missing, d.Extra, d.Differing)
+	}
+
+	for _, d := range r.Sorted() {
+		if d.Mismatches() == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", d.Kind)
+		printSamples(w, "missing from B", d.MissingSamples)
+		printSamples(w, "extra in B", d.ExtraSamples)
+		printSamples(w, "differing", d.DifferingSamples)
+	}
+}
+
+func printSamples(w io.Writer, label string, samples [][]byte) {
+	for _, key := range samples {
+		fmt.Fprintf(w, "  %-15s %x\n", label, key)
+	}
+}
+
+// Verify streams both databases in key order and reports every key that is
+// missing, extra or has a different value in B compared to A.
+func Verify(a, b ethdb.Iteratee, config VerifyConfig) (*VerifyReport, error) {
+	report := &VerifyReport{Kinds: make(map[string]*KindDiff)}
+	kind := func(key []byte) *KindDiff {
+		name := database.KeyKind(key)
+		d, ok := report.Kinds[name]
+		if !ok {
+			d = &KindDiff{Kind: name}
+			report.Kinds[name] = d
+		}
+		return d
+	}
+	sample := func(samples *[][]byte, key []byte) {
+		if len(*samples) < config.Samples {
+			*samples = append(*samples, bytes.Clone(key))
+		}
+	}
+
+	itA := a.NewIterator(config.PrefixA, nil)
+	defer itA.Release()
+	itB := b.NewIterator(config.PrefixB, nil)
+	defer itB.Release()
+
+	okA, okB := itA.Next(), itB.Next()
+	for okA || okB {
+		var keyA, keyB []byte
+		if okA {
+			keyA = itA.Key()[len(config.PrefixA):]
+		}
+		if okB {
+			keyB = itB.Key()[len(config.PrefixB):]
+		}
+
+		cmp := 0
+		switch {
+		case !okB:
+			cmp = -1
+		case !okA:
+			cmp = 1
+		default:
+			cmp = bytes.Compare(keyA, keyB)
+		}
+
+		switch {
+		case cmp < 0:
+			d := kind(keyA)
+			d.Missing++
+			sample(&d.MissingSamples, keyA)
+			report.KeysA++
+			okA = itA.Next()
+		case cmp > 0:
+			d := kind(keyB)
+			d.Extra++
+			sample(&d.ExtraSamples, keyB)
+			report.KeysB++
+			okB = itB.Next()
+		default:
+			d := kind(keyA)
+			if bytes.Equal(itA.Value(), itB.Value()) {
+				d.Matched++
+			} else {
+				d.Differing++
+				sample(&d.DifferingSamples, keyA)
+			}
+			report.KeysA++
+			report.KeysB++
+			okA, okB = itA.Next(), itB.Next()
+		}
+	}
+
+	if err := itA.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate database A: %w", err)
+	}
+	if err := itB.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate database B: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,174 @@
+package repair
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/common/bitutil"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// Bloom-bits defaults of coreth and pre-1.16 geth (params.BloomBitsBlocks and
+// params.BloomConfirms). The node only serves sections that are this many
+// blocks long and at least this many blocks behind the head.
+const (
+	DefaultBloomSectionSize = 4096
+	DefaultBloomConfirms    = 256
+)
+
+// bloomBitLength is the number of bits in a header bloom
+const bloomBitLength = 8 * types.BloomByteLength
+
+// Raw bloom-bits keys matching rawdb and the chain indexer
+var (
+	bloomBitsPrefix      = []byte("B")  // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
+	bloomBitsIndexPrefix = []byte("iB") // chain indexer table of the bloom-bits index
+	sectionCountKey      = []byte("count")
+	sectionHeadPrefix    = []byte("shead")
+)
+
+// bloomBitsKey = bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash
+func bloomBitsKey(bit uint, section uint64, head common.Hash) []byte {
+	key := append(append([]byte{}, bloomBitsPrefix...), make([]byte, 10)...)
+	binary.BigEndian.PutUint16(key[1:], uint16(bit))
+	binary.BigEndian.PutUint64(key[3:], section)
+	return append(key, head.Bytes()...)
+}
+
+// sectionHeadKey = bloomBitsIndexPrefix + "shead" + section (uint64 big endian)
+func sectionHeadKey(section uint64) []byte {
+	key := append(append([]byte{}, bloomBitsIndexPrefix...), sectionHeadPrefix...)
+	return append(key, encodeBlockNumber(section)...)
+}
+
+// BloomBitsConfig controls RebuildBloomBits
+type BloomBitsConfig struct {
+	// SectionSize is the number of blocks per section; 0 means DefaultBloomSectionSize
+	SectionSize uint64
+	// Confirms is how far behind the head the last section must end; 0 means
+	// DefaultBloomConfirms
+	Confirms uint64
+	// Progress receives a line every 100 sections when set
+	Progress io.Writer
+}
+
+// BloomBitsReport summarises a bloom-bits rebuild
+type BloomBitsReport struct {
+	HeadNumber  uint64
+	SectionSize uint64
+	Sections    uint64
+	// LastHead is the head hash of the last section written
+	LastHead common.Hash
+}
+
+// Print writes the report
+func (r *BloomBitsReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Head #%d, %d sections of %d blocks\n", r.HeadNumber, r.Sections, r.SectionSize)
+	if r.Sections > 0 {
+		fmt.Fprintf(w, "Last section #%d ends at #%d %s\n", r.Sections-1, r.Sections*r.SectionSize-1, r.LastHead.Hex())
+	}
+}
+
+// RebuildBloomBits regenerates the bloom-bits index that eth_getLogs uses to
+// skip blocks, from the header blooms of the canonical chain. Every complete
+// section that is confirmed below the head header is written the way the
+// node's chain indexer writes it: one compressed bit vector per bloom bit,
+// keyed by the hash of the section's last block, plus that section head and
+// the section count in the iB table.
+func RebuildBloomBits(db ethdb.Database, config BloomBitsConfig) (*BloomBitsReport, error) {
+	if config.SectionSize == 0 {
+		config.SectionSize = DefaultBloomSectionSize
+	}
+	if config.SectionSize%8 != 0 {
+		return nil, fmt.Errorf("section size %d is not a multiple of 8", config.SectionSize)
+	}
+	if config.Confirms == 0 {
+		config.Confirms = DefaultBloomConfirms
+	}
+
+	headNumber, ok := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadHeaderHash(db))
+	if !ok {
+		return nil, errors.New("head header not found")
+	}
+	report := &BloomBitsReport{HeadNumber: headNumber, SectionSize: config.SectionSize}
+	var sections uint64
+	if headNumber+1 > config.Confirms {
+		sections = (headNumber + 1 - config.Confirms) / config.SectionSize
+	}
+
+	w := newWriter(db)
+	bits := make([][]byte, bloomBitLength)
+	for i := range bits {
+		bits[i] = make([]byte, config.SectionSize/8)
+	}
+	for section := uint64(0); section < sections; section++ {
+		for i := range bits {
+			clear(bits[i])
+		}
+		var head common.Hash
+		for i := uint64(0); i < config.SectionSize; i++ {
+			number := section*config.SectionSize + i
+			hash := rawdb.ReadCanonicalHash(db, number)
+			if hash == (common.Hash{}) {
+				return report, fmt.Errorf("no canonical hash for block #%d", number)
+			}
+			header, err := readHeader(db, number, hash)
+			if err != nil {
+				return report, err
+			}
+			if header == nil {
+				return report, fmt.Errorf("canonical header #%d %s is missing", number, hash.Hex())
+			}
+			addBloom(bits, i, header.Bloom)
+			head = hash
+		}
+
+		for bit, vector := range bits {
+			if err := w.batch.Put(bloomBitsKey(uint(bit), section, head), bitutil.CompressBytes(vector)); err != nil {
+				return report, err
+			}
+		}
+		if err := w.batch.Put(sectionHeadKey(section), head.Bytes()); err != nil {
+			return report, err
+		}
+		if err := w.maybeFlush(); err != nil {
+			return report, err
+		}
+		report.Sections++
+		report.LastHead = head
+		if config.Progress != nil && report.Sections%100 == 0 {
+			fmt.Fprintf(config.Progress, "  Indexed %d of %d sections\n", report.Sections, sections)
+		}
+	}
+
+	// The count goes in last so the node never trusts a partially written index
+	count := append(append([]byte{}, bloomBitsIndexPrefix...), sectionCountKey...)
+	if err := w.batch.Put(count, encodeBlockNumber(sections)); err != nil {
+		return report, err
+	}
+	return report, w.flush()
+}
+
+// addBloom sets the bits of the bloom in the vectors at position i, in the
+// layout of geth's bloombits generator: vector k holds bit k%8 of bloom byte
+// 255-k/8, and position i is bit 7-i%8 of vector byte i/8.
+func addBloom(bits [][]byte, i uint64, bloom types.Bloom) {
+	byteIndex := i / 8
+	bitMask := byte(1) << (7 - i%8)
+	for b := 0; b < types.BloomByteLength; b++ {
+		bloomByte := bloom[types.BloomByteLength-1-b]
+		if bloomByte == 0 {
+			continue
+		}
+		for k := 0; k < 8; k++ {
+			if bloomByte&(1<<k) != 0 {
+				bits[8*b+k][byteIndex] |= bitMask
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package repair
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// CanonicalConfig controls RebuildCanonical
+type CanonicalConfig struct {
+	// DryRun reports what would change without writing anything
+	DryRun bool
+}
+
+// CanonicalChange is one height whose canonical hash was rewritten. A zero
+// Old hash means the mapping was missing, a zero New hash that it was removed.
+type CanonicalChange struct {
+	Number uint64
+	Old    common.Hash
+	New    common.Hash
+}
+
+// CanonicalReport describes the chain that was found and what was changed
+type CanonicalReport struct {
+	Tip       common.Hash
+	TipNumber uint64
+	Headers   int // headers found in the database
+	Changes   []CanonicalChange
+	// HashToNumber counts the H+hash entries that were missing or wrong
+	HashToNumber int
+	// HeadUpdated is set when LastHeader or LastBlock did not point at the tip
+	HeadUpdated bool
+	// Broken counts the candidate tips whose ancestry did not reach genesis
+	Broken int
+}
+
+// Print writes the report with every changed height
+func (r *CanonicalReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Tip: #%d %s (%d headers scanned, %d broken candidate tips)\n",
+		r.TipNumber, r.Tip.Hex(), r.Headers, r.Broken)
+	fmt.Fprintf(w, "Canonical heights changed: %d\n", len(r.Changes))
+	for _, c := range r.Changes {
+		switch {
+		case c.Old == (common.Hash{}):
+			fmt.Fprintf(w, "  #%d: added %s\n", c.Number, c.New.Hex())
+		case c.New == (common.Hash{}):
+			fmt.Fprintf(w, "  #%d: removed %s\n", c.Number, c.Old.Hex())
+		default:
+			fmt.Fprintf(w, "  #%d: %s -> %s\n", c.Number, c.Old.Hex(), c.New.Hex())
+		}
+	}
+	fmt.Fprintf(w, "Hash-to-number entries fixed: %d\n", r.HashToNumber)
+	if r.HeadUpdated {
+		fmt.Fprintf(w, "Head pointers moved to the tip\n")
+	}
+}
+
+// RebuildCanonical finds the highest header whose ParentHash chain reaches
+// genesis and makes it the canonical chain: every h+num+n and H+hash entry is
+// rewritten to that chain, canonical entries above the tip are removed, and
+// LastHeader and LastBlock are pointed at the tip. Headers are decoded in any
+// of the SubnetEVM, coreth and geth layouts. Databases with blocks in a
+// freezer are refused: the frozen blocks are canonical and cannot be rewritten,
+// and the scan only sees the key-value store.
+func RebuildCanonical(db ethdb.Database, config CanonicalConfig) (*CanonicalReport, error) {
+	if frozen, err := db.Ancients(); err == nil && frozen > 0 {
+		return nil, fmt.Errorf("blocks 0-%d are in the freezer, repair canonical only rebuilds unfrozen databases", frozen-1)
+	}
+	report := new(CanonicalReport)
+
+	headers, canonical, err := scanHeaders(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, hashes := range headers {
+		report.Headers += len(hashes)
+	}
+	if report.Headers == 0 {
+		return nil, errors.New("no headers found in database")
+	}
+
+	chain, broken, err := bestChain(db, headers)
+	report.Broken = broken
+	if err != nil {
+		return report, err
+	}
+	report.TipNumber = uint64(len(chain) - 1)
+	report.Tip = chain[report.TipNumber]
+
+	w := newWriter(db)
+	for number, hash := range chain {
+		if old := canonical[uint64(number)]; old != hash {
+			report.Changes = append(report.Changes, CanonicalChange{Number: uint64(number), Old: old, New: hash})
+			if !config.DryRun {
+				rawdb.WriteCanonicalHash(w.batch, hash, uint64(number))
+			}
+		}
+		if n, ok := rawdb.ReadHeaderNumber(db, hash); !ok || n != uint64(number) {
+			report.HashToNumber++
+			if !config.DryRun {
+				rawdb.WriteHeaderNumber(w.batch, hash, uint64(number))
+			}
+		}
+		if err := w.maybeFlush(); err != nil {
+			return report, err
+		}
+	}
+
+	var stale []uint64
+	for number := range canonical {
+		if number > report.TipNumber {
+			stale = append(stale, number)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i] < stale[j] })
+	for _, number := range stale {
+		report.Changes = append(report.Changes, CanonicalChange{Number: number, Old: canonical[number]})
+		if !config.DryRun {
+			rawdb.DeleteCanonicalHash(w.batch, number)
+		}
+	}
+
+	if rawdb.ReadHeadHeaderHash(db) != report.Tip || rawdb.ReadHeadBlockHash(db) != report.Tip {
+		report.HeadUpdated = true
+		if !config.DryRun {
+			rawdb.WriteHeadHeaderHash(w.batch, report.Tip)
+			rawdb.WriteHeadBlockHash(w.batch, report.Tip)
+		}
+	}
+	if err := w.flush(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// scanHeaders lists the header hashes stored at each height and the current
+// canonical mappings
+func scanHeaders(db ethdb.Iteratee) (map[uint64][]common.Hash, map[uint64]common.Hash, error) {
+	headers := make(map[uint64][]common.Hash)
+	canonical := make(map[uint64]common.Hash)
+
+	it := db.NewIterator(headerPrefix, nil)
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		switch {
+		case len(key) == headerKeyLength:
+			number := binary.BigEndian.Uint64(key[1:9])
+			headers[number] = append(headers[number], common.BytesToHash(key[9:]))
+		case len(key) == canonicalKeyLength && bytes.HasSuffix(key, headerHashSuffix):
+			if len(it.Value()) == common.HashLength {
+				canonical[binary.BigEndian.Uint64(key[1:9])] = common.BytesToHash(it.Value())
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, nil, fmt.Errorf("failed to scan headers: %w", err)
+	}
+	return headers, canonical, nil
+}
+
+// bestChain walks candidate tips from the highest height down until one
+// reaches genesis, and returns its hashes indexed by block number. Headers
+// passed through by a failed walk are not tried again.
+func bestChain(db ethdb.Reader, headers map[uint64][]common.Hash) ([]common.Hash, int, error) {
+	heights := make([]uint64, 0, len(headers))
+	for number := range headers {
+		heights = append(heights, number)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+
+	head := rawdb.ReadHeadHeaderHash(db)
+	var (
+		dead    = make(map[common.Hash]bool)
+		broken  int
+		lastErr error
+	)
+	for _, number := range heights {
+		candidates := headers[number]
+		// Prefer the current head when several headers share the height
+		if i := slices.Index(candidates, head); i > 0 {
+			candidates[0], candidates[i] = candidates[i], candidates[0]
+		}
+
+		for _, tip := range candidates {
+			if dead[tip] {
+				continue
+			}
+			chain, visited, err := walkToGenesis(db, number, tip, dead)
+			if err == nil {
+				return chain, broken, nil
+			}
+			broken++
+			lastErr = err
+			for _, hash := range visited {
+				dead[hash] = true
+			}
+		}
+	}
+	return nil, broken, fmt.Errorf("no header chain reaches genesis: %w", lastErr)
+}
+
+// walkToGenesis follows ParentHash from the tip down to block 0. On failure it
+// also returns the hashes it passed, which cannot reach genesis either.
+func walkToGenesis(db ethdb.Reader, number uint64, tip common.Hash, dead map[common.Hash]bool) ([]common.Hash, []common.Hash, error) {
+	var visited []common.Hash
+	hash := tip
+	for n := number; ; n-- {
+		if dead[hash] {
+			return nil, visited, fmt.Errorf("header #%d %s leads to a broken chain", n, hash.Hex())
+		}
+		header, err := readHeader(db, n, hash)
+		if err != nil {
+			return nil, visited, err
+		}
+		if header == nil {
+			return nil, visited, fmt.Errorf("header #%d %s is missing", n, hash.Hex())
+		}
+		if header.Number == nil || header.Number.Uint64() != n {
+			return nil, visited, fmt.Errorf("header %s is stored at #%d but has number %v", hash.Hex(), n, header.Number)
+		}
+		visited = append(visited, hash)
+		if n == 0 {
+			break
+		}
+		hash = header.ParentHash
+	}
+
+	// visited runs from the tip down, the chain is indexed by number
+	chain := make([]common.Hash, len(visited))
+	for i, hash := range visited {
+		chain[len(visited)-1-i] = hash
+	}
+	return chain, nil, nil
+}
@@ -0,0 +1,80 @@
+// Package repair rebuilds the chain indexes of a geth-style key-value store
+// from the block data it still holds.
+package repair
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// Raw database keys matching rawdb
+var (
+	headerPrefix     = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
+	headerHashSuffix = []byte("n") // headerPrefix + num (uint64 big endian) + headerHashSuffix -> hash
+	headerTDSuffix   = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
+)
+
+const (
+	headerKeyLength    = 1 + 8 + common.HashLength
+	canonicalKeyLength = 1 + 8 + 1
+)
+
+func encodeBlockNumber(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
+
+// headerKey = headerPrefix + num (uint64 big endian) + hash
+func headerKey(number uint64, hash common.Hash) []byte {
+	return append(append(append([]byte{}, headerPrefix...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// tdKey = headerPrefix + num (uint64 big endian) + hash + headerTDSuffix
+func tdKey(number uint64, hash common.Hash) []byte {
+	return append(headerKey(number, hash), headerTDSuffix...)
+}
+
+// readHeader reads the header stored under number and hash, from the freezer
+// if it was moved there, and decodes the fields every header layout shares.
+// A nil header means it is missing.
+func readHeader(db ethdb.Reader, number uint64, hash common.Hash) (*migration.SubnetEVMHeader, error) {
+	data := rawdb.ReadHeaderRLP(db, hash, number)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	header, err := migration.DecodeHeaderFields(data, hash)
+	if err != nil {
+		return nil, fmt.Errorf("header #%d %s: %w", number, hash.Hex(), err)
+	}
+	return header, nil
+}
+
+// writer batches writes and flushes them once they reach ethdb.IdealBatchSize
+type writer struct {
+	batch ethdb.Batch
+}
+
+func newWriter(db ethdb.KeyValueStore) *writer {
+	return &writer{batch: db.NewBatch()}
+}
+
+func (w *writer) maybeFlush() error {
+	if w.batch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *writer) flush() error {
+	if err := w.batch.Write(); err != nil {
+		return fmt.Errorf("failed to write batch: %w", err)
+	}
+	w.batch.Reset()
+	return nil
+}
@@ -0,0 +1,146 @@
+package repair
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+)
+
+// maxTDExamples caps the mismatches kept in a TDReport
+const maxTDExamples = 20
+
+// TDConfig controls RebuildTD
+type TDConfig struct {
+	// Check only reports missing and wrong entries without writing them
+	Check bool
+}
+
+// TDMismatch is a block whose stored total difficulty is missing or wrong.
+// Stored is nil when the entry is missing or cannot be decoded.
+type TDMismatch struct {
+	Number   uint64
+	Hash     common.Hash
+	Stored   *big.Int
+	Expected *big.Int
+}
+
+// TDReport summarises a total difficulty pass over the canonical chain
+type TDReport struct {
+	Blocks     uint64
+	Head       common.Hash
+	TD         *big.Int // total difficulty of the last block
+	Missing    uint64
+	Mismatched uint64
+	Written    uint64
+	// Examples holds the first mismatches found
+	Examples []TDMismatch
+}
+
+// Consistent reports whether every block had the right total difficulty
+func (r *TDReport) Consistent() bool {
+	return r.Missing == 0 && r.Mismatched == 0
+}
+
+// Print writes the report
+func (r *TDReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Checked %d canonical blocks up to %s (total difficulty %v)\n", r.Blocks, r.Head.Hex(), r.TD)
+	fmt.Fprintf(w, "Missing: %d, mismatched: %d, written: %d\n", r.Missing, r.Mismatched, r.Written)
+	for _, m := range r.Examples {
+		if m.Stored == nil {
+			fmt.Fprintf(w, "  #%d %s: missing or unreadable, expected %v\n", m.Number, m.Hash.Hex(), m.Expected)
+		} else {
+			fmt.Fprintf(w, "  #%d %s: stored %v, expected %v\n", m.Number, m.Hash.Hex(), m.Stored, m.Expected)
+		}
+	}
+	if shown := uint64(len(r.Examples)); r.Missing+r.Mismatched > shown {
+		fmt.Fprintf(w, "  ... and %d more\n", r.Missing+r.Mismatched-shown)
+	}
+}
+
+// RebuildTD walks the canonical chain from genesis, accumulating header
+// difficulties, and writes the h+num+hash+t total difficulty entry of every
+// block that is missing or wrong. The walk stops at the first height without
+// a canonical hash and fails if a header does not link to its predecessor.
+func RebuildTD(db ethdb.KeyValueStore, config TDConfig) (*TDReport, error) {
+	var (
+		reader = rawdb.NewDatabase(db)
+		report = &TDReport{TD: new(big.Int)}
+		w      = newWriter(db)
+		parent common.Hash
+	)
+	for number := uint64(0); ; number++ {
+		hash := rawdb.ReadCanonicalHash(reader, number)
+		if hash == (common.Hash{}) {
+			break
+		}
+		header, err := readHeader(reader, number, hash)
+		if err != nil {
+			return report, err
+		}
+		if header == nil {
+			return report, fmt.Errorf("canonical header #%d %s is missing", number, hash.Hex())
+		}
+		if number > 0 && header.ParentHash != parent {
+			return report, fmt.Errorf("canonical chain is broken at #%d: parent %s, expected %s (run repair canonical first)",
+				number, header.ParentHash.Hex(), parent.Hex())
+		}
+		if header.Difficulty != nil {
+			report.TD.Add(report.TD, header.Difficulty)
+		}
+
+		stored, present := readTD(db, number, hash)
+		if stored == nil || stored.Cmp(report.TD) != 0 {
+			if !present {
+				report.Missing++
+			} else {
+				report.Mismatched++
+			}
+			if len(report.Examples) < maxTDExamples {
+				report.Examples = append(report.Examples, TDMismatch{
+					Number: number, Hash: hash, Stored: stored, Expected: new(big.Int).Set(report.TD),
+				})
+			}
+			if !config.Check {
+				enc, err := rlp.EncodeToBytes(report.TD)
+				if err != nil {
+					return report, fmt.Errorf("failed to encode total difficulty: %w", err)
+				}
+				if err := w.batch.Put(tdKey(number, hash), enc); err != nil {
+					return report, err
+				}
+				report.Written++
+				if err := w.maybeFlush(); err != nil {
+					return report, err
+				}
+			}
+		}
+
+		report.Blocks++
+		report.Head = hash
+		parent = hash
+	}
+	if report.Blocks == 0 {
+		return report, errors.New("no canonical genesis hash found")
+	}
+	return report, w.flush()
+}
+
+// readTD returns the stored total difficulty of a block and whether an entry
+// exists at all. An entry that cannot be decoded is returned as nil.
+func readTD(db ethdb.KeyValueReader, number uint64, hash common.Hash) (*big.Int, bool) {
+	data, err := db.Get(tdKey(number, hash))
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+	td := new(big.Int)
+	if err := rlp.DecodeBytes(data, td); err != nil {
+		return nil, true
+	}
+	return td, true
+}
@@ -0,0 +1,269 @@
+package repair
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+)
+
+// TxIndexConfig controls RebuildTxIndex and VerifyTxIndex
+type TxIndexConfig struct {
+	From uint64
+	// To is the last block to index; 0 means the head block
+	To      uint64
+	Workers int
+	// Samples is the number of transactions VerifyTxIndex checks
+	Samples int
+	// Progress receives a line every 100k blocks when set
+	Progress io.Writer
+}
+
+// TxIndexReport summarises a transaction index pass
+type TxIndexReport struct {
+	From         uint64
+	To           uint64
+	Blocks       uint64
+	Transactions uint64
+	// Failures lists the sampled transactions whose lookup entry was missing
+	// or pointed at the wrong block (verify only)
+	Failures []TxLookupFailure
+}
+
+// maxPrintedFailures caps the failures listed by TxIndexReport.Print
+const maxPrintedFailures = 20
+
+// Print writes the report and the first failures
+func (r *TxIndexReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Read %d blocks in #%d-#%d with %d transactions\n", r.Blocks, r.From, r.To, r.Transactions)
+	if len(r.Failures) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Unresolved lookups: %d\n", len(r.Failures))
+	for i, f := range r.Failures {
+		if i == maxPrintedFailures {
+			fmt.Fprintf(w, "  ... and %d more\n", len(r.Failures)-i)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", f)
+	}
+}
+
+// TxLookupFailure is a transaction whose lookup entry does not resolve to the
+// block that contains it. Indexed is nil when the entry is missing.
+type TxLookupFailure struct {
+	Hash    common.Hash
+	Number  uint64
+	Indexed *uint64
+}
+
+func (f TxLookupFailure) String() string {
+	if f.Indexed == nil {
+		return fmt.Sprintf("tx %s in #%d: no lookup entry", f.Hash.Hex(), f.Number)
+	}
+	return fmt.Sprintf("tx %s in #%d: indexed at #%d", f.Hash.Hex(), f.Number, *f.Indexed)
+}
+
+// bodyTxHashes returns the hashes of the transactions in a block body without
+// decoding them. Only the leading transaction list is read, so the extra body
+// fields of coreth and SubnetEVM are ignored.
+func bodyTxHashes(body []byte) ([]common.Hash, error) {
+	fields, _, err := rlp.SplitList(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	txs, _, err := rlp.SplitList(fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction list: %w", err)
+	}
+
+	var hashes []common.Hash
+	for len(txs) > 0 {
+		kind, content, rest, err := rlp.Split(txs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction: %w", err)
+		}
+		// Legacy transactions hash their full encoding, typed ones the
+		// content of the byte string they are wrapped in
+		preimage := content
+		if kind == rlp.List {
+			preimage = txs[:len(txs)-len(rest)]
+		}
+		hashes = append(hashes, crypto.Keccak256Hash(preimage))
+		txs = rest
+	}
+	return hashes, nil
+}
+
+// canonicalTxHashes reads the canonical block at number and its transaction hashes
+func canonicalTxHashes(db ethdb.Reader, number uint64) (common.Hash, []common.Hash, error) {
+	hash := rawdb.ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return hash, nil, fmt.Errorf("no canonical hash for block #%d", number)
+	}
+	body := rawdb.ReadBodyRLP(db, hash, number)
+	if len(body) == 0 {
+		return hash, nil, fmt.Errorf("body of block #%d %s is missing", number, hash.Hex())
+	}
+	txs, err := bodyTxHashes(body)
+	if err != nil {
+		return hash, nil, fmt.Errorf("block #%d: %w", number, err)
+	}
+	return hash, txs, nil
+}
+
+// resolveRange fills in the head block as the end of the range
+func (c *TxIndexConfig) resolveRange(db ethdb.Reader) error {
+	if c.To == 0 {
+		head, ok := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadBlockHash(db))
+		if !ok {
+			return errors.New("head block not found, pass an explicit end block")
+		}
+		c.To = head
+	}
+	if c.From > c.To {
+		return fmt.Errorf("start block %d is past end block %d", c.From, c.To)
+	}
+	if c.Workers < 1 {
+		c.Workers = 1
+	}
+	return nil
+}
+
+// blockTxs is the result of decoding one block body
+type blockTxs struct {
+	number uint64
+	hashes []common.Hash
+}
+
+// RebuildTxIndex writes the l+txhash lookup entry of every transaction in the
+// canonical blocks [From, To]. Bodies are decoded by a pool of workers and the
+// entries are written in batches by a single writer. Bodies that were moved
+// into a freezer are read from it when db has one attached.
+func RebuildTxIndex(db ethdb.Database, config TxIndexConfig) (*TxIndexReport, error) {
+	if err := config.resolveRange(db); err != nil {
+		return nil, err
+	}
+	report := &TxIndexReport{From: config.From, To: config.To}
+
+	// Cancelled on the first failure so the producer and workers stop early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	numbers := make(chan uint64, 4*config.Workers)
+	go func() {
+		defer close(numbers)
+		for n := config.From; n <= config.To; n++ {
+			select {
+			case numbers <- n:
+			case <-ctx.Done():
+				return
+			}
+			if n == config.To {
+				return // avoid wrapping around at the maximum block number
+			}
+		}
+	}()
+
+	results := make(chan blockTxs, 4*config.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range numbers {
+				_, hashes, err := canonicalTxHashes(db, number)
+				if err != nil {
+					fail(err)
+					return
+				}
+				select {
+				case results <- blockTxs{number: number, hashes: hashes}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	w := newWriter(db)
+	for res := range results {
+		if ctx.Err() != nil {
+			continue // drain so the workers can exit
+		}
+		rawdb.WriteTxLookupEntries(w.batch, res.number, res.hashes)
+		report.Blocks++
+		report.Transactions += uint64(len(res.hashes))
+		if err := w.maybeFlush(); err != nil {
+			fail(err)
+			continue
+		}
+		if config.Progress != nil && report.Blocks%100000 == 0 {
+			fmt.Fprintf(config.Progress, "  Indexed %d blocks, %d transactions\n", report.Blocks, report.Transactions)
+		}
+	}
+	if firstErr != nil {
+		return report, firstErr
+	}
+	return report, w.flush()
+}
+
+// VerifyTxIndex picks random canonical blocks in [From, To] and checks that the
+// lookup entry of each of their transactions resolves back to the block, until
+// Samples transactions have been checked. Nothing is written.
+func VerifyTxIndex(db ethdb.Database, config TxIndexConfig) (*TxIndexReport, error) {
+	if err := config.resolveRange(db); err != nil {
+		return nil, err
+	}
+	if config.Samples < 1 {
+		config.Samples = 1000
+	}
+	report := &TxIndexReport{From: config.From, To: config.To}
+
+	// Give up after this many blocks so ranges of empty blocks end quickly.
+	// Ranges no longer than that are checked block by block instead.
+	span := config.To - config.From + 1
+	attempts := uint64(10 * config.Samples)
+	for i := uint64(0); i < min(span, attempts) && report.Transactions < uint64(config.Samples); i++ {
+		number := config.From + i
+		if span > attempts {
+			number = config.From + rand.Uint64()%span
+		}
+		hash, txs, err := canonicalTxHashes(db, number)
+		if err != nil {
+			return report, err
+		}
+		report.Blocks++
+		for _, tx := range txs {
+			report.Transactions++
+			indexed := rawdb.ReadTxLookupEntry(db, tx)
+			if indexed == nil || *indexed != number || rawdb.ReadCanonicalHash(db, *indexed) != hash {
+				report.Failures = append(report.Failures, TxLookupFailure{Hash: tx, Number: number, Indexed: indexed})
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,272 @@
+package rpcserver
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/common/hexutil"
+	"github.com/luxfi/geth/rpc"
+)
+
+// DefaultMaxLogRange caps how many blocks a single eth_getLogs call may scan
+const DefaultMaxLogRange = 10_000
+
+// Config limits the work a single request may do. Zero values use the defaults.
+type Config struct {
+	// MaxLogRange is the most blocks one eth_getLogs call may scan
+	MaxLogRange uint64
+	// GasCap is the most gas one eth_call or eth_estimateGas run may use
+	GasCap uint64
+}
+
+// EthAPI serves the eth namespace from a Chain. Every method only reads;
+// calls run against an in-memory copy of the state.
+type EthAPI struct {
+	chain       *Chain
+	maxLogRange uint64
+	gasCap      uint64
+}
+
+// NewEthAPI returns the eth namespace over chain
+func NewEthAPI(chain *Chain, config Config) *EthAPI {
+	api := &EthAPI{chain: chain, maxLogRange: config.MaxLogRange, gasCap: config.GasCap}
+	if api.maxLogRange == 0 {
+		api.maxLogRange = DefaultMaxLogRange
+	}
+	if api.gasCap == 0 {
+		api.gasCap = DefaultGasCap
+	}
+	return api
+}
+
+// ChainId returns the chain ID of the stored chain config
+func (api *EthAPI) ChainId() (*hexutil.Big, error) {
+	id, err := api.chain.ChainID()
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(id), nil
+}
+
+// BlockNumber returns the number of the head block
+func (api *EthAPI) BlockNumber() (hexutil.Uint64, error) {
+	number, _, err := api.chain.Head()
+	return hexutil.Uint64(number), err
+}
+
+// GetBlockByNumber returns the canonical block at number, with full
+// transactions when fullTx is set, or null if there is none
+func (api *EthAPI) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	n, err := api.resolveNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.chain.BlockByNumber(n)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	return marshalBlock(block, fullTx)
+}
+
+// GetBlockByHash returns the block with the given hash, or null if it is not stored
+func (api *EthAPI) GetBlockByHash(hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	block, err := api.chain.BlockByHash(hash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	return marshalBlock(block, fullTx)
+}
+
+// GetTransactionByHash returns a transaction found through its lookup entry,
+// or null if it is not indexed
+func (api *EthAPI) GetTransactionByHash(hash common.Hash) (*RPCTransaction, error) {
+	block, index, err := api.findTransaction(hash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	return newRPCTransaction(block.Transactions[index], block, index)
+}
+
+// GetTransactionReceipt returns the receipt of a transaction found through its
+// lookup entry, or null if it is not indexed
+func (api *EthAPI) GetTransactionReceipt(hash common.Hash) (map[string]interface{}, error) {
+	block, index, err := api.findTransaction(hash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	receipts, err := api.chain.Receipts(block)
+	if err != nil {
+		return nil, err
+	}
+	return marshalReceipt(receipts[index], block.Transactions[index])
+}
+
+// GetBalance returns the balance of address in the state of the given block
+func (api *EthAPI) GetBalance(address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	reader, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	account, err := reader.Account(address)
+	if err != nil || account == nil {
+		return (*hexutil.Big)(new(big.Int)), err
+	}
+	return (*hexutil.Big)(account.Balance.ToBig()), nil
+}
+
+// GetCode returns the code of address in the state of the given block
+func (api *EthAPI) GetCode(address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	reader, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	code, err := reader.Code(address)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Bytes(code), nil
+}
+
+// GetStorageAt returns a storage slot of address in the state of the given block
+func (api *EthAPI) GetStorageAt(address common.Address, slot string, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	key, err := decodeHash(slot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage slot: %w", err)
+	}
+	reader, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	value, err := reader.Storage(address, key)
+	if err != nil {
+		return nil, err
+	}
+	return value.Bytes(), nil
+}
+
+// resolveNumber turns a block tag into a number. Every chain served here is
+// final, so latest, safe, finalized and pending all name the head block.
+func (api *EthAPI) resolveNumber(number rpc.BlockNumber) (uint64, error) {
+	switch {
+	case number == rpc.EarliestBlockNumber:
+		return 0, nil
+	case number < 0:
+		head, _, err := api.chain.Head()
+		return head, err
+	}
+	return uint64(number), nil
+}
+
+// stateAt opens the state trie of the block named by blockNrOrHash
+func (api *EthAPI) stateAt(blockNrOrHash rpc.BlockNumberOrHash) (*state.Reader, error) {
+	header, err := api.headerAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return api.chain.State(header.Root)
+}
+
+// headerAt returns the header of the block named by blockNrOrHash
+func (api *EthAPI) headerAt(blockNrOrHash rpc.BlockNumberOrHash) (*migration.SubnetEVMHeader, error) {
+	var (
+		number uint64
+		hash   common.Hash
+		ok     bool
+	)
+	if h, isHash := blockNrOrHash.Hash(); isHash {
+		if number, ok = api.chain.Number(h); !ok {
+			return nil, fmt.Errorf("block %s not found", h.Hex())
+		}
+		hash = h
+		if canonical, _ := api.chain.CanonicalHash(number); blockNrOrHash.RequireCanonical && canonical != hash {
+			return nil, fmt.Errorf("block %s is not canonical", h.Hex())
+		}
+	} else if n, isNumber := blockNrOrHash.Number(); isNumber {
+		resolved, err := api.resolveNumber(n)
+		if err != nil {
+			return nil, err
+		}
+		number = resolved
+		if hash, ok = api.chain.CanonicalHash(number); !ok {
+			return nil, fmt.Errorf("block %d not found", number)
+		}
+	} else {
+		return nil, errors.New("invalid block number or hash")
+	}
+
+	header, err := api.chain.Header(number, hash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("header of block %d %s not found", number, hash.Hex())
+	}
+	return header, nil
+}
+
+// findTransaction returns the block holding a transaction and its index in it
+func (api *EthAPI) findTransaction(hash common.Hash) (*Block, int, error) {
+	number, ok := api.chain.TxBlock(hash)
+	if !ok {
+		return nil, 0, nil
+	}
+	block, err := api.chain.BlockByNumber(number)
+	if block == nil || err != nil {
+		return nil, 0, err
+	}
+	for i, tx := range block.Transactions {
+		if tx.Hash() == hash {
+			return block, i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("lookup entry of %s points at block %d, which does not include it", hash.Hex(), number)
+}
+
+// NetAPI serves the net namespace
+type NetAPI struct {
+	chain *Chain
+}
+
+// Version returns the chain ID as a decimal string, as geth does
+func (api *NetAPI) Version() (string, error) {
+	id, err := api.chain.ChainID()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// NewServer returns a JSON-RPC server with the eth and net namespaces over chain
+func NewServer(chain *Chain, config Config) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", NewEthAPI(chain, config)); err != nil {
+		return nil, fmt.Errorf("failed to register eth API: %w", err)
+	}
+	if err := server.RegisterName("net", &NetAPI{chain: chain}); err != nil {
+		return nil, fmt.Errorf("failed to register net API: %w", err)
+	}
+	return server, nil
+}
+
+// decodeHash parses a storage slot, which clients may send unpadded and with
+// an odd number of digits
+func decodeHash(s string) (common.Hash, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(b) > common.HashLength {
+		return common.Hash{}, fmt.Errorf("%d bytes, longer than a hash", len(b))
+	}
+	return common.BytesToHash(b), nil
+}
@@ -0,0 +1,322 @@
+package rpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/geth/accounts/abi"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/common/hexutil"
+	"github.com/luxfi/geth/core"
+	gethstate "github.com/luxfi/geth/core/state"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/core/vm"
+	"github.com/luxfi/geth/params"
+	"github.com/luxfi/geth/rpc"
+)
+
+// DefaultGasCap is the most gas a call or estimation may use, as in geth
+const DefaultGasCap = 50_000_000
+
+// callTimeout aborts an EVM run that takes longer, as geth's RPC EVM timeout does
+const callTimeout = 5 * time.Second
+
+// CallArgs are the transaction fields of eth_call and eth_estimateGas
+type CallArgs struct {
+	From                 *common.Address   `json:"from"`
+	To                   *common.Address   `json:"to"`
+	Gas                  *hexutil.Uint64   `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big      `json:"value"`
+	Data                 *hexutil.Bytes    `json:"data"`
+	Input                *hexutil.Bytes    `json:"input"`
+	AccessList           *types.AccessList `json:"accessList"`
+}
+
+// message turns the arguments into an EVM message. Unset fees are zero, which
+// the EVM accepts because calls run with the base fee check disabled.
+func (args *CallArgs) message(gas uint64, baseFee *big.Int) (*core.Message, error) {
+	if args.GasPrice != nil && (args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil) {
+		return nil, errors.New("both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified")
+	}
+	if args.Data != nil && args.Input != nil && string(*args.Data) != string(*args.Input) {
+		return nil, errors.New("both data and input are set and not equal")
+	}
+
+	msg := &core.Message{
+		To:               args.To,
+		Value:            new(big.Int),
+		GasLimit:         gas,
+		GasPrice:         new(big.Int),
+		GasFeeCap:        new(big.Int),
+		GasTipCap:        new(big.Int),
+		SkipNonceChecks:  true,
+		SkipFromEOACheck: true,
+	}
+	if args.From != nil {
+		msg.From = *args.From
+	}
+	if args.Value != nil {
+		msg.Value = args.Value.ToInt()
+	}
+	if args.Input != nil {
+		msg.Data = *args.Input
+	} else if args.Data != nil {
+		msg.Data = *args.Data
+	}
+	if args.AccessList != nil {
+		msg.AccessList = *args.AccessList
+	}
+	switch {
+	case args.GasPrice != nil:
+		msg.GasPrice = args.GasPrice.ToInt()
+		msg.GasFeeCap, msg.GasTipCap = msg.GasPrice, msg.GasPrice
+	case args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil:
+		if args.MaxFeePerGas != nil {
+			msg.GasFeeCap = args.MaxFeePerGas.ToInt()
+		}
+		if args.MaxPriorityFeePerGas != nil {
+			msg.GasTipCap = args.MaxPriorityFeePerGas.ToInt()
+		}
+		if msg.GasFeeCap.Cmp(msg.GasTipCap) < 0 {
+			return nil, errors.New("maxFeePerGas is less than maxPriorityFeePerGas")
+		}
+		msg.GasPrice = new(big.Int).Set(msg.GasFeeCap)
+		if baseFee != nil {
+			if price := new(big.Int).Add(msg.GasTipCap, baseFee); price.Cmp(msg.GasFeeCap) < 0 {
+				msg.GasPrice = price
+			}
+		}
+	}
+	return msg, nil
+}
+
+// callEnv is the block a call runs on top of
+type callEnv struct {
+	header  *migration.SubnetEVMHeader
+	config  *params.ChainConfig
+	context vm.BlockContext
+	state   *gethstate.StateDB
+}
+
+// callEnv opens the state of the block named by blockNrOrHash, latest if nil,
+// with the EVM rules the stored chain config gives that block
+func (api *EthAPI) callEnv(blockNrOrHash *rpc.BlockNumberOrHash) (*callEnv, error) {
+	if blockNrOrHash == nil {
+		latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		blockNrOrHash = &latest
+	}
+	header, err := api.headerAt(*blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, err := api.chain.ChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := api.chain.StateDB(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	config := chainConfig.At(header.Time)
+	return &callEnv{
+		header:  header,
+		config:  config,
+		context: api.blockContext(header, config),
+		state:   statedb,
+	}, nil
+}
+
+// blockContext describes the block to the EVM. geth only applies Shanghai and
+// later rules to post-merge blocks, which it tells apart by a set PREVRANDAO,
+// so the mix digest is passed as one whenever those rules are active.
+func (api *EthAPI) blockContext(header *migration.SubnetEVMHeader, config *params.ChainConfig) vm.BlockContext {
+	blockCtx := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash: func(n uint64) common.Hash {
+			hash, _ := api.chain.CanonicalHash(n)
+			return hash
+		},
+		Coinbase:    header.Coinbase,
+		GasLimit:    header.GasLimit,
+		BlockNumber: new(big.Int).Set(header.Number),
+		Time:        header.Time,
+		Difficulty:  new(big.Int).Set(header.Difficulty),
+		BaseFee:     new(big.Int),
+		// None of the chains served here have a blob market
+		BlobBaseFee: new(big.Int),
+	}
+	if header.BaseFee != nil {
+		blockCtx.BaseFee.Set(header.BaseFee)
+	}
+	if header.Difficulty.Sign() == 0 || config.IsShanghai(header.Number, header.Time) {
+		random := header.MixDigest
+		blockCtx.Random = &random
+	}
+	return blockCtx
+}
+
+// execute runs msg against statedb, which it modifies
+func (api *EthAPI) execute(ctx context.Context, env *callEnv, statedb *gethstate.StateDB, msg *core.Message) (*core.ExecutionResult, error) {
+	evm := vm.NewEVM(env.context, statedb, env.config, vm.Config{NoBaseFee: true})
+	evm.SetTxContext(core.NewEVMTxContext(msg))
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		evm.Cancel()
+	}()
+
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+	if evm.Cancelled() && ctx.Err() != nil {
+		return nil, fmt.Errorf("execution aborted (timeout = %v)", callTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("err: %w (supplied gas %d)", err, msg.GasLimit)
+	}
+	return result, nil
+}
+
+// Call runs a message against the state of a block without creating a
+// transaction and returns what it returned. A revert is reported as an
+// error carrying the revert data, as geth does.
+func (api *EthAPI) Call(ctx context.Context, args CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	env, err := api.callEnv(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	gas := api.gasCap
+	if args.Gas != nil && uint64(*args.Gas) < gas {
+		gas = uint64(*args.Gas)
+	}
+	msg, err := args.message(gas, env.header.BaseFee)
+	if err != nil {
+		return nil, err
+	}
+	msg.Nonce = env.state.GetNonce(msg.From)
+
+	result, err := api.execute(ctx, env, env.state, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Revert()) > 0 {
+		return nil, newRevertError(result.Revert())
+	}
+	return result.Return(), result.Err
+}
+
+// EstimateGas finds the lowest gas limit the message succeeds with in the
+// state of a block, by binary search between what one run used and the
+// lowest of the given gas, the block gas limit, the gas cap and what the
+// sender can pay for.
+func (api *EthAPI) EstimateGas(ctx context.Context, args CallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
+	env, err := api.callEnv(blockNrOrHash)
+	if err != nil {
+		return 0, err
+	}
+	hi := min(env.header.GasLimit, api.gasCap)
+	if args.Gas != nil && uint64(*args.Gas) >= params.TxGas {
+		hi = min(uint64(*args.Gas), api.gasCap)
+	}
+	msg, err := args.message(hi, env.header.BaseFee)
+	if err != nil {
+		return 0, err
+	}
+	msg.Nonce = env.state.GetNonce(msg.From)
+
+	if feeCap := msg.GasFeeCap; feeCap.Sign() > 0 {
+		balance := env.state.GetBalance(msg.From).ToBig()
+		if msg.Value.Cmp(balance) > 0 {
+			return 0, core.ErrInsufficientFundsForTransfer
+		}
+		allowance := new(big.Int).Div(new(big.Int).Sub(balance, msg.Value), feeCap)
+		if allowance.IsUint64() && allowance.Uint64() < hi {
+			hi = allowance.Uint64()
+		}
+	}
+
+	// run reports whether msg fails with the given gas; a limit below the
+	// intrinsic gas is a failure rather than an error
+	run := func(gas uint64) (bool, *core.ExecutionResult, error) {
+		msg.GasLimit = gas
+		result, err := api.execute(ctx, env, env.state.Copy(), msg)
+		if errors.Is(err, core.ErrIntrinsicGas) {
+			return true, nil, nil
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		return result.Failed(), result, nil
+	}
+
+	failed, result, err := run(hi)
+	if err != nil {
+		return 0, err
+	}
+	if failed {
+		if result != nil && !errors.Is(result.Err, vm.ErrOutOfGas) {
+			if len(result.Revert()) > 0 {
+				return 0, newRevertError(result.Revert())
+			}
+			return 0, result.Err
+		}
+		return 0, fmt.Errorf("gas required exceeds allowance (%d)", hi)
+	}
+
+	// Most calls succeed with a little more than they used once; try that first
+	lo := result.UsedGas - 1
+	if optimistic := (result.MaxUsedGas + params.CallStipend) * 64 / 63; optimistic < hi {
+		failed, _, err := run(optimistic)
+		if err != nil {
+			return 0, err
+		}
+		if failed {
+			lo = optimistic
+		} else {
+			hi = optimistic
+		}
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		failed, _, err := run(mid)
+		if err != nil {
+			return 0, err
+		}
+		if failed {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hexutil.Uint64(hi), nil
+}
+
+// revertError is a reverted call. The rpc package sends its code and data
+// with the error, so clients can decode the revert reason.
+type revertError struct {
+	error
+	data string
+}
+
+func newRevertError(revert []byte) *revertError {
+	err := vm.ErrExecutionReverted
+	if reason, unpackErr := abi.UnpackRevert(revert); unpackErr == nil {
+		err = fmt.Errorf("%w: %v", vm.ErrExecutionReverted, reason)
+	}
+	return &revertError{error: err, data: hexutil.Encode(revert)}
+}
+
+// ErrorCode returns the JSON-RPC error code geth uses for reverts
+func (e *revertError) ErrorCode() int { return 3 }
+
+// ErrorData returns the hex-encoded revert data
+func (e *revertError) ErrorData() interface{} { return e.data }
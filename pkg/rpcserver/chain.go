@@ -0,0 +1,284 @@
+// Package rpcserver serves a read-only Ethereum JSON-RPC API straight from a
+// chain database, without a running node. Blocks, receipts and state are read
+// from the raw geth, coreth and Subnet-EVM tables, whatever header layout or
+// receipt schema they were stored with.
+package rpcserver
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	gethstate "github.com/luxfi/geth/core/state"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/triedb"
+)
+
+// headKeys are the pointers tried, in order, to find the head block
+var headKeys = [][]byte{[]byte("LastBlock"), []byte("LastHeader"), []byte("AcceptorTipKey")}
+
+// Block is a stored block with its header decoded in its own layout
+type Block struct {
+	Hash         common.Hash
+	Header       *migration.SubnetEVMHeader
+	Transactions types.Transactions
+	Uncles       []common.Hash
+	// Size is the encoded size of the block, header and body together
+	Size uint64
+}
+
+// Number returns the block number
+func (b *Block) Number() uint64 {
+	return b.Header.Number.Uint64()
+}
+
+// Chain reads blocks, receipts and state from a chain database through the
+// rawdb accessors, so blocks moved into a freezer are served too. Namespaced
+// databases must be wrapped with rawdb.NewTable first.
+type Chain struct {
+	db ethdb.Database
+}
+
+// NewChain returns a reader over db
+func NewChain(db ethdb.Database) *Chain {
+	return &Chain{db: db}
+}
+
+// Head returns the number and hash of the head block: the first of LastBlock,
+// LastHeader and AcceptorTipKey that points at a block with a header
+func (c *Chain) Head() (uint64, common.Hash, error) {
+	for _, key := range headKeys {
+		value, _ := c.db.Get(key)
+		if len(value) != common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(value)
+		if number, ok := c.Number(hash); ok {
+			if rawdb.HasHeader(c.db, hash, number) {
+				return number, hash, nil
+			}
+		}
+	}
+	return 0, common.Hash{}, errors.New("no head block: LastBlock, LastHeader and AcceptorTipKey are missing or point at missing headers")
+}
+
+// CanonicalHash returns the hash of the canonical block at number
+func (c *Chain) CanonicalHash(number uint64) (common.Hash, bool) {
+	hash := rawdb.ReadCanonicalHash(c.db, number)
+	return hash, hash != (common.Hash{})
+}
+
+// Number returns the number of the block with the given hash
+func (c *Chain) Number(hash common.Hash) (uint64, bool) {
+	return rawdb.ReadHeaderNumber(c.db, hash)
+}
+
+// Header returns the decoded header of a block, or nil if it is not stored
+func (c *Chain) Header(number uint64, hash common.Hash) (*migration.SubnetEVMHeader, error) {
+	header, _, err := c.readHeader(number, hash)
+	return header, err
+}
+
+func (c *Chain) readHeader(number uint64, hash common.Hash) (*migration.SubnetEVMHeader, []byte, error) {
+	data := rawdb.ReadHeaderRLP(c.db, hash, number)
+	if len(data) == 0 {
+		return nil, nil, nil
+	}
+	header := new(migration.SubnetEVMHeader)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, nil, fmt.Errorf("invalid header of block %d %s: %w", number, hash.Hex(), err)
+	}
+	return header, data, nil
+}
+
+// BlockByNumber returns the canonical block at number, or nil if there is none
+func (c *Chain) BlockByNumber(number uint64) (*Block, error) {
+	hash, ok := c.CanonicalHash(number)
+	if !ok {
+		return nil, nil
+	}
+	return c.block(number, hash)
+}
+
+// BlockByHash returns the block with the given hash, or nil if it is not stored
+func (c *Chain) BlockByHash(hash common.Hash) (*Block, error) {
+	number, ok := c.Number(hash)
+	if !ok {
+		return nil, nil
+	}
+	return c.block(number, hash)
+}
+
+// block reads a header and its body. Only the leading transaction and uncle
+// lists of the body are decoded, so coreth's extra body fields are skipped.
+func (c *Chain) block(number uint64, hash common.Hash) (*Block, error) {
+	header, headerData, err := c.readHeader(number, hash)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	block := &Block{Hash: hash, Header: header}
+
+	body := rawdb.ReadBodyRLP(c.db, hash, number)
+	if len(body) == 0 {
+		// Header-only syncs leave headers without bodies; serve them as empty blocks
+		block.Size = rlp.ListSize(uint64(len(headerData)) + 2)
+		return block, nil
+	}
+	fields, _, err := rlp.SplitList(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body of block %d %s: %w", number, hash.Hex(), err)
+	}
+	block.Size = rlp.ListSize(uint64(len(headerData) + len(fields)))
+
+	txs := firstItem(fields)
+	if err := rlp.DecodeBytes(txs, &block.Transactions); err != nil {
+		return nil, fmt.Errorf("invalid transactions in block %d %s: %w", number, hash.Hex(), err)
+	}
+	if rest := fields[len(txs):]; len(rest) > 0 {
+		var uncles []rlp.RawValue
+		if err := rlp.DecodeBytes(firstItem(rest), &uncles); err != nil {
+			return nil, fmt.Errorf("invalid uncles in block %d %s: %w", number, hash.Hex(), err)
+		}
+		for _, uncle := range uncles {
+			block.Uncles = append(block.Uncles, crypto.Keccak256Hash(uncle))
+		}
+	}
+	return block, nil
+}
+
+// Receipts returns the receipts of a block with every derived field filled
+// in: transaction and block context, gas used, effective gas price, contract
+// address, bloom and log positions
+func (c *Chain) Receipts(block *Block) ([]*types.Receipt, error) {
+	data := rawdb.ReadReceiptsRLP(c.db, block.Hash, block.Number())
+	if len(data) == 0 {
+		if len(block.Transactions) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("receipts of block %d %s are missing", block.Number(), block.Hash.Hex())
+	}
+	receipts, _, err := database.DecodeStoredReceipts(data)
+	if err != nil {
+		return nil, fmt.Errorf("block %d %s: %w", block.Number(), block.Hash.Hex(), err)
+	}
+	if len(receipts) != len(block.Transactions) {
+		return nil, fmt.Errorf("block %d %s has %d receipts for %d transactions",
+			block.Number(), block.Hash.Hex(), len(receipts), len(block.Transactions))
+	}
+
+	var cumulative uint64
+	logIndex := uint(0)
+	for i, r := range receipts {
+		tx := block.Transactions[i]
+		r.Type = tx.Type()
+		r.TxHash = tx.Hash()
+		r.BlockHash = block.Hash
+		r.BlockNumber = new(big.Int).SetUint64(block.Number())
+		r.TransactionIndex = uint(i)
+		r.GasUsed = r.CumulativeGasUsed - cumulative
+		cumulative = r.CumulativeGasUsed
+		r.EffectiveGasPrice = effectiveGasPrice(tx, block.Header.BaseFee)
+		if tx.To() == nil {
+			if from, err := sender(tx); err == nil {
+				r.ContractAddress = crypto.CreateAddress(from, tx.Nonce())
+			}
+		}
+		r.Bloom = types.CreateBloom(r)
+		for _, log := range r.Logs {
+			log.BlockNumber = block.Number()
+			log.BlockHash = block.Hash
+			log.TxHash = r.TxHash
+			log.TxIndex = uint(i)
+			log.Index = logIndex
+			logIndex++
+		}
+	}
+	return receipts, nil
+}
+
+// TxBlock returns the number of the block a transaction was included in,
+// from any of the lookup entry layouts
+func (c *Chain) TxBlock(hash common.Hash) (uint64, bool) {
+	number := rawdb.ReadTxLookupEntry(c.db, hash)
+	if number == nil {
+		return 0, false
+	}
+	return *number, true
+}
+
+// ChainConfig reads the chain config stored under the genesis hash
+func (c *Chain) ChainConfig() (*ChainConfig, error) {
+	genesis, ok := c.CanonicalHash(0)
+	if !ok {
+		return nil, errors.New("no genesis block")
+	}
+	data, _ := c.db.Get(append([]byte("ethereum-config-"), genesis.Bytes()...))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no chain config for genesis %s", genesis.Hex())
+	}
+	return parseChainConfig(data)
+}
+
+// ChainID returns the chain ID of the stored chain config
+func (c *Chain) ChainID() (*big.Int, error) {
+	config, err := c.ChainConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.ChainID == nil {
+		return nil, errors.New("chain config has no chainId")
+	}
+	return config.ChainID, nil
+}
+
+// State opens the state trie at root for point lookups
+func (c *Chain) State(root common.Hash) (*state.Reader, error) {
+	return state.NewReader(c.db, root)
+}
+
+// StateDB opens the state at root for running the EVM. Changes made to it
+// stay in memory.
+func (c *Chain) StateDB(root common.Hash) (*gethstate.StateDB, error) {
+	statedb, err := gethstate.New(root, gethstate.NewDatabase(triedb.NewDatabase(c.db, triedb.HashDefaults), nil))
+	if err != nil {
+		return nil, fmt.Errorf("state %s is not available: %w", root.Hex(), err)
+	}
+	return statedb, nil
+}
+
+// effectiveGasPrice is what the sender paid per gas: the gas price of legacy
+// transactions, and the base fee plus the capped tip of dynamic-fee ones
+func effectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasPrice()
+	}
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		return tx.GasFeeCap()
+	}
+	return tip.Add(tip, baseFee)
+}
+
+// sender recovers the sender with the signer matching the transaction's own
+// chain ID, so no chain config is needed
+func sender(tx *types.Transaction) (common.Address, error) {
+	return types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+}
+
+// firstItem returns the first encoded item of a list's content, or all of it
+// when it cannot be split so that decoding reports the error
+func firstItem(list []byte) []byte {
+	_, _, rest, err := rlp.Split(list)
+	if err != nil {
+		return list
+	}
+	return list[:len(list)-len(rest)]
+}
@@ -0,0 +1,94 @@
+package rpcserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/luxfi/geth/params"
+)
+
+// EVM rule sets, in activation order, that coreth and Subnet-EVM upgrades map to
+const (
+	rulesBerlin = iota + 1
+	rulesLondon
+	rulesShanghai
+	rulesCancun
+)
+
+// networkUpgrades are the timestamp-scheduled upgrades of coreth and
+// Subnet-EVM configs and the geth rule set each one brings the EVM to.
+// Neither stores berlinBlock or londonBlock once these replaced them.
+var networkUpgrades = []struct {
+	key   string
+	rules int
+}{
+	{"apricotPhase2BlockTimestamp", rulesBerlin},
+	{"apricotPhase3BlockTimestamp", rulesLondon},
+	{"subnetEVMTimestamp", rulesLondon},
+	{"durangoBlockTimestamp", rulesShanghai},
+	{"durangoTimestamp", rulesShanghai},
+	{"etnaTimestamp", rulesCancun},
+}
+
+// ChainConfig is a stored chain config together with the network upgrade
+// timestamps geth's config has no fields for
+type ChainConfig struct {
+	*params.ChainConfig
+	upgrades map[string]uint64
+}
+
+// parseChainConfig decodes a stored chain config
+func parseChainConfig(data []byte) (*ChainConfig, error) {
+	config := &ChainConfig{ChainConfig: new(params.ChainConfig), upgrades: make(map[string]uint64)}
+	if err := json.Unmarshal(data, config.ChainConfig); err != nil {
+		return nil, fmt.Errorf("invalid chain config: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid chain config: %w", err)
+	}
+	for _, upgrade := range networkUpgrades {
+		raw, ok := fields[upgrade.key]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var timestamp uint64
+		if err := json.Unmarshal(raw, &timestamp); err != nil {
+			return nil, fmt.Errorf("invalid chain config %s: %w", upgrade.key, err)
+		}
+		config.upgrades[upgrade.key] = timestamp
+	}
+	return config, nil
+}
+
+// At returns a geth config whose EVM rules at a block with the given
+// timestamp match the chain's. Forks the stored config leaves unset are
+// enabled from genesis once the network upgrade that replaced them is active.
+func (c *ChainConfig) At(time uint64) *params.ChainConfig {
+	active := 0
+	for _, upgrade := range networkUpgrades {
+		if timestamp, ok := c.upgrades[upgrade.key]; ok && timestamp <= time {
+			active = max(active, upgrade.rules)
+		}
+	}
+	if active == 0 {
+		return c.ChainConfig
+	}
+
+	config := *c.ChainConfig
+	zero := uint64(0)
+	if config.BerlinBlock == nil {
+		config.BerlinBlock = new(big.Int)
+	}
+	if active >= rulesLondon && config.LondonBlock == nil {
+		config.LondonBlock = new(big.Int)
+	}
+	if active >= rulesShanghai && config.ShanghaiTime == nil {
+		config.ShanghaiTime = &zero
+	}
+	if active >= rulesCancun && config.CancunTime == nil {
+		config.CancunTime = &zero
+	}
+	return &config
+}
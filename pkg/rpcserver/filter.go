@@ -0,0 +1,204 @@
+package rpcserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/rpc"
+)
+
+// FilterCriteria are the eth_getLogs parameters. A block hash excludes a
+// block range; unset range ends default to the head block.
+type FilterCriteria struct {
+	BlockHash *common.Hash
+	FromBlock *rpc.BlockNumber
+	ToBlock   *rpc.BlockNumber
+	Addresses []common.Address
+	// Topics holds the allowed topics per position; an empty position matches any
+	Topics [][]common.Hash
+}
+
+// UnmarshalJSON accepts an address and each topic position either as a single
+// value or as a list, as geth does
+func (c *FilterCriteria) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		BlockHash *common.Hash      `json:"blockHash"`
+		FromBlock *rpc.BlockNumber  `json:"fromBlock"`
+		ToBlock   *rpc.BlockNumber  `json:"toBlock"`
+		Addresses json.RawMessage   `json:"address"`
+		Topics    []json.RawMessage `json:"topics"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.BlockHash != nil && (raw.FromBlock != nil || raw.ToBlock != nil) {
+		return errors.New("cannot specify both blockHash and fromBlock/toBlock")
+	}
+	*c = FilterCriteria{BlockHash: raw.BlockHash, FromBlock: raw.FromBlock, ToBlock: raw.ToBlock}
+
+	if err := unmarshalOneOrMany(raw.Addresses, &c.Addresses); err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	for i, position := range raw.Topics {
+		var topics []*common.Hash
+		if err := unmarshalOneOrMany(position, &topics); err != nil {
+			return fmt.Errorf("invalid topic %d: %w", i, err)
+		}
+		var allowed []common.Hash
+		for _, topic := range topics {
+			if topic == nil {
+				// A null inside a list matches anything, like a null position
+				allowed = nil
+				break
+			}
+			allowed = append(allowed, *topic)
+		}
+		c.Topics = append(c.Topics, allowed)
+	}
+	return nil
+}
+
+// unmarshalOneOrMany decodes a JSON value that is either a single T or a list
+// of them. null leaves out unchanged.
+func unmarshalOneOrMany[T any](data json.RawMessage, out *[]T) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	if data[0] == '[' {
+		return json.Unmarshal(data, out)
+	}
+	var one T
+	if err := json.Unmarshal(data, &one); err != nil {
+		return err
+	}
+	*out = []T{one}
+	return nil
+}
+
+// GetLogs returns the logs matching crit. Ranges longer than the configured
+// maximum are refused; blocks whose bloom cannot match are skipped without
+// reading their receipts.
+func (api *EthAPI) GetLogs(crit FilterCriteria) ([]*types.Log, error) {
+	if crit.BlockHash != nil {
+		block, err := api.chain.BlockByHash(*crit.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, fmt.Errorf("block %s not found", crit.BlockHash.Hex())
+		}
+		return api.blockLogs(block, crit)
+	}
+
+	from, to := rpc.LatestBlockNumber, rpc.LatestBlockNumber
+	if crit.FromBlock != nil {
+		from = *crit.FromBlock
+	}
+	if crit.ToBlock != nil {
+		to = *crit.ToBlock
+	}
+	begin, err := api.resolveNumber(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := api.resolveNumber(to)
+	if err != nil {
+		return nil, err
+	}
+	if begin > end {
+		return nil, fmt.Errorf("invalid block range %d-%d", begin, end)
+	}
+	if end-begin >= api.maxLogRange {
+		return nil, fmt.Errorf("block range %d-%d exceeds the limit of %d blocks", begin, end, api.maxLogRange)
+	}
+
+	logs := []*types.Log{}
+	for n := begin; n <= end; n++ {
+		hash, ok := api.chain.CanonicalHash(n)
+		if !ok {
+			continue
+		}
+		header, err := api.chain.Header(n, hash)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil || !bloomMatches(header.Bloom, crit) {
+			continue
+		}
+		block, err := api.chain.block(n, hash)
+		if err != nil {
+			return nil, err
+		}
+		matched, err := api.blockLogs(block, crit)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, matched...)
+	}
+	return logs, nil
+}
+
+// blockLogs returns the logs of block that match crit
+func (api *EthAPI) blockLogs(block *Block, crit FilterCriteria) ([]*types.Log, error) {
+	receipts, err := api.chain.Receipts(block)
+	if err != nil {
+		return nil, err
+	}
+	logs := []*types.Log{}
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			if logMatches(log, crit) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// bloomMatches reports whether a block bloom may hold a matching log
+func bloomMatches(bloom types.Bloom, crit FilterCriteria) bool {
+	if len(crit.Addresses) > 0 {
+		included := false
+		for _, address := range crit.Addresses {
+			if types.BloomLookup(bloom, address) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, position := range crit.Topics {
+		included := len(position) == 0
+		for _, topic := range position {
+			if types.BloomLookup(bloom, topic) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return true
+}
+
+func logMatches(log *types.Log, crit FilterCriteria) bool {
+	if len(crit.Addresses) > 0 && !slices.Contains(crit.Addresses, log.Address) {
+		return false
+	}
+	if len(crit.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, position := range crit.Topics {
+		if len(position) > 0 && !slices.Contains(position, log.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package rpcserver
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/common/hexutil"
+	"github.com/luxfi/geth/core/types"
+)
+
+// RPCTransaction is a transaction as returned by eth_getTransactionByHash and
+// in full blocks, with the same fields geth returns
+type RPCTransaction struct {
+	BlockHash           *common.Hash                 `json:"blockHash"`
+	BlockNumber         *hexutil.Big                 `json:"blockNumber"`
+	From                common.Address               `json:"from"`
+	Gas                 hexutil.Uint64               `json:"gas"`
+	GasPrice            *hexutil.Big                 `json:"gasPrice"`
+	GasFeeCap           *hexutil.Big                 `json:"maxFeePerGas,omitempty"`
+	GasTipCap           *hexutil.Big                 `json:"maxPriorityFeePerGas,omitempty"`
+	MaxFeePerBlobGas    *hexutil.Big                 `json:"maxFeePerBlobGas,omitempty"`
+	Hash                common.Hash                  `json:"hash"`
+	Input               hexutil.Bytes                `json:"input"`
+	Nonce               hexutil.Uint64               `json:"nonce"`
+	To                  *common.Address              `json:"to"`
+	TransactionIndex    *hexutil.Uint64              `json:"transactionIndex"`
+	Value               *hexutil.Big                 `json:"value"`
+	Type                hexutil.Uint64               `json:"type"`
+	Accesses            *types.AccessList            `json:"accessList,omitempty"`
+	ChainID             *hexutil.Big                 `json:"chainId,omitempty"`
+	BlobVersionedHashes []common.Hash                `json:"blobVersionedHashes,omitempty"`
+	AuthorizationList   []types.SetCodeAuthorization `json:"authorizationList,omitempty"`
+	V                   *hexutil.Big                 `json:"v"`
+	R                   *hexutil.Big                 `json:"r"`
+	S                   *hexutil.Big                 `json:"s"`
+	YParity             *hexutil.Uint64              `json:"yParity,omitempty"`
+}
+
+// newRPCTransaction describes the transaction at index in block
+func newRPCTransaction(tx *types.Transaction, block *Block, index int) (*RPCTransaction, error) {
+	from, err := sender(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover sender of %s: %w", tx.Hash().Hex(), err)
+	}
+	v, r, s := tx.RawSignatureValues()
+	txIndex := hexutil.Uint64(index)
+	result := &RPCTransaction{
+		BlockHash:        &block.Hash,
+		BlockNumber:      (*hexutil.Big)(new(big.Int).SetUint64(block.Number())),
+		From:             from,
+		Gas:              hexutil.Uint64(tx.Gas()),
+		GasPrice:         (*hexutil.Big)(effectiveGasPrice(tx, block.Header.BaseFee)),
+		Hash:             tx.Hash(),
+		Input:            hexutil.Bytes(tx.Data()),
+		Nonce:            hexutil.Uint64(tx.Nonce()),
+		To:               tx.To(),
+		TransactionIndex: &txIndex,
+		Value:            (*hexutil.Big)(tx.Value()),
+		Type:             hexutil.Uint64(tx.Type()),
+		V:                (*hexutil.Big)(v),
+		R:                (*hexutil.Big)(r),
+		S:                (*hexutil.Big)(s),
+	}
+	if tx.Type() == types.LegacyTxType {
+		if tx.Protected() {
+			result.ChainID = (*hexutil.Big)(tx.ChainId())
+		}
+		return result, nil
+	}
+
+	al := tx.AccessList()
+	yParity := hexutil.Uint64(v.Sign())
+	result.Accesses = &al
+	result.ChainID = (*hexutil.Big)(tx.ChainId())
+	result.YParity = &yParity
+	if tx.Type() != types.AccessListTxType {
+		result.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
+		result.GasTipCap = (*hexutil.Big)(tx.GasTipCap())
+	}
+	if tx.Type() == types.BlobTxType {
+		result.MaxFeePerBlobGas = (*hexutil.Big)(tx.BlobGasFeeCap())
+		result.BlobVersionedHashes = tx.BlobHashes()
+	}
+	if tx.Type() == types.SetCodeTxType {
+		result.AuthorizationList = tx.SetCodeAuthorizations()
+	}
+	return result, nil
+}
+
+// marshalBlock describes a block the way eth_getBlockBy* does. The optional
+// header fields are included only when the block's layout has them.
+func marshalBlock(block *Block, fullTx bool) (map[string]interface{}, error) {
+	h := block.Header
+	fields := map[string]interface{}{
+		"number":           (*hexutil.Big)(h.Number),
+		"hash":             block.Hash,
+		"parentHash":       h.ParentHash,
+		"nonce":            h.Nonce,
+		"mixHash":          h.MixDigest,
+		"sha3Uncles":       h.UncleHash,
+		"logsBloom":        h.Bloom,
+		"stateRoot":        h.Root,
+		"miner":            h.Coinbase,
+		"difficulty":       (*hexutil.Big)(h.Difficulty),
+		"extraData":        hexutil.Bytes(h.Extra),
+		"gasLimit":         hexutil.Uint64(h.GasLimit),
+		"gasUsed":          hexutil.Uint64(h.GasUsed),
+		"timestamp":        hexutil.Uint64(h.Time),
+		"transactionsRoot": h.TxHash,
+		"receiptsRoot":     h.ReceiptHash,
+		"size":             hexutil.Uint64(block.Size),
+		"uncles":           emptyIfNil(block.Uncles),
+	}
+	if h.BaseFee != nil {
+		fields["baseFeePerGas"] = (*hexutil.Big)(h.BaseFee)
+	}
+	if h.BlockGasCost != nil {
+		fields["blockGasCost"] = (*hexutil.Big)(h.BlockGasCost)
+	}
+	if h.ExtDataGasUsed != nil {
+		fields["extDataHash"] = h.ExtDataHash
+		fields["extDataGasUsed"] = (*hexutil.Big)(h.ExtDataGasUsed)
+	}
+	if h.WithdrawalsHash != nil {
+		fields["withdrawalsRoot"] = h.WithdrawalsHash
+	}
+	if h.BlobGasUsed != nil {
+		fields["blobGasUsed"] = hexutil.Uint64(*h.BlobGasUsed)
+	}
+	if h.ExcessBlobGas != nil {
+		fields["excessBlobGas"] = hexutil.Uint64(*h.ExcessBlobGas)
+	}
+	if h.ParentBeaconBlockRoot != nil {
+		fields["parentBeaconBlockRoot"] = h.ParentBeaconBlockRoot
+	}
+	if h.RequestsHash != nil {
+		fields["requestsHash"] = h.RequestsHash
+	}
+
+	txs := make([]interface{}, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		if !fullTx {
+			txs[i] = tx.Hash()
+			continue
+		}
+		rpcTx, err := newRPCTransaction(tx, block, i)
+		if err != nil {
+			return nil, err
+		}
+		txs[i] = rpcTx
+	}
+	fields["transactions"] = txs
+	return fields, nil
+}
+
+// marshalReceipt describes a receipt the way eth_getTransactionReceipt does
+func marshalReceipt(receipt *types.Receipt, tx *types.Transaction) (map[string]interface{}, error) {
+	from, err := sender(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover sender of %s: %w", tx.Hash().Hex(), err)
+	}
+	fields := map[string]interface{}{
+		"blockHash":         receipt.BlockHash,
+		"blockNumber":       hexutil.Uint64(receipt.BlockNumber.Uint64()),
+		"transactionHash":   receipt.TxHash,
+		"transactionIndex":  hexutil.Uint64(receipt.TransactionIndex),
+		"from":              from,
+		"to":                tx.To(),
+		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"effectiveGasPrice": (*hexutil.Big)(receipt.EffectiveGasPrice),
+		"contractAddress":   nil,
+		"logs":              emptyIfNil(receipt.Logs),
+		"logsBloom":         receipt.Bloom,
+		"type":              hexutil.Uint(tx.Type()),
+	}
+	if len(receipt.PostState) > 0 {
+		fields["root"] = hexutil.Bytes(receipt.PostState)
+	} else {
+		fields["status"] = hexutil.Uint(receipt.Status)
+	}
+	if receipt.ContractAddress != (common.Address{}) {
+		fields["contractAddress"] = receipt.ContractAddress
+	}
+	return fields, nil
+}
+
+// emptyIfNil makes nil slices encode as [] rather than null
+func emptyIfNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
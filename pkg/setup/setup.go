@@ -1,16 +1,13 @@
 package setup
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
-	"path/filepath"
 
-	"github.com/luxfi/database"
-	"github.com/luxfi/database/manager"
 	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
 	"github.com/luxfi/geth/common"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/luxfi/geth/ethdb"
 )
 
 // ChainStateManager handles chain state setup operations
@@ -35,51 +32,14 @@ var (
 	heightKey   = []byte("height")
 )
 
-// openDatabase opens a database for setup operations
-func (c *ChainStateManager) openDatabase(dbPath string) (database.Database, error) {
-	// Auto-detect database type
-	dbType := c.detectDatabaseType(dbPath)
-
-	// Create database manager
-	dbManager := manager.NewManager(filepath.Dir(dbPath), prometheus.NewRegistry())
-
-	// Configure database
-	config := &manager.Config{
-		Type:      dbType,
-		Path:      filepath.Base(dbPath),
-		Namespace: "setup",
-		CacheSize: 512, // MB
-		HandleCap: 1024,
-		ReadOnly:  false,
-	}
-
-	return dbManager.New(config)
-}
-
-// detectDatabaseType tries to determine the database type
-func (c *ChainStateManager) detectDatabaseType(dbPath string) string {
-	// Check for PebbleDB markers (SST files)
-	matches, _ := filepath.Glob(filepath.Join(dbPath, "*.sst"))
-	if len(matches) > 0 {
-		return "pebbledb"
-	}
-
-	// Check for LevelDB markers (LDB files)
-	matches, _ = filepath.Glob(filepath.Join(dbPath, "*.ldb"))
-	if len(matches) > 0 {
-		return "leveldb"
-	}
-
-	// Default to PebbleDB
-	return "pebbledb"
-}
-
-// SetupChainState sets up C-Chain state with imported blockchain data
+// SetupChainState points the C-chain head at the canonical block at
+// targetHeight, or at the highest block when targetHeight is 0. The keys are
+// written by WriteVMState, so the same checks apply and the VM metadata
+// database is left alone.
 func (c *ChainStateManager) SetupChainState(dbPath string, targetHeight uint64) error {
 	c.app.Log.Info("Setting up chain state", "path", dbPath, "targetHeight", targetHeight)
 
-	// Open database
-	db, err := c.openDatabase(dbPath)
+	db, err := database.OpenKeyValueStore("", dbPath, database.BackendOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -96,74 +56,32 @@ func (c *ChainStateManager) SetupChainState(dbPath string, targetHeight uint64)
 		c.app.Log.Info("Found highest block", "height", highestBlock, "hash", highestHash.Hex())
 	}
 
-	// Find the block hash for target height
-	blockHash, err := c.getBlockHash(db, targetHeight)
+	report, err := WriteVMState(db, nil, targetHeight)
 	if err != nil {
-		return fmt.Errorf("failed to get block hash for height %d: %w", targetHeight, err)
-	}
-
-	c.app.Log.Info("Target block", "height", targetHeight, "hash", blockHash.Hex())
-
-	// Create a batch for atomic updates
-	batch := db.NewBatch()
-
-	// Set head block references
-	c.app.Log.Info("Setting head block references...")
-
-	// Set LastHeader
-	if err := batch.Put(lastHeaderKey, blockHash[:]); err != nil {
-		return fmt.Errorf("failed to set LastHeader: %w", err)
-	}
-
-	// Set LastBlock
-	if err := batch.Put(lastBlockKey, blockHash[:]); err != nil {
-		return fmt.Errorf("failed to set LastBlock: %w", err)
-	}
-
-	// Set LastFast
-	if err := batch.Put(lastFastBlockKey, blockHash[:]); err != nil {
-		return fmt.Errorf("failed to set LastFast: %w", err)
-	}
-
-	// Set accepted block for consensus
-	if err := batch.Put(acceptedKey, blockHash[:]); err != nil {
-		return fmt.Errorf("failed to set lastAccepted: %w", err)
-	}
-
-	// Set height
-	heightBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(heightBytes, targetHeight)
-	if err := batch.Put(heightKey, heightBytes); err != nil {
-		return fmt.Errorf("failed to set height: %w", err)
-	}
-
-	// Commit all changes
-	c.app.Log.Info("Committing chain state...")
-	if err := batch.Write(); err != nil {
-		return fmt.Errorf("failed to commit batch: %w", err)
+		return err
 	}
 
 	fmt.Printf("\n✅ Chain state setup complete!\n")
-	fmt.Printf("   Height: %d\n", targetHeight)
-	fmt.Printf("   Hash: %s\n", blockHash.Hex())
-	fmt.Printf("\nThe C-Chain should now recognize block %d as the current head.\n", targetHeight)
+	fmt.Printf("   Height: %d\n", report.Height)
+	fmt.Printf("   Hash: %s\n", report.Hash.Hex())
+	fmt.Printf("\nThe C-Chain should now recognize block %d as the current head.\n", report.Height)
 
 	return nil
 }
 
-func (c *ChainStateManager) findHighestBlock(db database.Database) (uint64, common.Hash, error) {
+func (c *ChainStateManager) findHighestBlock(db ethdb.Iteratee) (uint64, common.Hash, error) {
 	var highestNum uint64
 	var highestHash common.Hash
 
-	// Iterate through canonical hash mappings
-	iter := db.NewIteratorWithPrefix([]byte("H"))
+	// Iterate through the hash-to-number entries
+	iter := db.NewIterator([]byte("H"), nil)
 	defer iter.Release()
 
 	for iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
 
-		// Canonical hash keys are "H" + hash -> number
+		// Hash-to-number keys are "H" + hash -> number
 		if len(key) == 33 && key[0] == 'H' && len(value) == 8 {
 			blockNum := binary.BigEndian.Uint64(value)
 			if blockNum > highestNum {
@@ -179,41 +97,3 @@ func (c *ChainStateManager) findHighestBlock(db database.Database) (uint64, comm
 
 	return highestNum, highestHash, nil
 }
-
-func (c *ChainStateManager) getBlockHash(db database.Database, blockNum uint64) (common.Hash, error) {
-	// Look for canonical hash at this height
-	// The key format for canonical hash is: "h" + num (8 bytes) + "n"
-	numBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(numBytes, blockNum)
-
-	canonicalKey := append([]byte("h"), numBytes...)
-	canonicalKey = append(canonicalKey, []byte("n")...)
-
-	value, err := db.Get(canonicalKey)
-	if err != nil {
-		// Try alternative format - iterate through headers at this height
-		headerPrefix := append([]byte("h"), numBytes...)
-
-		iter := db.NewIteratorWithPrefix(headerPrefix)
-		defer iter.Release()
-
-		for iter.Next() {
-			key := iter.Key()
-			if len(key) == 41 && bytes.HasPrefix(key, headerPrefix) {
-				var hash common.Hash
-				copy(hash[:], key[9:41])
-				return hash, nil
-			}
-		}
-
-		return common.Hash{}, fmt.Errorf("no canonical hash found for block %d", blockNum)
-	}
-
-	if len(value) != 32 {
-		return common.Hash{}, fmt.Errorf("invalid hash length: %d", len(value))
-	}
-
-	var hash common.Hash
-	copy(hash[:], value)
-	return hash, nil
-}
@@ -0,0 +1,126 @@
+package setup
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// acceptorTipKey is where coreth restores its last accepted block from; the
+// vm* keys live in the VM metadata database rather than in ethdb
+var (
+	acceptorTipKey      = []byte("AcceptorTipKey")
+	vmLastAcceptedKey   = []byte("lastAccepted")
+	vmLastHeightKey     = []byte("lastAcceptedHeight")
+	vmInitializedKey    = []byte("initialized")
+	vmInitializedMarker = []byte{1}
+)
+
+// VMStateWrite is a single key written by WriteVMState
+type VMStateWrite struct {
+	DB    string // "ethdb" or "vm"
+	Key   string
+	Value []byte
+}
+
+// VMStateReport lists the block the VM state was pointed at and every key written
+type VMStateReport struct {
+	Height uint64
+	Hash   common.Hash
+	Root   common.Hash
+	Writes []VMStateWrite
+}
+
+// Print writes the target block and each key with its value
+func (r *VMStateReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Target block: #%d %s (state root %s)\n", r.Height, r.Hash.Hex(), r.Root.Hex())
+	for _, write := range r.Writes {
+		fmt.Fprintf(w, "  %-5s %-20s = 0x%x\n", write.DB, write.Key, write.Value)
+	}
+}
+
+// WriteVMState points everything luxd's C-chain VM reads on startup at the
+// canonical block at height: the geth head pointers, AcceptorTipKey and the
+// snowman_lastAccepted and height keys in ethdb, and lastAccepted,
+// lastAcceptedHeight and initialized in the VM metadata database. vmdb may be
+// nil to only update ethdb. The block must have a canonical hash, a header
+// whose hash-to-number entry matches and a body; nothing is written otherwise.
+func WriteVMState(db ethdb.KeyValueStore, vmdb ethdb.KeyValueWriter, height uint64) (*VMStateReport, error) {
+	hash, root, err := validateBlock(db, height)
+	if err != nil {
+		return nil, err
+	}
+	report := &VMStateReport{Height: height, Hash: hash, Root: root}
+
+	heightBytes := binary.BigEndian.AppendUint64(nil, height)
+	ethWrites := []VMStateWrite{
+		{"ethdb", string(lastHeaderKey), hash.Bytes()},
+		{"ethdb", string(lastBlockKey), hash.Bytes()},
+		{"ethdb", string(lastFastBlockKey), hash.Bytes()},
+		{"ethdb", string(acceptorTipKey), hash.Bytes()},
+		{"ethdb", string(acceptedKey), hash.Bytes()},
+		{"ethdb", string(heightKey), heightBytes},
+	}
+	var vmWrites []VMStateWrite
+	if vmdb != nil {
+		vmWrites = []VMStateWrite{
+			{"vm", string(vmLastAcceptedKey), hash.Bytes()},
+			{"vm", string(vmLastHeightKey), heightBytes},
+			{"vm", string(vmInitializedKey), vmInitializedMarker},
+		}
+	}
+	batch := db.NewBatch()
+	for _, write := range ethWrites {
+		if err := batch.Put([]byte(write.Key), write.Value); err != nil {
+			return report, fmt.Errorf("failed to set %s: %w", write.Key, err)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return report, fmt.Errorf("failed to write ethdb keys: %w", err)
+	}
+	report.Writes = append(report.Writes, ethWrites...)
+
+	for _, write := range vmWrites {
+		if err := vmdb.Put([]byte(write.Key), write.Value); err != nil {
+			return report, fmt.Errorf("failed to set VM %s: %w", write.Key, err)
+		}
+		report.Writes = append(report.Writes, write)
+	}
+	return report, nil
+}
+
+// validateBlock returns the hash and state root of the canonical block at
+// height, checking that its header, hash-to-number entry and body are present
+func validateBlock(db ethdb.KeyValueReader, height uint64) (common.Hash, common.Hash, error) {
+	numBytes := binary.BigEndian.AppendUint64(nil, height)
+	value, err := db.Get(append(append([]byte("h"), numBytes...), 'n'))
+	if err != nil || len(value) != common.HashLength {
+		return common.Hash{}, common.Hash{}, fmt.Errorf("no canonical hash for block %d", height)
+	}
+	hash := common.BytesToHash(value)
+
+	blockKey := append(numBytes, hash.Bytes()...)
+	header, err := db.Get(append([]byte("h"), blockKey...))
+	if err != nil || len(header) == 0 {
+		return hash, common.Hash{}, fmt.Errorf("header of block %d %s is missing", height, hash.Hex())
+	}
+	root, err := database.HeaderHashField(header, database.HeaderRootField)
+	if err != nil {
+		return hash, common.Hash{}, fmt.Errorf("block %d: %w", height, err)
+	}
+	number, err := db.Get(append([]byte("H"), hash.Bytes()...))
+	if err != nil || len(number) != 8 {
+		return hash, root, fmt.Errorf("no hash-to-number entry for block %d %s", height, hash.Hex())
+	}
+	if got := binary.BigEndian.Uint64(number); got != height {
+		return hash, root, fmt.Errorf("hash-to-number entry of %s is %d, not %d", hash.Hex(), got, height)
+	}
+	if has, err := db.Has(append([]byte("b"), blockKey...)); err != nil || !has {
+		return hash, root, fmt.Errorf("body of block %d %s is missing", height, hash.Hex())
+	}
+	return hash, root, nil
+}
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+)
+
+// CopyConfig controls how a state trie is copied
+type CopyConfig struct {
+	Root common.Hash
+	// Namespace is prepended to every source key, e.g. for SubnetEVM databases
+	Namespace []byte
+	Workers   int
+	// Verify re-walks the destination after copying instead of only checking the root
+	Verify bool
+	// Progress receives periodic status lines when set
+	Progress io.Writer
+}
+
+// batchSink writes nodes and code into a destination through a write batch
+type batchSink struct {
+	db    ethdb.KeyValueStore
+	batch ethdb.Batch
+}
+
+func newBatchSink(db ethdb.KeyValueStore) *batchSink {
+	return &batchSink{db: db, batch: db.NewBatch()}
+}
+
+func (s *batchSink) node(hash common.Hash, blob []byte) error {
+	rawdb.WriteLegacyTrieNode(s.batch, hash, blob)
+	return s.maybeFlush()
+}
+
+func (s *batchSink) code(hash common.Hash, code []byte) error {
+	rawdb.WriteCode(s.batch, hash, code)
+	return s.maybeFlush()
+}
+
+func (s *batchSink) maybeFlush() error {
+	if s.batch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *batchSink) flush() error {
+	if err := s.batch.Write(); err != nil {
+		return fmt.Errorf("failed to write batch: %w", err)
+	}
+	s.batch.Reset()
+	return nil
+}
+
+// Copy walks the account trie at config.Root and every storage trie under it
+// in src, writing each node and all contract code into dst. Every node and code
+// blob is checked against its hash on the way, and the root is checked in dst
+// once the copy is done.
+func Copy(ctx context.Context, src ethdb.KeyValueReader, dst ethdb.KeyValueStore, config CopyConfig) (Stats, error) {
+	if config.Root == types.EmptyRootHash {
+		return Stats{}, nil
+	}
+
+	w := newWalker(NewPrefixReader(src, config.Namespace), config.Root, config.Workers, func() sink {
+		return newBatchSink(dst)
+	})
+	w.progress = config.Progress
+	if err := w.run(ctx); err != nil {
+		return w.snapshot(), err
+	}
+	stats := w.snapshot()
+
+	blob := rawdb.ReadLegacyTrieNode(dst, config.Root)
+	if len(blob) == 0 {
+		return stats, fmt.Errorf("state root %s missing from destination", config.Root.Hex())
+	}
+	if crypto.Keccak256Hash(blob) != config.Root {
+		return stats, fmt.Errorf("state root %s is corrupt in destination", config.Root.Hex())
+	}
+
+	if config.Verify {
+		if _, err := Verify(ctx, dst, config.Root, config.Workers); err != nil {
+			return stats, fmt.Errorf("destination verification failed: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+// Verify walks the state at root and checks that every trie node and code blob
+// is present in db and hashes to its key.
+func Verify(ctx context.Context, db ethdb.KeyValueReader, root common.Hash, workers int) (Stats, error) {
+	if root == types.EmptyRootHash {
+		return Stats{}, nil
+	}
+	w := newWalker(db, root, workers, func() sink { return discardSink{} })
+	err := w.run(ctx)
+	return w.snapshot(), err
+}
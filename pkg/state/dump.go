@@ -0,0 +1,310 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/trie"
+)
+
+// DumpConfig controls how a state trie is dumped
+type DumpConfig struct {
+	Root common.Hash
+	// Namespace is prepended to every key, e.g. for SubnetEVM databases
+	Namespace []byte
+	// Start is the first account hash to dump, to resume an interrupted dump
+	Start common.Hash
+	// Storage adds every storage slot to the account records
+	Storage bool
+	// Workers is the number of storage tries read concurrently
+	Workers int
+	// Progress receives periodic status lines when set
+	Progress io.Writer
+}
+
+// DumpAccount is one line of a dump. Address and storage keys are only set
+// when the database holds their preimages.
+type DumpAccount struct {
+	AddressHash common.Hash     `json:"addressHash"`
+	Address     *common.Address `json:"address,omitempty"`
+	Nonce       uint64          `json:"nonce"`
+	Balance     string          `json:"balance"`
+	CodeHash    common.Hash     `json:"codeHash"`
+	StorageRoot common.Hash     `json:"storageRoot"`
+	Storage     []DumpSlot      `json:"storage,omitempty"`
+}
+
+// DumpSlot is one storage slot of a dumped account
+type DumpSlot struct {
+	Hash  common.Hash  `json:"hash"`
+	Key   *common.Hash `json:"key,omitempty"`
+	Value common.Hash  `json:"value"`
+}
+
+// DumpStats counts what a dump wrote
+type DumpStats struct {
+	Accounts     uint64
+	Addresses    uint64
+	StorageSlots uint64
+	// Next is the account hash to resume from, zero once the whole trie is dumped
+	Next common.Hash
+	// Complete is set once the last account of the trie is written
+	Complete bool
+}
+
+func (s DumpStats) String() string {
+	return fmt.Sprintf("accounts=%d addresses=%d slots=%d next=%s", s.Accounts, s.Addresses, s.StorageSlots, s.Next.Hex())
+}
+
+// dumpChunkSize is how many bytes of records are collected before a write
+const dumpChunkSize = 64 * 1024
+
+// dumpItem is an account record on its way to the writer
+type dumpItem struct {
+	record DumpAccount
+	done   chan struct{}
+	err    error
+}
+
+// Dump writes one JSON line per account of the state trie at config.Root to w,
+// in account hash order starting at config.Start. The account trie is read
+// sequentially to keep that order, while storage tries are read by a pool of
+// workers and their records queued until every earlier one is written.
+//
+// When the dump stops early the returned stats hold the hash to resume from.
+func Dump(ctx context.Context, src ethdb.KeyValueReader, config DumpConfig, w io.Writer) (DumpStats, error) {
+	stats := DumpStats{Next: config.Start}
+	workers := max(config.Workers, 1)
+
+	db := NewPrefixReader(src, config.Namespace)
+	nodes := &nodeDatabase{db: db}
+	accounts, err := trie.NewStateTrie(trie.StateTrieID(config.Root), nodes)
+	if err != nil {
+		return stats, fmt.Errorf("state %s is not available: %w", config.Root.Hex(), err)
+	}
+	nodeIt, err := accounts.NodeIterator(config.Start.Bytes())
+	if err != nil {
+		return stats, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *dumpItem, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				item.err = dumpStorage(ctx, db, nodes, config.Root, &item.record)
+				close(item.done)
+			}
+		}()
+	}
+
+	// The queue bounds how many records wait in memory for the writer
+	queue := make(chan *dumpItem, 4*workers)
+	var iterErr error
+	// produced is closed once the iterator stops reading db
+	produced := make(chan struct{})
+	go func() {
+		defer close(produced)
+		defer close(queue)
+		defer close(jobs)
+
+		it := trie.NewIterator(nodeIt)
+		for it.Next() {
+			item := &dumpItem{done: make(chan struct{})}
+			if err := decodeDumpAccount(db, it.Key, it.Value, &item.record); err != nil {
+				iterErr = err
+				return
+			}
+			if config.Storage && item.record.StorageRoot != types.EmptyRootHash {
+				select {
+				case jobs <- item:
+				case <-ctx.Done():
+					iterErr = ctx.Err()
+					return
+				}
+			} else {
+				close(item.done)
+			}
+			select {
+			case queue <- item:
+			case <-ctx.Done():
+				iterErr = ctx.Err()
+				return
+			}
+		}
+		iterErr = it.Err
+	}()
+
+	// Records are written in chunks, and only a written chunk moves the
+	// resume point past its accounts
+	var (
+		buf     bytes.Buffer
+		pending DumpStats
+		last    common.Hash
+
+		writeFailed bool
+	)
+	enc := json.NewEncoder(&buf)
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+		stats.Accounts += pending.Accounts
+		stats.Addresses += pending.Addresses
+		stats.StorageSlots += pending.StorageSlots
+		stats.Next = incrementHash(last)
+		pending = DumpStats{}
+		return nil
+	}
+	for item := range queue {
+		select {
+		case <-item.done:
+		case <-ctx.Done():
+		}
+		if err = ctx.Err(); err == nil {
+			err = item.err
+		}
+		if err == nil {
+			err = enc.Encode(&item.record)
+		}
+		if err != nil {
+			break
+		}
+		last = item.record.AddressHash
+		pending.Accounts++
+		pending.StorageSlots += uint64(len(item.record.Storage))
+		if item.record.Address != nil {
+			pending.Addresses++
+		}
+		if buf.Len() >= dumpChunkSize {
+			if err = flush(); err != nil {
+				writeFailed = true
+				break
+			}
+		}
+		if config.Progress != nil && (stats.Accounts+pending.Accounts)%100000 == 0 {
+			fmt.Fprintf(config.Progress, "  Dumped %d accounts (at %s)\n", stats.Accounts+pending.Accounts, last.Hex())
+		}
+	}
+	cancel()
+	<-produced
+	wg.Wait()
+
+	if !writeFailed {
+		// Records encoded before a stop are complete, so they are still written
+		if flushErr := flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if err == nil {
+		// The iterator has finished or was stopped
+		err = iterErr
+	}
+	if err == nil {
+		stats.Next, stats.Complete = common.Hash{}, true
+	}
+	return stats, err
+}
+
+// AccountHashes returns the hash of every account in the state trie at root,
+// in ascending order
+func AccountHashes(ctx context.Context, db ethdb.KeyValueReader, root common.Hash) ([]common.Hash, error) {
+	tr, err := trie.NewStateTrie(trie.StateTrieID(root), &nodeDatabase{db: db})
+	if err != nil {
+		return nil, fmt.Errorf("state %s is not available: %w", root.Hex(), err)
+	}
+	nodeIt, err := tr.NodeIterator(nil)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []common.Hash
+	it := trie.NewIterator(nodeIt)
+	for it.Next() {
+		if len(hashes)%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		hashes = append(hashes, common.BytesToHash(it.Key))
+	}
+	return hashes, it.Err
+}
+
+// decodeDumpAccount fills record from an account trie leaf
+func decodeDumpAccount(db ethdb.KeyValueReader, key, blob []byte, record *DumpAccount) error {
+	var acc types.StateAccount
+	if err := rlp.DecodeBytes(blob, &acc); err != nil {
+		return fmt.Errorf("failed to decode account %x: %w", key, err)
+	}
+	record.AddressHash = common.BytesToHash(key)
+	record.Nonce = acc.Nonce
+	record.Balance = acc.Balance.Dec()
+	record.CodeHash = common.BytesToHash(acc.CodeHash)
+	record.StorageRoot = acc.Root
+	if preimage := rawdb.ReadPreimage(db, record.AddressHash); len(preimage) == common.AddressLength {
+		address := common.BytesToAddress(preimage)
+		record.Address = &address
+	}
+	return nil
+}
+
+// dumpStorage adds every slot of the account's storage trie to record
+func dumpStorage(ctx context.Context, db ethdb.KeyValueReader, nodes *nodeDatabase, root common.Hash, record *DumpAccount) error {
+	tr, err := trie.NewStateTrie(trie.StorageTrieID(root, record.AddressHash, record.StorageRoot), nodes)
+	if err != nil {
+		return fmt.Errorf("storage trie %s of account %s: %w", record.StorageRoot.Hex(), record.AddressHash.Hex(), err)
+	}
+	nodeIt, err := tr.NodeIterator(nil)
+	if err != nil {
+		return fmt.Errorf("storage trie %s of account %s: %w", record.StorageRoot.Hex(), record.AddressHash.Hex(), err)
+	}
+	it := trie.NewIterator(nodeIt)
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return fmt.Errorf("failed to decode slot %x of account %s: %w", it.Key, record.AddressHash.Hex(), err)
+		}
+		slot := DumpSlot{Hash: common.BytesToHash(it.Key), Value: common.BytesToHash(content)}
+		if preimage := rawdb.ReadPreimage(db, slot.Hash); len(preimage) == common.HashLength {
+			key := common.BytesToHash(preimage)
+			slot.Key = &key
+		}
+		record.Storage = append(record.Storage, slot)
+	}
+	if it.Err != nil {
+		return fmt.Errorf("storage trie %s of account %s: %w", record.StorageRoot.Hex(), record.AddressHash.Hex(), it.Err)
+	}
+	return nil
+}
+
+// incrementHash returns the hash following h, wrapping to zero after the last
+func incrementHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
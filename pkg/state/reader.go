@@ -0,0 +1,78 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/trie"
+)
+
+// Reader looks up single accounts, storage slots and code in the state trie
+// of one root
+type Reader struct {
+	db       ethdb.KeyValueReader
+	root     common.Hash
+	accounts *trie.StateTrie
+}
+
+// NewReader opens the account trie at root. The root node must be present.
+func NewReader(db ethdb.KeyValueReader, root common.Hash) (*Reader, error) {
+	accounts, err := trie.NewStateTrie(trie.StateTrieID(root), &nodeDatabase{db: db})
+	if err != nil {
+		return nil, fmt.Errorf("state %s is not available: %w", root.Hex(), err)
+	}
+	return &Reader{db: db, root: root, accounts: accounts}, nil
+}
+
+// Root returns the state root the reader was opened at
+func (r *Reader) Root() common.Hash {
+	return r.root
+}
+
+// Account returns the account at address, or nil when it does not exist
+func (r *Reader) Account(address common.Address) (*types.StateAccount, error) {
+	account, err := r.accounts.GetAccount(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account %s: %w", address.Hex(), err)
+	}
+	return account, nil
+}
+
+// Storage returns the value of a storage slot, zero when the account or slot
+// does not exist
+func (r *Reader) Storage(address common.Address, slot common.Hash) (common.Hash, error) {
+	account, err := r.Account(address)
+	if err != nil || account == nil || account.Root == types.EmptyRootHash {
+		return common.Hash{}, err
+	}
+	storage, err := trie.NewStateTrie(trie.StorageTrieID(r.root, crypto.Keccak256Hash(address.Bytes()), account.Root), &nodeDatabase{db: r.db})
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("storage of %s is not available: %w", address.Hex(), err)
+	}
+	value, err := storage.GetStorage(address, slot.Bytes())
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to read slot %s of %s: %w", slot.Hex(), address.Hex(), err)
+	}
+	return common.BytesToHash(value), nil
+}
+
+// Code returns the contract code of address, nil for accounts without code
+func (r *Reader) Code(address common.Address) ([]byte, error) {
+	account, err := r.Account(address)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	codeHash := common.BytesToHash(account.CodeHash)
+	if codeHash == types.EmptyCodeHash {
+		return nil, nil
+	}
+	code := rawdb.ReadCode(r.db, codeHash)
+	if len(code) == 0 {
+		return nil, fmt.Errorf("code %s of %s is missing", codeHash.Hex(), address.Hex())
+	}
+	return code, nil
+}
@@ -0,0 +1,69 @@
+// Package state walks, copies and dumps Ethereum state tries stored in the
+// hash-based scheme, where every trie node is keyed by its keccak256 hash.
+package state
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/triedb/database"
+)
+
+// prefixReader reads keys under a fixed prefix, e.g. a SubnetEVM namespace
+type prefixReader struct {
+	db     ethdb.KeyValueReader
+	prefix []byte
+}
+
+// NewPrefixReader returns a reader that prepends prefix to every key.
+// A nil prefix returns db unchanged.
+func NewPrefixReader(db ethdb.KeyValueReader, prefix []byte) ethdb.KeyValueReader {
+	if len(prefix) == 0 {
+		return db
+	}
+	return &prefixReader{db: db, prefix: bytes.Clone(prefix)}
+}
+
+func (r *prefixReader) key(key []byte) []byte {
+	return append(bytes.Clone(r.prefix), key...)
+}
+
+func (r *prefixReader) Has(key []byte) (bool, error) { return r.db.Has(r.key(key)) }
+
+func (r *prefixReader) Get(key []byte) ([]byte, error) { return r.db.Get(r.key(key)) }
+
+// nodeDatabase serves hash-scheme trie nodes straight from a key-value store
+type nodeDatabase struct {
+	db ethdb.KeyValueReader
+}
+
+func (n *nodeDatabase) NodeReader(stateRoot common.Hash) (database.NodeReader, error) {
+	return n, nil
+}
+
+// Node returns the node stored under hash. A missing node is reported by the
+// trie as a MissingNodeError, so no error is returned here.
+func (n *nodeDatabase) Node(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	blob, err := n.db.Get(hash.Bytes())
+	if err != nil {
+		return nil, nil
+	}
+	return blob, nil
+}
+
+// Stats counts what a walk has visited
+type Stats struct {
+	Accounts     uint64
+	StorageTries uint64
+	StorageSlots uint64
+	Nodes        uint64
+	Code         uint64
+	Bytes        uint64
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("accounts=%d storageTries=%d slots=%d nodes=%d code=%d bytes=%d",
+		s.Accounts, s.StorageTries, s.StorageSlots, s.Nodes, s.Code, s.Bytes)
+}
@@ -0,0 +1,257 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/trie"
+)
+
+// sink receives the nodes and code found by a walk. Every goroutine of a walk
+// gets its own sink, so implementations need not be safe for concurrent use.
+type sink interface {
+	node(hash common.Hash, blob []byte) error
+	code(hash common.Hash, code []byte) error
+	flush() error
+}
+
+// discardSink drops everything, for walks that only verify
+type discardSink struct{}
+
+func (discardSink) node(common.Hash, []byte) error { return nil }
+func (discardSink) code(common.Hash, []byte) error { return nil }
+func (discardSink) flush() error                   { return nil }
+
+// storageJob is a storage trie waiting to be walked
+type storageJob struct {
+	owner common.Hash
+	root  common.Hash
+}
+
+// walker visits every node of an account trie and its storage tries. The
+// account trie is split by the first nibble of the node path into 16 parts
+// walked concurrently, and storage tries are handed to a pool of workers.
+type walker struct {
+	src      ethdb.KeyValueReader
+	nodes    *nodeDatabase
+	root     common.Hash
+	workers  int
+	newSink  func() sink
+	progress io.Writer
+
+	stats       Stats
+	seenStorage sync.Map
+	seenCode    sync.Map
+}
+
+func newWalker(src ethdb.KeyValueReader, root common.Hash, workers int, newSink func() sink) *walker {
+	if workers < 1 {
+		workers = 1
+	}
+	return &walker{
+		src:     src,
+		nodes:   &nodeDatabase{db: src},
+		root:    root,
+		workers: workers,
+		newSink: newSink,
+	}
+}
+
+// snapshot returns a consistent copy of the counters
+func (w *walker) snapshot() Stats {
+	return Stats{
+		Accounts:     atomic.LoadUint64(&w.stats.Accounts),
+		StorageTries: atomic.LoadUint64(&w.stats.StorageTries),
+		StorageSlots: atomic.LoadUint64(&w.stats.StorageSlots),
+		Nodes:        atomic.LoadUint64(&w.stats.Nodes),
+		Code:         atomic.LoadUint64(&w.stats.Code),
+		Bytes:        atomic.LoadUint64(&w.stats.Bytes),
+	}
+}
+
+func (w *walker) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	if w.progress != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(10 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					fmt.Fprintf(w.progress, "  %s\n", w.snapshot())
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	jobs := make(chan storageJob, 4*w.workers)
+	var storageWG sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
+		storageWG.Add(1)
+		go func() {
+			defer storageWG.Done()
+			s := w.newSink()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue // drain so the account walkers never block
+				}
+				if err := w.walkStorage(ctx, s, job); err != nil {
+					fail(err)
+				}
+			}
+			if err := s.flush(); err != nil {
+				fail(err)
+			}
+		}()
+	}
+
+	sem := make(chan struct{}, w.workers)
+	var accountWG sync.WaitGroup
+	for nibble := 0; nibble < 16; nibble++ {
+		accountWG.Add(1)
+		go func(nibble int) {
+			defer accountWG.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			s := w.newSink()
+			if err := w.walkAccounts(ctx, s, nibble, jobs); err != nil {
+				fail(err)
+				return
+			}
+			if err := s.flush(); err != nil {
+				fail(err)
+			}
+		}(nibble)
+	}
+	accountWG.Wait()
+	close(jobs)
+	storageWG.Wait()
+
+	return firstErr
+}
+
+func (w *walker) walkAccounts(ctx context.Context, s sink, nibble int, jobs chan<- storageJob) error {
+	return w.walkTrie(ctx, s, trie.StateTrieID(w.root), nibble, func(key, blob []byte) error {
+		var acc types.StateAccount
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			return fmt.Errorf("failed to decode account %x: %w", key, err)
+		}
+		atomic.AddUint64(&w.stats.Accounts, 1)
+
+		if acc.Root != types.EmptyRootHash {
+			if _, seen := w.seenStorage.LoadOrStore(acc.Root, struct{}{}); !seen {
+				select {
+				case jobs <- storageJob{owner: common.BytesToHash(key), root: acc.Root}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+
+		codeHash := common.BytesToHash(acc.CodeHash)
+		if codeHash == types.EmptyCodeHash {
+			return nil
+		}
+		if _, seen := w.seenCode.LoadOrStore(codeHash, struct{}{}); seen {
+			return nil
+		}
+		code := rawdb.ReadCode(w.src, codeHash)
+		if len(code) == 0 {
+			return fmt.Errorf("missing code %s of account %x", codeHash.Hex(), key)
+		}
+		if crypto.Keccak256Hash(code) != codeHash {
+			return fmt.Errorf("code %s of account %x is corrupt", codeHash.Hex(), key)
+		}
+		atomic.AddUint64(&w.stats.Code, 1)
+		atomic.AddUint64(&w.stats.Bytes, uint64(len(code)))
+		return s.code(codeHash, code)
+	})
+}
+
+func (w *walker) walkStorage(ctx context.Context, s sink, job storageJob) error {
+	atomic.AddUint64(&w.stats.StorageTries, 1)
+	err := w.walkTrie(ctx, s, trie.StorageTrieID(w.root, job.owner, job.root), -1, func(key, blob []byte) error {
+		atomic.AddUint64(&w.stats.StorageSlots, 1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("storage trie %s of account %s: %w", job.root.Hex(), job.owner.Hex(), err)
+	}
+	return nil
+}
+
+// walkTrie visits the nodes of one trie and calls leaf for every value. A
+// nibble of 0-15 restricts the walk to nodes whose path starts with it, with
+// the root belonging to nibble 0; a negative nibble walks the whole trie.
+func (w *walker) walkTrie(ctx context.Context, s sink, id *trie.ID, nibble int, leaf func(key, blob []byte) error) error {
+	tr, err := trie.New(id, w.nodes)
+	if err != nil {
+		return err
+	}
+	it, err := tr.NodeIterator(nil)
+	if err != nil {
+		return err
+	}
+
+	descend := true
+	for it.Next(descend) {
+		path := it.Path()
+		inRange := nibble < 0 || len(path) == 0 || int(path[0]) == nibble
+		descend = inRange
+		if !inRange || (len(path) == 0 && nibble > 0) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			blob := it.NodeBlob()
+			if blob == nil {
+				break
+			}
+			if crypto.Keccak256Hash(blob) != hash {
+				return fmt.Errorf("trie node %s is corrupt", hash.Hex())
+			}
+			atomic.AddUint64(&w.stats.Nodes, 1)
+			atomic.AddUint64(&w.stats.Bytes, uint64(len(blob)))
+			if err := s.node(hash, blob); err != nil {
+				return err
+			}
+		}
+		if it.Leaf() {
+			if err := leaf(it.LeafKey(), it.LeafBlob()); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Error()
+}
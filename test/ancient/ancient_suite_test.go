@@ -0,0 +1,13 @@
+package ancient_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAncient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ancient Suite")
+}
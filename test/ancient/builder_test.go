@@ -0,0 +1,154 @@
+package ancient_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/ancient"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	"github.com/luxfi/geth/rlp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writeFreezer freezes a chain of blocks with difficulty 1 for the genesis and
+// 2 for every later block, and returns their hashes.
+func writeFreezer(dir string, count int) []common.Hash {
+	db, err := rawdb.Open(memorydb.New(), rawdb.OpenOptions{Ancient: dir})
+	Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+
+	blocks := testutil.Chain(count, func(header *types.Header) *types.Body {
+		if header.Number.Sign() > 0 {
+			header.Difficulty = big.NewInt(2)
+		}
+		header.Time = 1_700_000_000 + header.Number.Uint64()
+		return nil
+	})
+	var (
+		receipts []rlp.RawValue
+		hashes   []common.Hash
+	)
+	for _, block := range blocks {
+		receipts = append(receipts, rlp.EmptyList)
+		hashes = append(hashes, block.Hash())
+	}
+	_, err = rawdb.WriteAncientBlocks(db, blocks, receipts)
+	Expect(err).NotTo(HaveOccurred())
+	return hashes
+}
+
+// readTD reads the legacy total difficulty entry of a block from a store of any backend
+func readTD(path string, number uint64, hash common.Hash) uint64 {
+	kv, err := database.OpenKeyValueStore("", path, database.BackendOptions{ReadOnly: true})
+	Expect(err).NotTo(HaveOccurred())
+	defer kv.Close()
+
+	key := binary.BigEndian.AppendUint64([]byte("h"), number)
+	key = append(append(key, hash.Bytes()...), 't')
+	data, err := kv.Get(key)
+	Expect(err).NotTo(HaveOccurred())
+	td := new(big.Int)
+	Expect(rlp.DecodeBytes(data, td)).To(Succeed())
+	return td.Uint64()
+}
+
+var _ = Describe("Ancient builder", func() {
+	var (
+		tmp    string
+		hashes []common.Hash
+	)
+
+	BeforeEach(func() {
+		tmp = GinkgoT().TempDir()
+		hashes = writeFreezer(filepath.Join(tmp, "source", "ancient"), 50)
+	})
+
+	export := func(start uint64) string {
+		builder, err := ancient.NewBuilder(&ancient.CChainAncientData{
+			ChainID:      96369,
+			StartBlock:   start,
+			DataPath:     filepath.Join(tmp, "source", "ancient"),
+			CompactedDir: filepath.Join(tmp, "compacted"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer builder.Close()
+
+		Expect(builder.CompactAncientData()).To(Succeed())
+		out := filepath.Join(tmp, "export")
+		Expect(builder.ExportToGenesis(out)).To(Succeed())
+		return out
+	}
+
+	readManifest := func(dir string) ancient.Manifest {
+		data, err := os.ReadFile(filepath.Join(dir, "ancient-manifest.json"))
+		Expect(err).NotTo(HaveOccurred())
+		var manifest ancient.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+		return manifest
+	}
+
+	It("should export every table with checksums and import it into a new freezer", func() {
+		out := export(0)
+
+		manifest := readManifest(out)
+		Expect(manifest.GenesisHash).To(Equal(hashes[0]))
+		Expect(manifest.EndBlock).To(BeEquivalentTo(49))
+		Expect(manifest.Tables).To(HaveLen(5))
+		for _, sum := range manifest.Tables {
+			Expect(sum.Items).To(BeEquivalentTo(50))
+			Expect(sum.SHA256).To(HaveLen(64))
+		}
+
+		target := filepath.Join(tmp, "target")
+		Expect(ancient.ImportFromGenesis(out, target, database.BadgerDB)).To(Succeed())
+		Expect(database.DetectDatabaseType(target)).To(Equal(database.BadgerDB))
+
+		db, err := rawdb.Open(memorydb.New(), rawdb.OpenOptions{Ancient: filepath.Join(target, "ancient"), ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		frozen, err := db.Ancients()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frozen).To(BeEquivalentTo(50))
+		Expect(rawdb.ReadCanonicalHash(db, 49)).To(Equal(hashes[49]))
+		Expect(rawdb.ReadHeader(db, hashes[49], 49).ParentHash).To(Equal(hashes[48]))
+		Expect(readTD(target, 49, hashes[49])).To(BeEquivalentTo(99))
+	})
+
+	It("should sum the difficulty of the blocks before the start block", func() {
+		out := export(10)
+		Expect(readManifest(out).Tables[ancient.TableDifficulties].Items).To(BeEquivalentTo(40))
+
+		// Block 10 has a total difficulty of 1 + 10*2
+		Expect(readTD(filepath.Join(out, "ancient-compact"), 10, hashes[10])).To(BeEquivalentTo(21))
+
+		By("Refusing to import a range that does not continue the target freezer")
+		err := ancient.ImportFromGenesis(out, filepath.Join(tmp, "target"), "")
+		Expect(err).To(MatchError(ContainSubstring("export starts at block 10")))
+	})
+
+	It("should refuse to import data that does not match the manifest", func() {
+		out := export(0)
+
+		manifest := readManifest(out)
+		bodies := manifest.Tables[ancient.TableBodies]
+		bodies.SHA256 = "00" + bodies.SHA256[2:]
+		manifest.Tables[ancient.TableBodies] = bodies
+		data, err := json.Marshal(manifest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(out, "ancient-manifest.json"), data, 0644)).To(Succeed())
+
+		target := filepath.Join(tmp, "target")
+		err = ancient.ImportFromGenesis(out, target, "")
+		Expect(err).To(MatchError(ContainSubstring("checksum mismatch in tables: bodies")))
+		Expect(target).NotTo(BeADirectory())
+	})
+})
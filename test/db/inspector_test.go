@@ -0,0 +1,171 @@
+package db_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/luxfi/genesis/pkg/db"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/trie"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inspector", func() {
+	var (
+		kv        ethdb.Database
+		inspector *db.Inspector
+		block     *types.Block
+		namespace []byte
+	)
+
+	blockKey := func(prefix string, number uint64, hash common.Hash) []byte {
+		return append(binary.BigEndian.AppendUint64([]byte(prefix), number), hash.Bytes()...)
+	}
+
+	BeforeEach(func() {
+		kv = rawdb.NewMemoryDatabase()
+		inspector = db.NewInspector(nil, kv)
+		namespace = bytes.Repeat([]byte{0x33}, 32)
+
+		header := testutil.Header(42, common.Hash{})
+		header.Root = common.HexToHash("0x01")
+		header.GasUsed = 21_000
+		header.Time = 1_700_000_000
+		block = types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: types.Transactions{
+			types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1), Gas: 21000}),
+		}})
+		testutil.WriteChain(kv, []*types.Block{block})
+		td, err := rlp.EncodeToBytes(big.NewInt(43))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kv.Put(append(blockKey("h", 42, block.Hash()), 't'), td)).To(Succeed())
+	})
+
+	It("should decode block-keyed tables with their number and hash", func() {
+		result, err := inspector.InspectKey(blockKey("h", 42, block.Hash()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("header"))
+		Expect(*result.Number).To(BeEquivalentTo(42))
+		Expect(result.Hash).To(Equal(block.Hash()))
+		Expect(result.Decoded).To(ContainSubstring("header #42"))
+		Expect(result.Decoded).To(ContainSubstring(block.Hash().Hex()))
+		Expect(result.Details).To(ContainSubstring("gasUsed=21000"))
+		Expect(result.Details).To(ContainSubstring("time=1700000000"))
+
+		result, err = inspector.InspectKey(append(binary.BigEndian.AppendUint64([]byte("h"), 42), 'n'))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("canonical"))
+		Expect(result.Decoded).To(Equal("block hash " + block.Hash().Hex()))
+
+		result, err = inspector.InspectKey(append([]byte("H"), block.Hash().Bytes()...))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("hash-to-number"))
+		Expect(result.Decoded).To(Equal("block #42"))
+
+		result, err = inspector.InspectKey(blockKey("b", 42, block.Hash()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("body"))
+		Expect(result.Decoded).To(Equal("1 transactions, 0 uncles"))
+
+		result, err = inspector.InspectKey(append(blockKey("h", 42, block.Hash()), 't'))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("td"))
+		Expect(result.Decoded).To(Equal("total difficulty 43"))
+	})
+
+	It("should decode state entries", func() {
+		account := types.StateAccount{
+			Nonce:    7,
+			Balance:  uint256.NewInt(1000),
+			Root:     types.EmptyRootHash,
+			CodeHash: types.EmptyCodeHash.Bytes(),
+		}
+		accountHash := crypto.Keccak256Hash([]byte("account"))
+		rawdb.WriteAccountSnapshot(kv, accountHash, types.SlimAccountRLP(account))
+
+		result, err := inspector.InspectKey(append([]byte("a"), accountHash.Bytes()...))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("snapshot-account"))
+		Expect(result.Hash).To(Equal(accountHash))
+		Expect(result.Details).To(ContainSubstring("nonce=7 balance=1000"))
+
+		By("Decoding a hash-scheme account trie leaf")
+		blob, err := rlp.EncodeToBytes(&account)
+		Expect(err).NotTo(HaveOccurred())
+		tr := trie.NewEmpty(nil)
+		Expect(tr.Update(accountHash.Bytes(), blob)).To(Succeed())
+		root := testutil.CommitTrie(kv, tr)
+		result, err = inspector.InspectKey(root.Bytes())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("trie-node-legacy"))
+		Expect(result.Decoded).To(HavePrefix("account leaf"))
+		Expect(result.Details).To(ContainSubstring("nonce=7"))
+		Expect(result.Details).To(ContainSubstring("keccak256 matches key"))
+
+		By("Decoding code and preimages")
+		code := []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+		rawdb.WriteCode(kv, crypto.Keccak256Hash(code), code)
+		result, err = inspector.InspectKey(append([]byte("c"), crypto.Keccak256(code)...))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("code"))
+		Expect(result.Decoded).To(Equal("5 bytes of code"))
+		Expect(result.Details).To(Equal("keccak256 matches key"))
+
+		address := common.HexToAddress("0x0100000000000000000000000000000000000000")
+		rawdb.WritePreimages(kv, map[common.Hash][]byte{crypto.Keccak256Hash(address.Bytes()): address.Bytes()})
+		result, err = inspector.InspectKey(append([]byte("secure-key-"), crypto.Keccak256(address.Bytes())...))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("preimage"))
+		Expect(result.Decoded).To(Equal("address " + address.Hex()))
+	})
+
+	It("should decode chain config and VM metadata", func() {
+		Expect(kv.Put(append([]byte("ethereum-config-"), block.Hash().Bytes()...), []byte(`{"chainId":96369}`))).To(Succeed())
+		result, err := inspector.InspectKey(append([]byte("ethereum-config-"), block.Hash().Bytes()...))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("chain-config"))
+		Expect(result.Hash).To(Equal(block.Hash()))
+		Expect(result.Decoded).To(Equal("chain config, chain ID 96369"))
+
+		Expect(kv.Put([]byte("height"), binary.BigEndian.AppendUint64(nil, 42))).To(Succeed())
+		result, err = inspector.InspectKey([]byte("height"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("vm-metadata"))
+		Expect(result.Decoded).To(Equal("number 42"))
+	})
+
+	It("should strip Subnet-EVM namespaces", func() {
+		header, err := kv.Get(blockKey("h", 42, block.Hash()))
+		Expect(err).NotTo(HaveOccurred())
+		key := append(bytes.Clone(namespace), blockKey("h", 42, block.Hash())...)
+		Expect(kv.Put(key, header)).To(Succeed())
+		canonical := append(bytes.Clone(namespace), append(binary.BigEndian.AppendUint64([]byte("h"), 42), 'n')...)
+		Expect(kv.Put(canonical, block.Hash().Bytes())).To(Succeed())
+
+		result, err := inspector.InspectKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("header"))
+		Expect(result.Namespace).To(Equal(namespace))
+		Expect(*result.Number).To(BeEquivalentTo(42))
+		Expect(result.Hash).To(Equal(block.Hash()))
+	})
+
+	It("should not strip the first 32 bytes of a long path-scheme node key", func() {
+		path := bytes.Repeat([]byte{0x0b}, 63)
+		key := append([]byte("A"), path...)
+		Expect(kv.Put(key, []byte{0xc0})).To(Succeed())
+
+		result, err := inspector.InspectKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Type).To(Equal("trie-node-account"))
+		Expect(result.Namespace).To(BeNil())
+	})
+})
@@ -0,0 +1,118 @@
+package db_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/db"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stats", func() {
+	const (
+		blocks     = 300
+		nodes      = 20000
+		namespaced = 10
+	)
+
+	var (
+		kv        ethdb.Database
+		namespace []byte
+		contract  common.Address
+	)
+
+	BeforeEach(func() {
+		store, err := database.OpenKeyValueStore(database.PebbleDB, GinkgoT().TempDir(), database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(store.Close)
+		kv = rawdb.NewDatabase(store)
+		namespace = bytes.Repeat([]byte{0x33}, 32)
+
+		chain := testutil.Chain(blocks, nil)
+		testutil.WriteCanonicalHeaders(kv, chain)
+
+		// Hash-keyed entries spread over the whole keyspace, like legacy trie nodes
+		for n := 0; n < nodes; n++ {
+			hash := crypto.Keccak256(binary.BigEndian.AppendUint64(nil, uint64(n)))
+			Expect(kv.Put(hash, make([]byte, 100))).To(Succeed())
+		}
+
+		// Contract storage in the snapshot, 10 slots for one and 3 for another
+		contract = common.HexToAddress("0x0100000000000000000000000000000000000000")
+		big1 := crypto.Keccak256Hash(contract.Bytes())
+		small := crypto.Keccak256Hash([]byte("small"))
+		for n := 0; n < 10; n++ {
+			rawdb.WriteStorageSnapshot(kv, big1, crypto.Keccak256Hash([]byte{byte(n)}), []byte{1})
+		}
+		for n := 0; n < 3; n++ {
+			rawdb.WriteStorageSnapshot(kv, small, crypto.Keccak256Hash([]byte{byte(n)}), []byte{1})
+		}
+		rawdb.WritePreimages(kv, map[common.Hash][]byte{big1: contract.Bytes()})
+
+		// A large code entry and a namespaced chain with its own canonical blocks
+		rawdb.WriteCode(kv, crypto.Keccak256Hash([]byte("code")), make([]byte, 24576))
+		for n := uint64(0); n < namespaced; n++ {
+			Expect(kv.Put(append(bytes.Clone(namespace), append(binary.BigEndian.AppendUint64([]byte("h"), n), 'n')...), chain[blocks-1].Hash().Bytes())).To(Succeed())
+		}
+	})
+
+	It("should report sizes per category, namespace and height", func() {
+		stats, err := db.NewInspector(nil, kv).GetStats(db.StatsOptions{BucketSize: 100, Top: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.SampleRate).To(BeZero())
+		Expect(stats.LatestBlock).To(BeEquivalentTo(blocks - 1))
+
+		Expect(stats.Categories["trie-node-legacy"].Keys).To(BeEquivalentTo(nodes))
+		Expect(stats.Categories["trie-node-legacy"].Bytes).To(BeEquivalentTo(nodes * (32 + 100)))
+		Expect(stats.Categories["canonical"].Keys).To(BeEquivalentTo(blocks + namespaced))
+		Expect(stats.Categories["header"].Keys).To(BeEquivalentTo(blocks))
+		Expect(stats.Categories["snapshot-storage"].Keys).To(BeEquivalentTo(13))
+
+		Expect(stats.Namespaces).To(HaveLen(2))
+		Expect(stats.Namespaces[hex.EncodeToString(namespace)].Keys).To(BeEquivalentTo(namespaced))
+		Expect(stats.Namespaces["none"].Keys).To(Equal(stats.TotalKeys - namespaced))
+
+		By("Bucketing the block tables by height")
+		Expect(stats.Heights).To(HaveLen(3))
+		Expect(stats.Heights[0].From).To(BeEquivalentTo(0))
+		Expect(stats.Heights[2].To).To(BeEquivalentTo(299))
+		// Only the canonical and header keys carry a number
+		Expect(stats.Heights[1].Keys).To(BeEquivalentTo(200))
+
+		By("Listing the largest contracts and values")
+		Expect(stats.Contracts).To(HaveLen(2))
+		Expect(stats.Contracts[0].Keys).To(BeEquivalentTo(10))
+		Expect(stats.Contracts[0].Address).NotTo(BeNil())
+		Expect(*stats.Contracts[0].Address).To(Equal(contract))
+		Expect(stats.Contracts[1].Address).To(BeNil())
+		Expect(stats.HashSchemeTries).To(BeTrue())
+		var out strings.Builder
+		stats.Print(&out)
+		Expect(out.String()).To(ContainSubstring("Hash-scheme trie nodes"))
+		Expect(stats.LargestValues).To(HaveLen(3))
+		Expect(stats.LargestValues[0].Kind).To(Equal("code"))
+		Expect(stats.LargestValues[0].Size).To(Equal(24576))
+	})
+
+	It("should estimate the totals from a sample", func() {
+		stats, err := db.NewInspector(nil, kv).GetStats(db.StatsOptions{SampleRate: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.SampleRate).To(Equal(4))
+		// 300 blocks fit in one chunk, which is sampled one run in four
+		Expect(stats.LatestBlock).To(BeEquivalentTo(blocks - 1))
+
+		nodeKeys := float64(stats.Categories["trie-node-legacy"].Keys)
+		Expect(nodeKeys).To(BeNumerically("~", nodes, nodes/10))
+		nodeBytes := float64(stats.Categories["trie-node-legacy"].Bytes)
+		Expect(nodeBytes).To(BeNumerically("~", nodes*(32+100), nodes*(32+100)/10))
+	})
+})
@@ -0,0 +1,131 @@
+package db_test
+
+import (
+	"encoding/binary"
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/db"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FindTip", func() {
+	var (
+		kv     ethdb.Database
+		chain  []*types.Block
+		tipFor func(source string, tip *db.TipInfo) db.TipCandidate
+	)
+
+	BeforeEach(func() {
+		kv = rawdb.NewMemoryDatabase()
+
+		// Blocks 0-99 are canonical, 100-102 only have headers
+		chain = testutil.Chain(103, func(header *types.Header) *types.Body {
+			header.Time = 1_700_000_000 + header.Number.Uint64()
+			return nil
+		})
+		testutil.WriteCanonicalHeaders(kv, chain[:100])
+		for _, block := range chain[100:] {
+			rawdb.WriteHeader(kv, block.Header())
+		}
+		tipFor = func(source string, tip *db.TipInfo) db.TipCandidate {
+			for _, c := range tip.Candidates {
+				if c.Source == source {
+					return c
+				}
+			}
+			Fail("no candidate " + source)
+			return db.TipCandidate{}
+		}
+	})
+
+	It("should agree when every signal points at the same block", func() {
+		for _, key := range []string{"LastBlock", "LastHeader", "LastFast"} {
+			Expect(kv.Put([]byte(key), chain[99].Hash().Bytes())).To(Succeed())
+		}
+		for _, block := range chain[100:] {
+			rawdb.DeleteHeader(kv, block.Hash(), block.NumberU64())
+		}
+
+		tip, err := db.NewInspector(nil, kv).FindTip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip.Disagree()).To(BeFalse())
+		Expect(tip.Source).To(Equal(db.TipLastBlock))
+		Expect(tip.Height).To(BeEquivalentTo(99))
+		Expect(tip.Hash).To(Equal(chain[99].Hash().Bytes()))
+		Expect(tip.ParentHash).To(Equal(chain[98].Hash().Bytes()))
+		Expect(tip.Timestamp).To(BeEquivalentTo(1_700_000_099))
+		Expect(tip.Candidates).To(HaveLen(5))
+	})
+
+	It("should find the canonical tip of a database with frozen blocks", func() {
+		for _, key := range []string{"LastBlock", "LastHeader", "LastFast"} {
+			Expect(kv.Put([]byte(key), chain[99].Hash().Bytes())).To(Succeed())
+		}
+		for _, block := range chain[100:] {
+			rawdb.DeleteHeader(kv, block.Hash(), block.NumberU64())
+		}
+		for _, block := range chain[:60] {
+			rawdb.WriteBody(kv, block.Hash(), block.NumberU64(), block.Body())
+			rawdb.WriteReceipts(kv, block.Hash(), block.NumberU64(), nil)
+		}
+		ancient := filepath.Join(GinkgoT().TempDir(), "ancient")
+		_, err := database.Freeze(kv, ancient, 60, nil)
+		Expect(err).NotTo(HaveOccurred())
+		frozen, err := rawdb.Open(kv, rawdb.OpenOptions{Ancient: ancient, ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		defer frozen.Close()
+
+		tip, err := db.NewInspector(nil, frozen).FindTip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip.Disagree()).To(BeFalse())
+		canonical := tipFor(db.TipCanonical, tip)
+		Expect(canonical.Err).To(BeEmpty())
+		Expect(canonical.Number).To(BeEquivalentTo(99))
+		Expect(canonical.Hash).To(Equal(chain[99].Hash()))
+	})
+
+	It("should report each signal where they disagree", func() {
+		rawdb.WriteHeadBlockHash(kv, chain[50].Hash())
+		rawdb.WriteHeadHeaderHash(kv, chain[101].Hash())
+
+		tip, err := db.NewInspector(nil, kv).FindTip()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip.Disagree()).To(BeTrue())
+		Expect(tip.Height).To(BeEquivalentTo(50))
+
+		Expect(tipFor(db.TipLastBlock, tip).Number).To(BeEquivalentTo(50))
+		Expect(tipFor(db.TipLastHeader, tip).Number).To(BeEquivalentTo(101))
+		Expect(tipFor(db.TipLastHeader, tip).ParentHash).To(Equal(chain[100].Hash()))
+		Expect(tipFor(db.TipLastFast, tip).Err).To(Equal("not set"))
+
+		canonical := tipFor(db.TipCanonical, tip)
+		Expect(canonical.Err).To(BeEmpty())
+		Expect(canonical.Number).To(BeEquivalentTo(99))
+		Expect(canonical.Hash).To(Equal(chain[99].Hash()))
+
+		highest := tipFor(db.TipHighestHeader, tip)
+		Expect(highest.Err).To(BeEmpty())
+		Expect(highest.Number).To(BeEquivalentTo(102))
+		Expect(highest.Hash).To(Equal(chain[102].Hash()))
+		Expect(highest.Timestamp).To(BeEquivalentTo(1_700_000_102))
+	})
+
+	It("should flag head pointers that store a height", func() {
+		Expect(kv.Put([]byte("LastBlock"), binary.BigEndian.AppendUint64(nil, 42))).To(Succeed())
+
+		tip, err := db.NewInspector(nil, kv).FindTip()
+		Expect(err).NotTo(HaveOccurred())
+		last := tipFor(db.TipLastBlock, tip)
+		Expect(last.Number).To(BeEquivalentTo(42))
+		Expect(last.Hash).To(Equal(chain[42].Hash()))
+		Expect(last.Err).To(ContainSubstring("stores height 42"))
+		Expect(tip.Source).To(Equal(db.TipCanonical))
+		Expect(tip.Height).To(BeEquivalentTo(99))
+	})
+})
@@ -0,0 +1,96 @@
+package invariant_test
+
+import (
+	"bytes"
+
+	"github.com/luxfi/genesis/pkg/invariant"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// violations runs every registered invariant and returns the names of the
+// violated ones with their messages
+func violations(db ethdb.Database) map[string][]string {
+	found := make(map[string][]string)
+	for _, r := range invariant.Check(db, invariant.All()) {
+		Expect(r.Err).NotTo(HaveOccurred())
+		for _, v := range r.Violations {
+			found[v.Invariant] = append(found[v.Invariant], v.Message)
+		}
+	}
+	return found
+}
+
+var _ = Describe("Invariants", func() {
+	var (
+		db     ethdb.Database
+		blocks []*types.Block
+	)
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+		blocks = testutil.Chain(10, nil)
+		testutil.WriteChain(db, blocks)
+		testutil.WriteHead(db, blocks[9].Hash())
+		Expect(db.Put(append([]byte("ethereum-config-"), blocks[0].Hash().Bytes()...), []byte(`{"chainId":96369}`))).To(Succeed())
+	})
+
+	It("should pass every invariant on a consistent database", func() {
+		Expect(violations(db)).To(BeEmpty())
+	})
+
+	It("should report broken heads, gaps, missing data and a missing chain config", func() {
+		rawdb.WriteHeadBlockHash(db, common.HexToHash("0x1234"))
+		rawdb.DeleteBody(db, blocks[3].Hash(), 3)
+		rawdb.DeleteCanonicalHash(db, 6)
+		Expect(db.Delete(append([]byte("ethereum-config-"), blocks[0].Hash().Bytes()...))).To(Succeed())
+
+		found := violations(db)
+		Expect(found).To(HaveLen(4))
+		Expect(found["head-block"]).To(ConsistOf(ContainSubstring("has no block number")))
+		Expect(found["canonical-continuity"]).To(ConsistOf("no canonical hash for block #6"))
+		Expect(found["block-data"]).To(ConsistOf(ContainSubstring("#3")))
+		Expect(found["chain-config"]).To(ConsistOf(ContainSubstring("no chain config")))
+	})
+
+	It("should select invariants by name and reject unknown names", func() {
+		selected, err := invariant.Select([]string{"chain-config", "head-block"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(HaveLen(2))
+		Expect(selected[0].Name()).To(Equal("head-block"))
+
+		_, err = invariant.Select([]string{"head-blok"})
+		Expect(err).To(MatchError(And(ContainSubstring(`unknown invariant "head-blok"`), ContainSubstring("canonical-continuity"))))
+	})
+
+	It("should plan head fixes and change nothing until the plan is applied", func() {
+		rawdb.WriteHeadHeaderHash(db, common.HexToHash("0x1234"))
+		rawdb.DeleteBody(db, blocks[9].Hash(), 9)
+		rawdb.DeleteCanonicalHash(db, 8)
+
+		results := invariant.Check(db, invariant.All())
+		plans, unfixed, err := invariant.PlanFixes(db, results)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unfixed).To(ConsistOf("canonical-continuity", "block-data"))
+		Expect(plans).To(HaveLen(3))
+
+		var preview bytes.Buffer
+		for _, plan := range plans {
+			plan.Print(&preview)
+		}
+		Expect(preview.String()).To(ContainSubstring("set LastHeader to #7 " + blocks[7].Hash().Hex()))
+		Expect(rawdb.ReadHeadHeaderHash(db)).To(Equal(common.HexToHash("0x1234")))
+
+		for _, plan := range plans {
+			Expect(plan.Apply(db)).To(Succeed())
+		}
+		Expect(rawdb.ReadHeadBlockHash(db)).To(Equal(blocks[7].Hash()))
+		Expect(rawdb.ReadHeadHeaderHash(db)).To(Equal(blocks[7].Hash()))
+		Expect(rawdb.ReadHeadFastBlockHash(db)).To(Equal(blocks[7].Hash()))
+	})
+})
@@ -0,0 +1,93 @@
+package migration_test
+
+import (
+	"context"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Block-range copy", func() {
+	var (
+		src    ethdb.Database
+		hashes []common.Hash
+		roots  []common.Hash
+	)
+
+	BeforeEach(func() {
+		src = rawdb.NewMemoryDatabase()
+		hashes, roots = nil, nil
+
+		// Block n holds a state with n+1 accounts
+		accounts := make(map[common.Address]testutil.Account)
+		blocks := testutil.Chain(20, func(header *types.Header) *types.Body {
+			n := header.Number.Uint64()
+			accounts[common.BytesToAddress([]byte{byte(n)})] = testutil.Account{Balance: n + 1}
+			header.Root = testutil.WriteState(src, accounts)
+			return nil
+		})
+		testutil.WriteChain(src, blocks)
+		testutil.WriteHead(src, blocks[19].Hash())
+		for _, block := range blocks {
+			hashes = append(hashes, block.Hash())
+			roots = append(roots, block.Root())
+		}
+		Expect(src.Put(append([]byte("ethereum-config-"), hashes[0].Bytes()...), []byte(`{"chainId":96369}`))).To(Succeed())
+	})
+
+	It("should copy only the blocks in range, genesis and the state at the end", func() {
+		dst := rawdb.NewMemoryDatabase()
+		stats, err := database.CopyBlockRange(context.Background(), src, dst, database.BlockRange{From: 5, To: 10}, 2, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Blocks).To(BeEquivalentTo(7))
+		Expect(stats.Head).To(Equal(hashes[10]))
+		Expect(stats.Root).To(Equal(roots[10]))
+		Expect(stats.State.Accounts).To(BeEquivalentTo(11))
+
+		for n, hash := range hashes {
+			inRange := n == 0 || (n >= 5 && n <= 10)
+			Expect(rawdb.ReadCanonicalHash(dst, uint64(n)) == hash).To(Equal(inRange), "block %d", n)
+			Expect(rawdb.HasBody(dst, hash, uint64(n))).To(Equal(inRange), "block %d", n)
+			Expect(rawdb.HasReceipts(dst, hash, uint64(n))).To(Equal(inRange), "block %d", n)
+		}
+		number, ok := rawdb.ReadHeaderNumber(dst, hashes[7])
+		Expect(ok).To(BeTrue())
+		Expect(number).To(BeEquivalentTo(7))
+
+		By("Pointing the heads at the last block")
+		Expect(rawdb.ReadHeadHeaderHash(dst)).To(Equal(hashes[10]))
+		Expect(rawdb.ReadHeadBlockHash(dst)).To(Equal(hashes[10]))
+		Expect(rawdb.ReadHeadFastBlockHash(dst)).To(Equal(hashes[10]))
+
+		By("Copying the chain config and only the reachable state")
+		config, err := dst.Get(append([]byte("ethereum-config-"), hashes[0].Bytes()...))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(config)).To(ContainSubstring("96369"))
+		_, err = state.Verify(context.Background(), dst, roots[10], 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rawdb.HasLegacyTrieNode(dst, roots[19])).To(BeFalse())
+	})
+
+	It("should end at the head block by default", func() {
+		dst := rawdb.NewMemoryDatabase()
+		stats, err := database.CopyBlockRange(context.Background(), src, dst, database.BlockRange{From: 15}, 2, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.To).To(BeEquivalentTo(19))
+		Expect(stats.Blocks).To(BeEquivalentTo(6))
+		Expect(rawdb.ReadHeadBlockHash(dst)).To(Equal(hashes[19]))
+	})
+
+	It("should fail when a block in range is missing", func() {
+		rawdb.DeleteCanonicalHash(src, 8)
+
+		_, err := database.CopyBlockRange(context.Background(), src, rawdb.NewMemoryDatabase(), database.BlockRange{From: 5, To: 10}, 2, nil)
+		Expect(err).To(MatchError(ContainSubstring("no canonical hash for block #8")))
+	})
+})
@@ -0,0 +1,198 @@
+package migration_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/luxfi/genesis/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DatabaseConverter", func() {
+	var tempDir string
+
+	BeforeEach(func() {
+		tempDir = filepath.Join(".", ".tmp", fmt.Sprintf("converter-%d", GinkgoRandomSeed()))
+		Expect(os.MkdirAll(tempDir, 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	It("should strip the namespace with several workers copying in parallel", func() {
+		sourcePath := filepath.Join(tempDir, "subnet")
+		destPath := filepath.Join(tempDir, "coreth")
+		namespace := make([]byte, 32)
+		namespace[0] = 0x33
+
+		By("Writing namespaced headers and state into a pebble source")
+		src, err := pebble.Open(sourcePath, &pebble.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		const blocks = 200
+		for i := uint64(1); i <= blocks; i++ {
+			key := make([]byte, 41)
+			key[0] = 'h'
+			binary.BigEndian.PutUint64(key[1:9], i)
+			key[9] = 0xaa
+			Expect(src.Set(append(namespace, key...), []byte("header"), pebble.NoSync)).To(Succeed())
+
+			state := make([]byte, 33)
+			state[0] = byte(i)
+			state[1] = byte(i)
+			Expect(src.Set(append(namespace, state...), []byte("node"), pebble.NoSync)).To(Succeed())
+		}
+		Expect(src.Close()).To(Succeed())
+
+		By("Converting with four workers")
+		converter := database.NewDatabaseConverter(&database.ConversionConfig{
+			SourcePath:     sourcePath,
+			DestPath:       destPath,
+			SourceType:     database.PebbleDB,
+			DestType:       database.BadgerDB,
+			ConversionType: database.SubnetToCoreth,
+			Namespace:      namespace,
+			BatchSize:      17,
+			FixCanonical:   true,
+			Workers:        4,
+		})
+		Expect(converter.Convert()).To(Succeed())
+		Expect(database.CheckpointPath(destPath)).NotTo(BeAnExistingFile())
+
+		By("Checking every key arrived without its namespace")
+		opts := badger.DefaultOptions(destPath)
+		opts.Logger = nil
+		dst, err := badger.Open(opts)
+		Expect(err).NotTo(HaveOccurred())
+		defer dst.Close()
+
+		headers, canonical, total := 0, 0, 0
+		Expect(dst.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				key := it.Item().Key()
+				Expect(key).NotTo(HavePrefix(string(namespace)))
+				switch {
+				case len(key) == 41 && key[0] == 'h':
+					headers++
+				case len(key) == 10 && key[0] == 'h' && key[9] == 'n':
+					canonical++
+				}
+				total++
+			}
+			return nil
+		})).To(Succeed())
+		Expect(headers).To(Equal(blocks))
+		Expect(canonical).To(Equal(blocks))
+		// Headers, state nodes, canonical mappings and three head pointers
+		Expect(total).To(Equal(3*blocks + 3))
+	})
+
+	It("should copy pebble to badger in parallel ranges", func() {
+		sourcePath := filepath.Join(tempDir, "pebble")
+		destPath := filepath.Join(tempDir, "badger")
+
+		src, err := pebble.Open(sourcePath, &pebble.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 256; i++ {
+			Expect(src.Set([]byte{byte(i), 'k'}, []byte{byte(i)}, pebble.NoSync)).To(Succeed())
+		}
+		Expect(src.Close()).To(Succeed())
+
+		converter := database.NewDatabaseConverter(&database.ConversionConfig{
+			SourcePath:     sourcePath,
+			DestPath:       destPath,
+			ConversionType: database.PebbleToBadger,
+			BatchSize:      10,
+			Workers:        4,
+		})
+		Expect(converter.Convert()).To(Succeed())
+		Expect(database.CheckpointPath(destPath)).NotTo(BeAnExistingFile())
+
+		opts := badger.DefaultOptions(destPath)
+		opts.Logger = nil
+		dst, err := badger.Open(opts)
+		Expect(err).NotTo(HaveOccurred())
+		defer dst.Close()
+		total := 0
+		Expect(dst.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				value, err := it.Item().ValueCopy(nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(value).To(Equal(it.Item().Key()[:1]))
+				total++
+			}
+			return nil
+		})).To(Succeed())
+		Expect(total).To(Equal(256))
+	})
+
+	It("should convert a leveldb snapshot to pebble and back", func() {
+		levelPath := filepath.Join(tempDir, "leveldb")
+		pebblePath := filepath.Join(tempDir, "pebble")
+		roundTripPath := filepath.Join(tempDir, "leveldb-copy")
+		namespace := make([]byte, 32)
+		namespace[0] = 0x44
+
+		By("Writing namespaced and foreign keys into a leveldb source")
+		src, err := database.OpenKeyValueStore(database.LevelDB, levelPath, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 100; i++ {
+			Expect(src.Put(append(bytes.Clone(namespace), 'c', byte(i)), []byte{byte(i)})).To(Succeed())
+			Expect(src.Put([]byte{0xff, byte(i)}, []byte("other chain"))).To(Succeed())
+		}
+		Expect(src.Close()).To(Succeed())
+
+		convert := func(conversion database.ConversionType, from, to string, namespace []byte) {
+			converter := database.NewDatabaseConverter(&database.ConversionConfig{
+				SourcePath:     from,
+				DestPath:       to,
+				ConversionType: conversion,
+				Namespace:      namespace,
+				BatchSize:      7,
+				Workers:        4,
+			})
+			Expect(converter.Convert()).To(Succeed())
+		}
+		count := func(dbType database.DatabaseType, path string) int {
+			db, err := database.OpenKeyValueStore(dbType, path, database.BackendOptions{ReadOnly: true})
+			Expect(err).NotTo(HaveOccurred())
+			defer db.Close()
+			it := db.NewIterator(nil, nil)
+			defer it.Release()
+			n := 0
+			for it.Next() {
+				Expect(it.Key()).To(HaveLen(2))
+				Expect(it.Key()[0]).To(Equal(byte('c')))
+				n++
+			}
+			return n
+		}
+
+		By("Refusing a destination type the conversion does not write")
+		err = database.NewDatabaseConverter(&database.ConversionConfig{
+			SourcePath:     levelPath,
+			DestPath:       pebblePath,
+			DestType:       database.BadgerDB,
+			ConversionType: database.LevelDBToPebble,
+		}).Convert()
+		Expect(err).To(MatchError(ContainSubstring("need a pebbledb destination")))
+
+		By("Stripping the namespace on the way to pebble")
+		convert(database.LevelDBToPebble, levelPath, pebblePath, namespace)
+		Expect(count(database.PebbleDB, pebblePath)).To(Equal(100))
+
+		By("Copying everything back into a new leveldb")
+		convert(database.PebbleToLevelDB, pebblePath, roundTripPath, nil)
+		Expect(count(database.LevelDB, roundTripPath)).To(Equal(100))
+	})
+})
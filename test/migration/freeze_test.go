@@ -0,0 +1,98 @@
+package migration_test
+
+import (
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Freeze", func() {
+	var (
+		kv     ethdb.KeyValueStore
+		blocks []*types.Block
+		hashes []common.Hash
+	)
+
+	BeforeEach(func() {
+		kv = memorydb.New()
+		blocks, hashes = testutil.Chain(30, nil), nil
+		for _, block := range blocks {
+			hashes = append(hashes, block.Hash())
+		}
+		testutil.WriteChain(kv, blocks)
+		testutil.WriteHead(kv, hashes[29])
+	})
+
+	It("should move old blocks into the freezer and keep them readable", func() {
+		ancient := filepath.Join(GinkgoT().TempDir(), "ancient")
+
+		stats, err := database.Freeze(kv, ancient, 20, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Blocks).To(BeEquivalentTo(20))
+		Expect(stats.To).To(BeEquivalentTo(19))
+
+		By("Dropping the key-value copies except for the genesis and number lookups")
+		plain := rawdb.NewDatabase(kv)
+		Expect(rawdb.ReadHeaderRLP(plain, hashes[5], 5)).To(BeEmpty())
+		Expect(rawdb.ReadCanonicalHash(plain, 5)).To(Equal(common.Hash{}))
+		number, ok := rawdb.ReadHeaderNumber(plain, hashes[5])
+		Expect(ok).To(BeTrue())
+		Expect(number).To(BeEquivalentTo(5))
+		Expect(rawdb.ReadHeaderRLP(plain, hashes[0], 0)).NotTo(BeEmpty())
+		Expect(rawdb.ReadHeaderRLP(plain, hashes[20], 20)).NotTo(BeEmpty())
+
+		By("Skipping blocks that are already frozen")
+		stats, err = database.Freeze(kv, ancient, 20, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Blocks).To(BeZero())
+
+		By("Reading every block through geth with the freezer attached")
+		db, err := rawdb.Open(kv, rawdb.OpenOptions{Ancient: ancient, ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		for number, hash := range hashes {
+			Expect(rawdb.ReadCanonicalHash(db, uint64(number))).To(Equal(hash))
+			block := rawdb.ReadBlock(db, hash, uint64(number))
+			Expect(block).NotTo(BeNil())
+			Expect(block.Hash()).To(Equal(hash))
+		}
+		Expect(db.Close()).To(Succeed())
+	})
+
+	It("should finish deleting the blocks an interrupted run froze", func() {
+		ancient := filepath.Join(GinkgoT().TempDir(), "ancient")
+		_, err := database.Freeze(kv, ancient, 20, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Put back the last chunk as if the run stopped before deleting it
+		for _, block := range blocks[10:20] {
+			rawdb.WriteBlock(kv, block)
+			rawdb.WriteReceipts(kv, block.Hash(), block.NumberU64(), nil)
+			rawdb.WriteCanonicalHash(kv, block.Hash(), block.NumberU64())
+		}
+
+		stats, err := database.Freeze(kv, ancient, 20, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Blocks).To(BeZero())
+		plain := rawdb.NewDatabase(kv)
+		for number := uint64(10); number < 20; number++ {
+			Expect(rawdb.ReadHeaderRLP(plain, hashes[number], number)).To(BeEmpty())
+			Expect(rawdb.ReadReceiptsRLP(plain, hashes[number], number)).To(BeEmpty())
+			Expect(rawdb.ReadCanonicalHash(plain, number)).To(Equal(common.Hash{}))
+		}
+		Expect(rawdb.ReadHeaderRLP(plain, hashes[0], 0)).NotTo(BeEmpty())
+		Expect(rawdb.ReadHeaderRLP(plain, hashes[20], 20)).NotTo(BeEmpty())
+	})
+
+	It("should refuse to freeze past the head block", func() {
+		_, err := database.Freeze(kv, filepath.Join(GinkgoT().TempDir(), "ancient"), 100, nil)
+		Expect(err).To(MatchError(ContainSubstring("head block is 29")))
+	})
+})
@@ -0,0 +1,133 @@
+package migration_test
+
+import (
+	"math/big"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/rlp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Header conversion", func() {
+	blobGas := uint64(131072)
+	excessBlobGas := uint64(0)
+	beaconRoot := common.HexToHash("0xbeac0b")
+
+	subnetHeader := func() *migration.SubnetEVMHeader {
+		h := testutil.SubnetHeader(1000, common.HexToHash("0x01"))
+		h.Root = common.HexToHash("0x02")
+		h.GasUsed = 21_000
+		h.Time = 1_700_000_000
+		h.Extra = make([]byte, 80)
+		h.BlockGasCost = big.NewInt(100_000)
+		return h
+	}
+
+	encode := func(header interface{}) ([]byte, common.Hash) {
+		data, err := rlp.EncodeToBytes(header)
+		Expect(err).NotTo(HaveOccurred())
+		return data, crypto.Keccak256Hash(data)
+	}
+
+	It("should keep the hash of a SubnetEVM header with BlockGasCost", func() {
+		data, hash := encode(subnetHeader())
+
+		header, converted, err := migration.ConvertHeader(data, hash)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(converted).To(Equal(data))
+		Expect(header.Layout).To(Equal(migration.LayoutSubnetEVM))
+		Expect(header.BlockGasCost).To(Equal(big.NewInt(100_000)))
+		Expect(header.Hash()).To(Equal(hash))
+	})
+
+	It("should keep the blob and beacon root fields of a Cancun SubnetEVM header", func() {
+		h := subnetHeader()
+		h.BlobGasUsed = &blobGas
+		h.ExcessBlobGas = &excessBlobGas
+		h.ParentBeaconBlockRoot = &beaconRoot
+		data, hash := encode(h)
+
+		header, _, err := migration.ConvertHeader(data, hash)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Layout).To(Equal(migration.LayoutSubnetEVMCancun))
+		Expect(*header.BlobGasUsed).To(Equal(blobGas))
+		Expect(*header.ExcessBlobGas).To(BeZero())
+		Expect(*header.ParentBeaconBlockRoot).To(Equal(beaconRoot))
+		Expect(header.BlockGasCost).To(Equal(big.NewInt(100_000)))
+	})
+
+	It("should round-trip geth Cancun headers into an identical geth header", func() {
+		withdrawals := types.EmptyWithdrawalsHash
+		geth := &types.Header{
+			Difficulty:       big.NewInt(0),
+			Number:           big.NewInt(5),
+			GasLimit:         30_000_000,
+			BaseFee:          big.NewInt(7),
+			WithdrawalsHash:  &withdrawals,
+			BlobGasUsed:      &blobGas,
+			ExcessBlobGas:    &excessBlobGas,
+			ParentBeaconRoot: &beaconRoot,
+		}
+		data, hash := encode(geth)
+
+		header, _, err := migration.ConvertHeader(data, hash)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Layout).To(Equal(migration.LayoutCancun))
+		standard, err := header.ToStandardHeader()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(standard.Hash()).To(Equal(hash))
+	})
+
+	It("should refuse to turn a SubnetEVM header into a geth header", func() {
+		_, err := subnetHeader().ToStandardHeader()
+		Expect(err).To(MatchError(ContainSubstring("subnet-evm header has fields a geth header cannot hold")))
+	})
+
+	It("should tell unsupported layouts apart and still read their legacy fields", func() {
+		data, _ := encode(subnetHeader())
+		var fields []rlp.RawValue
+		Expect(rlp.DecodeBytes(data, &fields)).To(Succeed())
+		extra, err := rlp.EncodeToBytes(uint64(1))
+		Expect(err).NotTo(HaveOccurred())
+		data, hash := encode(append(fields, extra))
+
+		_, _, err = migration.ConvertHeader(data, hash)
+		Expect(err).To(MatchError(migration.ErrUnsupportedLayout))
+
+		header, err := migration.DecodeHeaderFields(data, hash)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Layout).To(Equal(migration.LayoutUnsupported))
+		Expect(header.Number).To(Equal(big.NewInt(1000)))
+		Expect(header.ParentHash).To(Equal(common.HexToHash("0x01")))
+
+		_, err = migration.DecodeHeaderFields(data, common.HexToHash("0xbad"))
+		Expect(err).To(MatchError(migration.ErrHeaderHashMismatch))
+	})
+
+	It("should fail loudly when the header does not match its key hash", func() {
+		data, _ := encode(subnetHeader())
+
+		_, _, err := migration.ConvertHeader(data, common.HexToHash("0xbad"))
+		Expect(err).To(MatchError(migration.ErrHeaderHashMismatch))
+	})
+
+	It("should group consecutive blocks by layout", func() {
+		var tracker migration.LayoutTracker
+		for n := uint64(0); n < 10; n++ {
+			tracker.Observe(n, migration.LayoutSubnetEVM)
+		}
+		for n := uint64(10); n < 15; n++ {
+			tracker.Observe(n, migration.LayoutSubnetEVMCancun)
+		}
+
+		Expect(tracker.Ranges()).To(Equal([]migration.LayoutRange{
+			{Layout: migration.LayoutSubnetEVM, From: 0, To: 9},
+			{Layout: migration.LayoutSubnetEVMCancun, From: 10, To: 14},
+		}))
+	})
+})
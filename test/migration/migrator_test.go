@@ -0,0 +1,127 @@
+package migration_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/migration"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrator", func() {
+	var tempDir string
+
+	BeforeEach(func() {
+		tempDir = filepath.Join(".", ".tmp", fmt.Sprintf("migrator-%d", GinkgoRandomSeed()))
+		Expect(os.MkdirAll(tempDir, 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	It("should copy every key between backends with the full-copy strategy", func() {
+		sourcePath := filepath.Join(tempDir, "source")
+		destPath := filepath.Join(tempDir, "dest")
+
+		By("Writing test data into a pebble source")
+		src, err := database.OpenEthDB(database.PebbleDB, sourcePath, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 100; i++ {
+			Expect(src.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%d", i)))).To(Succeed())
+		}
+		Expect(src.Close()).To(Succeed())
+
+		By("Running the migrator into a badger destination")
+		m, err := migration.NewMigrator(migration.Config{
+			SourceDBPath: sourcePath,
+			DestDBPath:   destPath,
+			DestType:     database.BadgerDB,
+			Strategy:     &migration.FullCopyStrategy{},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Run()).To(Succeed())
+		m.Close()
+
+		By("Reading the data back from the destination")
+		dst, err := database.OpenEthDB(database.BadgerDB, destPath, database.BackendOptions{ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		defer dst.Close()
+
+		count := 0
+		iter := dst.NewIterator([]byte("key-"), nil)
+		for iter.Next() {
+			Expect(string(iter.Value())).To(Equal(fmt.Sprintf("value-%d", count)))
+			count++
+		}
+		iter.Release()
+		Expect(count).To(Equal(100))
+	})
+
+	It("should resume a full copy after the last checkpointed key", func() {
+		sourcePath := filepath.Join(tempDir, "source")
+		destPath := filepath.Join(tempDir, "dest")
+
+		src, err := database.OpenEthDB(database.PebbleDB, sourcePath, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 100; i++ {
+			Expect(src.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte("v"))).To(Succeed())
+		}
+		Expect(src.Close()).To(Succeed())
+
+		By("Saving a checkpoint as if the first half had been copied")
+		cfg := map[string]string{"strategy": "FullCopy"}
+		checkpointer, err := database.NewCheckpointer(sourcePath, destPath, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpointer.Save("copy", []byte("key-049"), map[string]int{"keys": 50})).To(Succeed())
+
+		saved, err := checkpointer.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(saved.LastKey).To(BeEquivalentTo("key-049"))
+
+		By("Resuming the copy from the checkpoint")
+		src, err = database.OpenEthDB(database.PebbleDB, sourcePath, database.BackendOptions{ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		dst, err := database.OpenEthDB(database.PebbleDB, destPath, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		strategy := &migration.FullCopyStrategy{}
+		strategy.SetCheckpoint(checkpointer, saved)
+		Expect(strategy.Migrate(src, dst)).To(Succeed())
+
+		has, _ := dst.Has([]byte("key-049"))
+		Expect(has).To(BeFalse())
+		has, _ = dst.Has([]byte("key-050"))
+		Expect(has).To(BeTrue())
+		has, _ = dst.Has([]byte("key-099"))
+		Expect(has).To(BeTrue())
+		Expect(src.Close()).To(Succeed())
+		Expect(dst.Close()).To(Succeed())
+
+		By("Refusing to resume with a different configuration")
+		other, err := database.NewCheckpointer(sourcePath, destPath, map[string]string{"strategy": "Other"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = other.Load()
+		Expect(err).To(MatchError(database.ErrCheckpointMismatch))
+
+		By("Refusing to resume once the source has changed")
+		Expect(os.WriteFile(filepath.Join(sourcePath, "999999.sst"), []byte("x"), 0644)).To(Succeed())
+		changed, err := database.NewCheckpointer(sourcePath, destPath, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = changed.Load()
+		Expect(err).To(MatchError(database.ErrCheckpointMismatch))
+	})
+
+	It("should reject unknown backend types", func() {
+		_, err := migration.NewMigrator(migration.Config{
+			SourceDBPath: filepath.Join(tempDir, "source"),
+			DestDBPath:   filepath.Join(tempDir, "dest"),
+			SourceType:   database.DatabaseType("rocksdb"),
+			Strategy:     &migration.FullCopyStrategy{},
+		})
+		Expect(err).To(MatchError(ContainSubstring("unsupported database type")))
+	})
+})
@@ -0,0 +1,94 @@
+package migration_test
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Namespace detection", func() {
+	// writeChain fills db with the header tables of a short chain under namespace
+	writeChain := func(db ethdb.KeyValueWriter, namespace []byte, blocks uint64) {
+		for i := uint64(0); i < blocks; i++ {
+			num := make([]byte, 8)
+			binary.BigEndian.PutUint64(num, i)
+			hash := sha256.Sum256(num)
+
+			header := append(append(append(append([]byte{}, namespace...), 'h'), num...), hash[:]...)
+			Expect(db.Put(header, []byte("header"))).To(Succeed())
+			canonical := append(append(append(append([]byte{}, namespace...), 'h'), num...), 'n')
+			Expect(db.Put(canonical, hash[:])).To(Succeed())
+		}
+	}
+
+	// writeState adds un-namespaced hash-keyed entries as noise
+	writeState := func(db ethdb.KeyValueWriter, entries int) {
+		for i := 0; i < entries; i++ {
+			hash := sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+			Expect(db.Put(append([]byte("c"), hash[:]...), []byte("code"))).To(Succeed())
+		}
+	}
+
+	namespace := func(first byte) []byte {
+		ns := sha256.Sum256([]byte{first})
+		ns[0] = first
+		return ns[:]
+	}
+
+	It("should find and confirm the namespace of a SubnetEVM database", func() {
+		db := rawdb.NewMemoryDatabase()
+		ns := namespace(0x33)
+		writeChain(db, ns, 100)
+		writeState(db, 500)
+
+		detected, err := database.DetectNamespace(db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(detected).To(Equal(ns))
+
+		candidates, err := database.DetectNamespaces(db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(candidates[0].Confirmed).To(BeTrue())
+		Expect(candidates[0].CanonicalBlock).To(BeZero())
+	})
+
+	It("should report when there is no namespace", func() {
+		db := rawdb.NewMemoryDatabase()
+		writeChain(db, nil, 100)
+		writeState(db, 500)
+
+		_, err := database.DetectNamespace(db)
+		Expect(err).To(MatchError(database.ErrNoNamespace))
+	})
+
+	It("should find every chain whose namespace starts with the same byte", func() {
+		db := rawdb.NewMemoryDatabase()
+		large, small := namespace(0x33), namespace(0x33)
+		small[1]++
+		writeChain(db, large, 500)
+		writeChain(db, small, 20)
+
+		candidates, err := database.DetectNamespaces(db)
+		Expect(err).NotTo(HaveOccurred())
+		var confirmed [][]byte
+		for _, c := range candidates {
+			if c.Confirmed {
+				confirmed = append(confirmed, c.Prefix)
+			}
+		}
+		Expect(confirmed).To(ConsistOf(large, small))
+	})
+
+	It("should refuse to pick between several chains", func() {
+		db := rawdb.NewMemoryDatabase()
+		writeChain(db, namespace(0x33), 50)
+		writeChain(db, namespace(0x9a), 50)
+
+		_, err := database.DetectNamespace(db)
+		Expect(err).To(MatchError(ContainSubstring("found 2 namespaces")))
+	})
+})
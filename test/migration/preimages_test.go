@@ -0,0 +1,167 @@
+package migration_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// cancelWriter cancels a context on its first write
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+var _ = Describe("Preimage recovery", func() {
+	var (
+		db       ethdb.Database
+		root     common.Hash
+		sender   common.Address
+		resolved []common.Address
+		unknown  common.Address
+	)
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+		key, err := crypto.GenerateKey()
+		Expect(err).NotTo(HaveOccurred())
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+
+		var (
+			recipient = common.HexToAddress("0x1000000000000000000000000000000000000001")
+			created   = crypto.CreateAddress(sender, 0)
+			inTopic   = common.HexToAddress("0x2000000000000000000000000000000000000002")
+			inData    = common.HexToAddress("0x3000000000000000000000000000000000000003")
+			allocated = common.HexToAddress("0x4000000000000000000000000000000000000004")
+		)
+		unknown = common.HexToAddress("0x5000000000000000000000000000000000000005")
+		resolved = []common.Address{sender, recipient, created, inTopic, inData, allocated}
+
+		accounts := make(map[common.Address]testutil.Account)
+		for i, address := range append(resolved, unknown) {
+			accounts[address] = testutil.Account{Nonce: uint64(i), Balance: 1}
+		}
+		root = testutil.WriteState(db, accounts)
+
+		signer := types.LatestSignerForChainID(big.NewInt(96369))
+		create, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   big.NewInt(96369),
+			Nonce:     0,
+			Gas:       100_000,
+			GasFeeCap: big.NewInt(25),
+			Data:      []byte{0x60, 0x00},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		transfer, err := types.SignNewTx(key, signer, &types.LegacyTx{
+			Nonce:    1,
+			To:       &recipient,
+			Gas:      21_000,
+			GasPrice: big.NewInt(25),
+			Value:    big.NewInt(1),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		blocks := testutil.Chain(2, func(header *types.Header) *types.Body {
+			header.Root = root
+			if header.Number.Sign() == 0 {
+				return nil
+			}
+			return &types.Body{Transactions: types.Transactions{create, transfer}}
+		})
+		testutil.WriteChain(db, blocks)
+		testutil.WriteHead(db, blocks[1].Hash())
+		genesis, block := blocks[0], blocks[1]
+		rawdb.WriteReceipts(db, block.Hash(), 1, types.Receipts{
+			{
+				Status: types.ReceiptStatusSuccessful,
+				Logs: []*types.Log{{
+					Address: created,
+					Topics:  []common.Hash{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")), common.BytesToHash(inTopic.Bytes())},
+					Data:    append(common.BytesToHash(inData.Bytes()).Bytes(), common.BigToHash(big.NewInt(1e18)).Bytes()...),
+				}},
+			},
+			{Status: types.ReceiptStatusSuccessful},
+		})
+
+		alloc, err := json.Marshal(map[string]interface{}{allocated.Hex(): map[string]string{"balance": "0x1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.Put(append([]byte("ethereum-genesis-"), genesis.Hash().Bytes()...), alloc)).To(Succeed())
+	})
+
+	It("should write preimages for every account found in the chain", func() {
+		stats, err := database.BuildPreimages(context.Background(), db, database.PreimageConfig{Root: root})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Accounts).To(BeEquivalentTo(7))
+		Expect(stats.Blocks).To(BeEquivalentTo(2))
+		Expect(stats.Transactions).To(BeEquivalentTo(2))
+		Expect(stats.Logs).To(BeEquivalentTo(1))
+		Expect(stats.Recovered).To(BeEquivalentTo(6))
+		Expect(stats.Resolved()).To(BeNumerically("~", 600.0/7, 0.01))
+
+		for _, address := range resolved {
+			Expect(rawdb.ReadPreimage(db, crypto.Keccak256Hash(address.Bytes()))).To(Equal(address.Bytes()), address.Hex())
+		}
+		Expect(rawdb.ReadPreimage(db, crypto.Keccak256Hash(unknown.Bytes()))).To(BeEmpty())
+
+		By("Counting the written preimages as known on a second run")
+		stats, err = database.BuildPreimages(context.Background(), db, database.PreimageConfig{Root: root, Addresses: []common.Address{unknown}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Known).To(BeEquivalentTo(6))
+		Expect(stats.Recovered).To(BeEquivalentTo(1))
+		Expect(stats.Resolved()).To(BeEquivalentTo(100))
+
+		By("Showing the addresses in a state dump")
+		var out bytes.Buffer
+		dumped, err := state.Dump(context.Background(), db, state.DumpConfig{Root: root}, &out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dumped.Addresses).To(BeEquivalentTo(7))
+		Expect(out.String()).To(ContainSubstring(strings.ToLower(sender.Hex())))
+	})
+
+	It("should skip heights without a canonical block", func() {
+		rawdb.DeleteCanonicalHash(db, 0)
+
+		stats, err := database.BuildPreimages(context.Background(), db, database.PreimageConfig{Root: root})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Missing).To(BeEquivalentTo(1))
+		Expect(stats.Blocks).To(BeEquivalentTo(1))
+		// The genesis alloc is only found through the canonical genesis block
+		Expect(stats.Recovered).To(BeEquivalentTo(5))
+	})
+
+	It("should write the preimages found before a cancellation", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		progress := &cancelWriter{cancel: cancel}
+
+		stats, err := database.BuildPreimages(ctx, db, database.PreimageConfig{Root: root, Addresses: []common.Address{unknown}, Progress: progress})
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(stats.Blocks).To(BeZero())
+		Expect(stats.Recovered).To(BeEquivalentTo(2))
+		Expect(rawdb.ReadPreimage(db, crypto.Keccak256Hash(unknown.Bytes()))).To(Equal(unknown.Bytes()))
+	})
+
+	It("should read a genesis file alloc", func() {
+		addresses, err := database.GenesisAllocAddresses([]byte(`{"config":{"chainId":96369},"alloc":{"9011E888251AB053B7bD1cdB598Db4f9DEd94714":{"balance":"0x1"}}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addresses).To(Equal([]common.Address{common.HexToAddress("0x9011E888251AB053B7bD1cdB598Db4f9DEd94714")}))
+	})
+})
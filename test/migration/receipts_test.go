@@ -0,0 +1,170 @@
+package migration_test
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/trie"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// v3Log and v3Receipt are the receipt storage layout of early Subnet-EVM
+// databases, with the block context stored in every log
+type v3Log struct {
+	Address     common.Address
+	Topics      []common.Hash
+	Data        []byte
+	BlockNumber uint64
+	TxHash      common.Hash
+	TxIndex     uint
+	BlockHash   common.Hash
+	Index       uint
+}
+
+type v3Receipt struct {
+	PostStateOrStatus []byte
+	CumulativeGasUsed uint64
+	Bloom             types.Bloom
+	TxHash            common.Hash
+	ContractAddress   common.Address
+	Logs              []*v3Log
+	GasUsed           uint64
+}
+
+var _ = Describe("Receipt conversion", func() {
+	var (
+		kv     ethdb.KeyValueStore
+		blocks []*types.Block
+	)
+
+	// writeBlock stores a block with a legacy and a dynamic fee transaction
+	// whose header commits to the given receipts
+	writeBlock := func(number int64, receipts types.Receipts) *types.Block {
+		txs := types.Transactions{
+			types.NewTx(&types.LegacyTx{Nonce: uint64(number), GasPrice: big.NewInt(1), Gas: 21000}),
+			types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(96369), Nonce: uint64(number), GasFeeCap: big.NewInt(2), Gas: 50000}),
+		}
+		for _, r := range receipts {
+			r.Bloom = types.CreateBloom(r)
+		}
+		header := testutil.Header(uint64(number), common.Hash{})
+		header.ReceiptHash = types.DeriveSha(receipts, trie.NewStackTrie(nil))
+		block := types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs})
+		rawdb.WriteBlock(kv, block)
+		rawdb.WriteCanonicalHash(kv, block.Hash(), block.NumberU64())
+		blocks = append(blocks, block)
+		return block
+	}
+
+	newReceipts := func() types.Receipts {
+		return types.Receipts{
+			{Type: types.LegacyTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000},
+			{Type: types.DynamicFeeTxType, Status: types.ReceiptStatusFailed, CumulativeGasUsed: 61000, Logs: []*types.Log{{
+				Address: common.HexToAddress("0x0100000000000000000000000000000000000000"),
+				Topics:  []common.Hash{common.HexToHash("0xdd")},
+				Data:    []byte{1, 2, 3},
+			}}},
+		}
+	}
+
+	BeforeEach(func() {
+		kv = memorydb.New()
+		blocks = nil
+
+		By("Storing block 1 in the v3 layout")
+		receipts := newReceipts()
+		block := writeBlock(1, receipts)
+		var legacy []*v3Receipt
+		for i, r := range receipts {
+			stored := &v3Receipt{CumulativeGasUsed: r.CumulativeGasUsed, Bloom: r.Bloom, GasUsed: 21000}
+			if r.Status == types.ReceiptStatusSuccessful {
+				stored.PostStateOrStatus = []byte{0x01}
+			}
+			for _, l := range r.Logs {
+				stored.Logs = append(stored.Logs, &v3Log{
+					Address: l.Address, Topics: l.Topics, Data: l.Data,
+					BlockNumber: 1, TxIndex: uint(i), BlockHash: block.Hash(),
+				})
+			}
+			legacy = append(legacy, stored)
+		}
+		enc, err := rlp.EncodeToBytes(legacy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kv.Put(receiptsKey(1, block.Hash()), enc)).To(Succeed())
+
+		By("Storing block 2 in the current layout")
+		receipts = newReceipts()
+		block = writeBlock(2, receipts)
+		rawdb.WriteReceipts(kv, block.Hash(), 2, receipts)
+
+		By("Storing block 3 with receipts that do not match its header")
+		block = writeBlock(3, newReceipts())
+		receipts = newReceipts()
+		receipts[1].CumulativeGasUsed = 70000
+		rawdb.WriteReceipts(kv, block.Hash(), 3, receipts)
+	})
+
+	It("should re-encode old layouts and report receipts that fail the root check", func() {
+		plain := rawdb.NewDatabase(kv)
+		current := rawdb.ReadReceiptsRLP(plain, blocks[1].Hash(), 2)
+		broken := rawdb.ReadReceiptsRLP(plain, blocks[2].Hash(), 3)
+
+		stats, err := database.ConvertReceipts(kv, 100, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Blocks).To(BeEquivalentTo(3))
+		Expect(stats.Schemas).To(Equal(map[string]uint64{
+			database.ReceiptSchemaV3:     1,
+			database.ReceiptSchemaStored: 1,
+		}))
+		Expect(stats.Reencoded).To(BeEquivalentTo(1))
+		Expect(stats.Invalid).To(BeEquivalentTo(1))
+		Expect(stats.Dropped).To(BeZero())
+		Expect(stats.Failures).To(HaveLen(1))
+		Expect(stats.Failures[0].Number).To(BeEquivalentTo(3))
+		Expect(stats.Failures[0].Reason).To(ContainSubstring("does not match header"))
+
+		By("Making the v3 receipts readable by geth")
+		receipts := rawdb.ReadRawReceipts(plain, blocks[0].Hash(), 1)
+		Expect(receipts).To(HaveLen(2))
+		Expect(receipts[0].Status).To(Equal(types.ReceiptStatusSuccessful))
+		Expect(receipts[1].Status).To(Equal(types.ReceiptStatusFailed))
+		Expect(receipts[1].CumulativeGasUsed).To(BeEquivalentTo(61000))
+		Expect(receipts[1].Logs).To(HaveLen(1))
+		Expect(receipts[1].Logs[0].Data).To(Equal([]byte{1, 2, 3}))
+
+		By("Leaving current receipts and the broken ones untouched")
+		Expect(rawdb.ReadReceiptsRLP(plain, blocks[1].Hash(), 2)).To(Equal(current))
+		Expect(rawdb.ReadReceiptsRLP(plain, blocks[2].Hash(), 3)).To(Equal(broken))
+	})
+
+	It("should keep receipts whose block body is missing", func() {
+		rawdb.DeleteBody(kv, blocks[1].Hash(), 2)
+
+		stats, err := database.ConvertReceipts(kv, 100, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Invalid).To(BeEquivalentTo(2))
+		Expect(stats.Failures[0].Reason).To(Equal("body is missing"))
+		Expect(rawdb.HasReceipts(rawdb.NewDatabase(kv), blocks[1].Hash(), 2)).To(BeTrue())
+	})
+
+	It("should delete receipts that fail validation when asked to", func() {
+		stats, err := database.ConvertReceipts(kv, 100, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Invalid).To(BeEquivalentTo(1))
+		Expect(stats.Dropped).To(BeEquivalentTo(1))
+		Expect(rawdb.HasReceipts(rawdb.NewDatabase(kv), blocks[2].Hash(), 3)).To(BeFalse())
+	})
+})
+
+func receiptsKey(number uint64, hash common.Hash) []byte {
+	return append(binary.BigEndian.AppendUint64([]byte("r"), number), hash.Bytes()...)
+}
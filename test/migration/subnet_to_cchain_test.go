@@ -0,0 +1,74 @@
+package migration_test
+
+import (
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SubnetToCChain", func() {
+	var (
+		sourcePath string
+		targetPath string
+		chain      []common.Hash
+		account    = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	)
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		sourcePath = filepath.Join(dir, "subnet")
+		targetPath = filepath.Join(dir, "cchain")
+
+		kv, err := database.OpenKeyValueStore(database.PebbleDB, sourcePath, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		namespace := common.FromHex("0x337fb73f9bcdac8c31a2d5f7b877ab1e8a2b7f2a1e9bf02a0a0e6c6fd164f1d1")
+		src := rawdb.NewTable(rawdb.NewDatabase(kv), string(namespace))
+		root := testutil.WriteState(src, map[common.Address]testutil.Account{account: {Balance: 7}})
+		chain = testutil.WriteSubnetChain(src, 6, func(header *migration.SubnetEVMHeader) {
+			header.Root = root
+		})
+		Expect(kv.Close()).To(Succeed())
+	})
+
+	It("should store a block range where rawdb finds it and migrate it again", func() {
+		migrator, err := migration.NewSubnetToCChain(sourcePath, targetPath)
+		Expect(err).NotTo(HaveOccurred())
+		migrator.FromBlock, migrator.ToBlock = 1, 3
+		Expect(migrator.Migrate()).To(Succeed())
+
+		By("Running the same migrator a second time")
+		Expect(migrator.Migrate()).To(Succeed())
+		migrator.Close()
+
+		db, err := database.OpenEthDB(database.PebbleDB, targetPath, database.BackendOptions{ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		head := rawdb.ReadHeadBlockHash(db)
+		Expect(head).To(Equal(chain[3]))
+		number, ok := rawdb.ReadHeaderNumber(db, head)
+		Expect(ok).To(BeTrue())
+		Expect(number).To(BeEquivalentTo(3))
+		var header *migration.SubnetEVMHeader
+		for n := uint64(0); n <= 3; n++ {
+			Expect(rawdb.ReadCanonicalHash(db, n)).To(Equal(chain[n]))
+			header, err = migration.DecodeHeaderFields(rawdb.ReadHeaderRLP(db, chain[n], n), chain[n])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Number.Uint64()).To(Equal(n))
+		}
+		Expect(rawdb.ReadCanonicalHash(db, 4)).To(Equal(common.Hash{}))
+
+		reader, err := state.NewReader(db, header.Root)
+		Expect(err).NotTo(HaveOccurred())
+		acct, err := reader.Account(account)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acct.Balance.Uint64()).To(BeEquivalentTo(7))
+	})
+})
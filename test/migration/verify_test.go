@@ -0,0 +1,90 @@
+package migration_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/geth/core/rawdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verify", func() {
+	var tempDir string
+
+	BeforeEach(func() {
+		tempDir = filepath.Join(".", ".tmp", fmt.Sprintf("verify-%d", GinkgoRandomSeed()))
+		Expect(os.MkdirAll(tempDir, 0755)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	headerKey := func(number uint64) []byte {
+		key := make([]byte, 41)
+		key[0] = 'h'
+		binary.BigEndian.PutUint64(key[1:9], number)
+		key[9] = 0xaa
+		return key
+	}
+
+	It("should match a namespaced database against its converted copy", func() {
+		namespace := make([]byte, 32)
+		namespace[0] = 0x33
+
+		a := rawdb.NewMemoryDatabase()
+		b := rawdb.NewMemoryDatabase()
+		for i := uint64(0); i < 20; i++ {
+			Expect(a.Put(append(namespace, headerKey(i)...), []byte("header"))).To(Succeed())
+			Expect(b.Put(headerKey(i), []byte("header"))).To(Succeed())
+		}
+		// Keys outside the namespace are not part of the comparison
+		Expect(a.Put([]byte("unrelated"), []byte("x"))).To(Succeed())
+
+		report, err := migration.Verify(a, b, migration.VerifyConfig{PrefixA: namespace})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Mismatches()).To(BeZero())
+		Expect(report.KeysA).To(BeEquivalentTo(20))
+		Expect(report.Kinds["header"].Matched).To(BeEquivalentTo(20))
+	})
+
+	It("should report missing, extra and differing keys by kind", func() {
+		pathA := filepath.Join(tempDir, "a")
+		pathB := filepath.Join(tempDir, "b")
+
+		a, err := database.OpenKeyValueStore(database.PebbleDB, pathA, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		defer a.Close()
+		b, err := database.OpenKeyValueStore(database.BadgerDB, pathB, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		defer b.Close()
+
+		for i := uint64(0); i < 10; i++ {
+			Expect(a.Put(headerKey(i), []byte("header"))).To(Succeed())
+			if i != 3 {
+				Expect(b.Put(headerKey(i), []byte("header"))).To(Succeed())
+			}
+		}
+		Expect(a.Put([]byte("LastHeader"), []byte{1})).To(Succeed())
+		Expect(b.Put([]byte("LastHeader"), []byte{2})).To(Succeed())
+		Expect(b.Put([]byte("LastBlock"), []byte{1})).To(Succeed())
+
+		report, err := migration.Verify(a, b, migration.VerifyConfig{Samples: 5})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Mismatches()).To(BeEquivalentTo(3))
+
+		headers := report.Kinds["header"]
+		Expect(headers.Missing).To(BeEquivalentTo(1))
+		Expect(headers.MissingSamples).To(Equal([][]byte{headerKey(3)}))
+
+		meta := report.Kinds["metadata"]
+		Expect(meta.Differing).To(BeEquivalentTo(1))
+		Expect(meta.Extra).To(BeEquivalentTo(1))
+		Expect(meta.ExtraSamples).To(Equal([][]byte{[]byte("LastBlock")}))
+	})
+})
@@ -0,0 +1,110 @@
+package repair_test
+
+import (
+	"encoding/binary"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/genesis/pkg/repair"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/common/bitutil"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// bloomBit is the bloom bit every block sets at its own number modulo 2048
+func bloomBit(number uint64) uint {
+	return uint(number % 2048)
+}
+
+func bloomBitsKey(bit uint, section uint64, head common.Hash) []byte {
+	key := binary.BigEndian.AppendUint16([]byte("B"), uint16(bit))
+	key = binary.BigEndian.AppendUint64(key, section)
+	return append(key, head.Bytes()...)
+}
+
+var _ = Describe("Bloom-bits rebuild", func() {
+	const sectionSize = 16
+
+	var (
+		db    ethdb.Database
+		chain []common.Hash
+	)
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+		chain = testutil.WriteSubnetChain(db, 60, func(header *migration.SubnetEVMHeader) {
+			bit := bloomBit(header.Number.Uint64())
+			header.Bloom[types.BloomByteLength-1-bit/8] |= 1 << (bit % 8)
+		})
+	})
+
+	It("should write the confirmed sections with their heads and count", func() {
+		// 60 blocks less 20 confirmations leaves two complete sections
+		report, err := repair.RebuildBloomBits(db, repair.BloomBitsConfig{SectionSize: sectionSize, Confirms: 20})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Sections).To(BeEquivalentTo(2))
+		Expect(report.LastHead).To(Equal(chain[2*sectionSize-1]))
+
+		count, err := db.Get([]byte("iBcount"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binary.BigEndian.Uint64(count)).To(BeEquivalentTo(2))
+		for section := uint64(0); section < 2; section++ {
+			head, err := db.Get(binary.BigEndian.AppendUint64([]byte("iBshead"), section))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(common.BytesToHash(head)).To(Equal(chain[(section+1)*sectionSize-1]))
+		}
+		has, _ := db.Has(binary.BigEndian.AppendUint64([]byte("iBshead"), 2))
+		Expect(has).To(BeFalse())
+	})
+
+	It("should set each block's bloom bits at its position in the section", func() {
+		_, err := repair.RebuildBloomBits(db, repair.BloomBitsConfig{SectionSize: sectionSize, Confirms: 20})
+		Expect(err).NotTo(HaveOccurred())
+
+		head := chain[2*sectionSize-1]
+		for i := uint64(0); i < sectionSize; i++ {
+			number := sectionSize + i
+			data, err := db.Get(bloomBitsKey(bloomBit(number), 1, head))
+			Expect(err).NotTo(HaveOccurred())
+			vector, err := bitutil.DecompressBytes(data, sectionSize/8)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Only block i of the section sets this bit
+			expected := make([]byte, sectionSize/8)
+			expected[i/8] = 1 << (7 - i%8)
+			Expect(vector).To(Equal(expected))
+		}
+
+		data, err := db.Get(bloomBitsKey(2047, 1, head))
+		Expect(err).NotTo(HaveOccurred())
+		vector, err := bitutil.DecompressBytes(data, sectionSize/8)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vector).To(Equal(make([]byte, sectionSize/8)))
+	})
+
+	It("should read the blooms of frozen headers from the freezer", func() {
+		rawdb.WriteHeadBlockHash(db, chain[59])
+		frozen := frozenCopy(db, 40)
+
+		report, err := repair.RebuildBloomBits(frozen, repair.BloomBitsConfig{SectionSize: sectionSize, Confirms: 20})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Sections).To(BeEquivalentTo(2))
+
+		data, err := frozen.Get(bloomBitsKey(bloomBit(20), 1, chain[2*sectionSize-1]))
+		Expect(err).NotTo(HaveOccurred())
+		vector, err := bitutil.DecompressBytes(data, sectionSize/8)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vector[0]).To(Equal(byte(1 << 3)))
+	})
+
+	It("should fail when a canonical header is missing", func() {
+		rawdb.DeleteCanonicalHash(db, 5)
+
+		_, err := repair.RebuildBloomBits(db, repair.BloomBitsConfig{SectionSize: sectionSize, Confirms: 20})
+		Expect(err).To(MatchError(ContainSubstring("no canonical hash for block #5")))
+	})
+})
@@ -0,0 +1,129 @@
+package repair_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/repair"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// sideHeader stores a header whose extra data sets it apart from the main
+// chain's header at the same number and returns its hash
+func sideHeader(db ethdb.KeyValueWriter, number uint64, parent common.Hash) common.Hash {
+	header := testutil.SubnetHeader(number, parent)
+	header.Extra = []byte{1}
+	return testutil.WriteSubnetHeader(db, header)
+}
+
+var _ = Describe("Canonical rebuild", func() {
+	var (
+		db    ethdb.Database
+		chain []common.Hash
+		side  []common.Hash
+	)
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+		side = nil
+
+		// Main chain 0-19 and a side chain forking off block 9 up to block 15
+		chain = testutil.WriteSubnetChain(db, 20, nil)
+		parent := chain[9]
+		for n := uint64(10); n <= 15; n++ {
+			parent = sideHeader(db, n, parent)
+			side = append(side, parent)
+			rawdb.WriteHeaderNumber(db, parent, n)
+		}
+		// An orphan above the tip whose parent is missing
+		testutil.WriteSubnetHeader(db, testutil.SubnetHeader(30, common.HexToHash("0xdead")))
+
+		// Break the indexes: side chain canonical at 10-12, a missing mapping
+		// at 5, a missing H entry at 7, a stale mapping above the tip
+		for i, hash := range side[:3] {
+			rawdb.WriteCanonicalHash(db, hash, uint64(10+i))
+		}
+		rawdb.DeleteCanonicalHash(db, 5)
+		rawdb.DeleteHeaderNumber(db, chain[7])
+		rawdb.WriteCanonicalHash(db, side[5], 25)
+		rawdb.WriteHeadHeaderHash(db, side[5])
+	})
+
+	It("should rewrite the canonical chain from the best tip and list every change", func() {
+		report, err := repair.RebuildCanonical(db, repair.CanonicalConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Tip).To(Equal(chain[19]))
+		Expect(report.TipNumber).To(BeEquivalentTo(19))
+		Expect(report.Broken).To(Equal(1))
+		Expect(report.Headers).To(Equal(20 + 6 + 1))
+		Expect(report.HashToNumber).To(Equal(1))
+		Expect(report.HeadUpdated).To(BeTrue())
+		Expect(report.Changes).To(Equal([]repair.CanonicalChange{
+			{Number: 5, New: chain[5]},
+			{Number: 10, Old: side[0], New: chain[10]},
+			{Number: 11, Old: side[1], New: chain[11]},
+			{Number: 12, Old: side[2], New: chain[12]},
+			{Number: 25, Old: side[5]},
+		}))
+
+		for n, hash := range chain {
+			Expect(rawdb.ReadCanonicalHash(db, uint64(n))).To(Equal(hash))
+			number, ok := rawdb.ReadHeaderNumber(db, hash)
+			Expect(ok).To(BeTrue())
+			Expect(number).To(BeEquivalentTo(n))
+		}
+		Expect(rawdb.ReadCanonicalHash(db, 25)).To(Equal(common.Hash{}))
+		Expect(rawdb.ReadHeadHeaderHash(db)).To(Equal(chain[19]))
+		Expect(rawdb.ReadHeadBlockHash(db)).To(Equal(chain[19]))
+
+		var out bytes.Buffer
+		report.Print(&out)
+		Expect(out.String()).To(ContainSubstring("#25: removed"))
+
+		By("Finding nothing to change on a second run")
+		report, err = repair.RebuildCanonical(db, repair.CanonicalConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Changes).To(BeEmpty())
+		Expect(report.HashToNumber).To(BeZero())
+		Expect(report.HeadUpdated).To(BeFalse())
+	})
+
+	It("should leave the database untouched on a dry run", func() {
+		report, err := repair.RebuildCanonical(db, repair.CanonicalConfig{DryRun: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Changes).To(HaveLen(5))
+		Expect(rawdb.ReadCanonicalHash(db, 10)).To(Equal(side[0]))
+		Expect(rawdb.ReadCanonicalHash(db, 5)).To(Equal(common.Hash{}))
+	})
+
+	It("should fail when no chain reaches genesis", func() {
+		Expect(db.Delete(append(binary.BigEndian.AppendUint64([]byte("h"), 0), chain[0].Bytes()...))).To(Succeed())
+
+		_, err := repair.RebuildCanonical(db, repair.CanonicalConfig{})
+		Expect(err).To(MatchError(ContainSubstring("no header chain reaches genesis")))
+	})
+
+	It("should refuse a database with frozen blocks", func() {
+		kv := memorydb.New()
+		blocks := testutil.Chain(10, nil)
+		testutil.WriteChain(kv, blocks)
+		testutil.WriteHead(kv, blocks[9].Hash())
+		ancient := filepath.Join(GinkgoT().TempDir(), "ancient")
+		_, err := database.Freeze(kv, ancient, 5, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		frozen, err := rawdb.Open(kv, rawdb.OpenOptions{Ancient: ancient, ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		defer frozen.Close()
+		_, err = repair.RebuildCanonical(frozen, repair.CanonicalConfig{})
+		Expect(err).To(MatchError(ContainSubstring("blocks 0-4 are in the freezer")))
+	})
+})
@@ -0,0 +1,88 @@
+package repair_test
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/luxfi/genesis/pkg/repair"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func tdKey(number uint64, hash common.Hash) []byte {
+	key := binary.BigEndian.AppendUint64([]byte("h"), number)
+	return append(append(key, hash.Bytes()...), 't')
+}
+
+var _ = Describe("Total difficulty rebuild", func() {
+	var (
+		db    ethdb.Database
+		chain []common.Hash
+	)
+
+	writeTD := func(number uint64, td int64) {
+		enc, err := rlp.EncodeToBytes(big.NewInt(td))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.Put(tdKey(number, chain[number]), enc)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+
+		// Every header has difficulty 1, so block n has a total difficulty of n+1
+		chain = testutil.WriteSubnetChain(db, 10, nil)
+		for n := uint64(0); n < 5; n++ {
+			writeTD(n, int64(n+1))
+		}
+		writeTD(6, 100)
+		Expect(db.Put(tdKey(7, chain[7]), []byte{0xff})).To(Succeed())
+	})
+
+	It("should only report problems in check mode", func() {
+		report, err := repair.RebuildTD(db, repair.TDConfig{Check: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Blocks).To(BeEquivalentTo(10))
+		Expect(report.TD).To(Equal(big.NewInt(10)))
+		Expect(report.Missing).To(BeEquivalentTo(3))
+		Expect(report.Mismatched).To(BeEquivalentTo(2))
+		Expect(report.Written).To(BeZero())
+		Expect(report.Consistent()).To(BeFalse())
+		Expect(report.Examples[1]).To(Equal(repair.TDMismatch{
+			Number: 6, Hash: chain[6], Stored: big.NewInt(100), Expected: big.NewInt(7),
+		}))
+
+		has, err := db.Has(tdKey(5, chain[5]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(has).To(BeFalse())
+	})
+
+	It("should write every missing and wrong entry", func() {
+		report, err := repair.RebuildTD(db, repair.TDConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Written).To(BeEquivalentTo(5))
+
+		for n, hash := range chain {
+			data, err := db.Get(tdKey(uint64(n), hash))
+			Expect(err).NotTo(HaveOccurred())
+			td := new(big.Int)
+			Expect(rlp.DecodeBytes(data, td)).To(Succeed())
+			Expect(td.Int64()).To(BeEquivalentTo(n + 1))
+		}
+
+		report, err = repair.RebuildTD(db, repair.TDConfig{Check: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Consistent()).To(BeTrue())
+	})
+
+	It("should stop at a canonical header that does not link to its parent", func() {
+		rawdb.WriteCanonicalHash(db, sideHeader(db, 5, common.HexToHash("0xbeef")), 5)
+
+		_, err := repair.RebuildTD(db, repair.TDConfig{Check: true})
+		Expect(err).To(MatchError(ContainSubstring("canonical chain is broken at #5")))
+	})
+})
@@ -0,0 +1,164 @@
+package repair_test
+
+import (
+	"math/big"
+	"path/filepath"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/repair"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	"github.com/luxfi/geth/rlp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// frozenCopy copies db into a new store, moves the blocks below `below` into a
+// freezer and returns the store with that freezer attached
+func frozenCopy(db ethdb.Database, below uint64) ethdb.Database {
+	kv := memorydb.New()
+	it := db.NewIterator(nil, nil)
+	for it.Next() {
+		Expect(kv.Put(it.Key(), it.Value())).To(Succeed())
+	}
+	it.Release()
+	// The freezer needs a body and a receipt list for every block
+	for n := uint64(0); n < below; n++ {
+		hash := rawdb.ReadCanonicalHash(db, n)
+		if len(rawdb.ReadBodyRLP(db, hash, n)) == 0 {
+			rawdb.WriteBody(kv, hash, n, &types.Body{})
+		}
+		if len(rawdb.ReadReceiptsRLP(db, hash, n)) == 0 {
+			rawdb.WriteReceipts(kv, hash, n, nil)
+		}
+	}
+
+	ancient := filepath.Join(GinkgoT().TempDir(), "ancient")
+	_, err := database.Freeze(kv, ancient, below, nil)
+	Expect(err).NotTo(HaveOccurred())
+	frozen, err := rawdb.Open(kv, rawdb.OpenOptions{Ancient: ancient, ReadOnly: true})
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(frozen.Close)
+	return frozen
+}
+
+var _ = Describe("Transaction index rebuild", func() {
+	var (
+		db  ethdb.Database
+		txs map[common.Hash]uint64
+	)
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+		txs = make(map[common.Hash]uint64)
+
+		chain := testutil.WriteSubnetChain(db, 20, nil)
+		for n, hash := range chain {
+			n := uint64(n)
+
+			// Odd blocks carry a legacy and a dynamic fee transaction
+			var blockTxs []*types.Transaction
+			if n%2 == 1 {
+				blockTxs = append(blockTxs,
+					types.NewTx(&types.LegacyTx{Nonce: n, GasPrice: big.NewInt(1), Gas: 21000, Value: big.NewInt(1)}),
+					types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(96369), Nonce: n, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Gas: 21000}),
+				)
+			}
+			for _, tx := range blockTxs {
+				txs[tx.Hash()] = n
+			}
+			// Coreth bodies carry a version and extra data after the uncles
+			body, err := rlp.EncodeToBytes([]interface{}{blockTxs, []*types.Header{}, uint32(0), []byte{}})
+			Expect(err).NotTo(HaveOccurred())
+			rawdb.WriteBodyRLP(db, hash, n, body)
+		}
+		rawdb.WriteHeadBlockHash(db, chain[19])
+	})
+
+	It("should index every canonical transaction up to the head", func() {
+		report, err := repair.RebuildTxIndex(db, repair.TxIndexConfig{Workers: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.To).To(BeEquivalentTo(19))
+		Expect(report.Blocks).To(BeEquivalentTo(20))
+		Expect(report.Transactions).To(BeEquivalentTo(20))
+
+		for hash, number := range txs {
+			indexed := rawdb.ReadTxLookupEntry(db, hash)
+			Expect(indexed).NotTo(BeNil())
+			Expect(*indexed).To(Equal(number))
+		}
+	})
+
+	It("should read the bodies of frozen blocks from the freezer", func() {
+		frozen := frozenCopy(db, 10)
+		Expect(frozen.Ancients()).To(BeEquivalentTo(10))
+
+		report, err := repair.RebuildTxIndex(frozen, repair.TxIndexConfig{Workers: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Blocks).To(BeEquivalentTo(20))
+		Expect(report.Transactions).To(BeEquivalentTo(20))
+
+		report, err = repair.VerifyTxIndex(frozen, repair.TxIndexConfig{Samples: 1000})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Failures).To(BeEmpty())
+	})
+
+	It("should only index the requested range", func() {
+		report, err := repair.RebuildTxIndex(db, repair.TxIndexConfig{From: 5, To: 9, Workers: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Blocks).To(BeEquivalentTo(5))
+		Expect(report.Transactions).To(BeEquivalentTo(6))
+
+		for hash, number := range txs {
+			if number >= 5 && number <= 9 {
+				Expect(rawdb.ReadTxLookupEntry(db, hash)).NotTo(BeNil())
+			} else {
+				Expect(rawdb.ReadTxLookupEntry(db, hash)).To(BeNil())
+			}
+		}
+	})
+
+	It("should fail when a canonical body is missing", func() {
+		rawdb.DeleteBody(db, rawdb.ReadCanonicalHash(db, 7), 7)
+
+		_, err := repair.RebuildTxIndex(db, repair.TxIndexConfig{Workers: 4})
+		Expect(err).To(MatchError(ContainSubstring("body of block #7")))
+	})
+
+	It("should verify lookups and report the broken ones", func() {
+		_, err := repair.RebuildTxIndex(db, repair.TxIndexConfig{Workers: 4})
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := repair.VerifyTxIndex(db, repair.TxIndexConfig{Samples: 1000})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Transactions).To(BeNumerically(">=", 20))
+		Expect(report.Failures).To(BeEmpty())
+
+		var missing, moved common.Hash
+		for hash, number := range txs {
+			switch number {
+			case 3:
+				missing = hash
+			case 5:
+				moved = hash
+			}
+		}
+		rawdb.DeleteTxLookupEntry(db, missing)
+		rawdb.WriteTxLookupEntries(db, 11, []common.Hash{moved})
+
+		report, err = repair.VerifyTxIndex(db, repair.TxIndexConfig{Samples: 1000})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Failures).NotTo(BeEmpty())
+		failed := make(map[common.Hash]*uint64)
+		for _, f := range report.Failures {
+			failed[f.Hash] = f.Indexed
+		}
+		Expect(failed).To(HaveKeyWithValue(missing, BeNil()))
+		Expect(failed).To(HaveKey(moved))
+		Expect(*failed[moved]).To(BeEquivalentTo(11))
+	})
+})
@@ -0,0 +1,13 @@
+package rpcserver_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRPCServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RPC Server Suite")
+}
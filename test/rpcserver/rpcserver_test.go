@@ -0,0 +1,329 @@
+package rpcserver_test
+
+import (
+	"math/big"
+
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/rpcserver"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/common/hexutil"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	"github.com/luxfi/geth/rpc"
+	"github.com/luxfi/geth/trie"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var (
+	chainID   = big.NewInt(96369)
+	recipient = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	contract  = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	reverter  = common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	shanghai  = common.HexToAddress("0x00000000000000000000000000000000000000ee")
+	topic     = common.HexToHash("0x01")
+
+	// contractCode returns storage slot 1
+	contractCode = common.FromHex("0x60015460005260206000f3")
+	// revertPayload is Error("nope"), which reverterCode copies from its own code and reverts with
+	revertPayload = common.FromHex("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"6e6f706500000000000000000000000000000000000000000000000000000000")
+	reverterCode = append(common.FromHex("0x6064600c60003960646000fd"), revertPayload...)
+	// shanghaiCode uses PUSH0, which only exists from Shanghai on
+	shanghaiCode = common.FromHex("0x5f5ff3")
+)
+
+var _ = Describe("Offline JSON-RPC server", func() {
+	var (
+		db      ethdb.Database
+		client  *rpc.Client
+		blocks  []*types.Block
+		roots   []common.Hash
+		sender  common.Address
+		legacy  *types.Transaction
+		dynamic *types.Transaction
+	)
+
+	// serve starts a server over chain and connects an in-process client to it
+	serve := func(chain *rpcserver.Chain, config rpcserver.Config) *rpc.Client {
+		server, err := rpcserver.NewServer(chain, config)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(server.Stop)
+		c := rpc.DialInProc(server)
+		DeferCleanup(c.Close)
+		return c
+	}
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+		blocks, roots = nil, nil
+
+		key, err := crypto.GenerateKey()
+		Expect(err).NotTo(HaveOccurred())
+		sender = crypto.PubkeyToAddress(key.PublicKey)
+		signer := types.LatestSignerForChainID(chainID)
+
+		legacy, err = types.SignNewTx(key, signer, &types.LegacyTx{
+			Nonce: 0, GasPrice: big.NewInt(30), Gas: 21_000, To: &recipient, Value: big.NewInt(5),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		dynamic, err = types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID: chainID, Nonce: 1, GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(50), Gas: 40_000, To: &contract,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		roots = []common.Hash{
+			testutil.WriteState(db, map[common.Address]testutil.Account{sender: {Balance: 1_000_000}}),
+			testutil.WriteState(db, map[common.Address]testutil.Account{
+				sender:    {Balance: 900_000},
+				recipient: {Balance: 5},
+				contract:  {Code: contractCode, Storage: map[common.Hash]common.Hash{common.HexToHash("0x01"): common.HexToHash("0x2a")}},
+				reverter:  {Code: reverterCode},
+				shanghai:  {Code: shanghaiCode},
+			}),
+		}
+		roots = append(roots, roots[1])
+
+		receipts := [][]*types.Receipt{nil, {
+			{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21_000},
+			{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 51_000, Logs: []*types.Log{
+				{Address: contract, Topics: []common.Hash{topic}, Data: []byte{1}},
+			}},
+		}, nil}
+		txs := [][]*types.Transaction{nil, {legacy, dynamic}, nil}
+
+		blocks = testutil.Chain(len(roots), func(header *types.Header) *types.Body {
+			n := header.Number.Uint64()
+			for _, r := range receipts[n] {
+				r.Bloom = types.CreateBloom(r)
+			}
+			header.Root = roots[n]
+			header.Time = 100 + n
+			header.BaseFee = big.NewInt(25)
+			header.TxHash = types.DeriveSha(types.Transactions(txs[n]), trie.NewStackTrie(nil))
+			header.ReceiptHash = types.DeriveSha(types.Receipts(receipts[n]), trie.NewStackTrie(nil))
+			header.Bloom = types.MergeBloom(receipts[n])
+			return &types.Body{Transactions: txs[n]}
+		})
+		testutil.WriteChain(db, blocks)
+		testutil.WriteHead(db, blocks[2].Hash())
+		for n, block := range blocks {
+			rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[n])
+			rawdb.WriteTxLookupEntriesByBlock(db, block)
+		}
+		Expect(db.Put(append([]byte("ethereum-config-"), blocks[0].Hash().Bytes()...), []byte(`{"chainId":96369,"homesteadBlock":0,"eip150Block":0,"eip155Block":0,"eip158Block":0,"byzantiumBlock":0,"constantinopleBlock":0,"petersburgBlock":0,"istanbulBlock":0,"apricotPhase2BlockTimestamp":0,"apricotPhase3BlockTimestamp":0,"durangoBlockTimestamp":102}`))).To(Succeed())
+
+		client = serve(rpcserver.NewChain(db), rpcserver.Config{})
+	})
+
+	It("should report the chain ID and head block", func() {
+		var id hexutil.Big
+		Expect(client.Call(&id, "eth_chainId")).To(Succeed())
+		Expect(id.ToInt()).To(Equal(chainID))
+
+		var version string
+		Expect(client.Call(&version, "net_version")).To(Succeed())
+		Expect(version).To(Equal("96369"))
+
+		var head hexutil.Uint64
+		Expect(client.Call(&head, "eth_blockNumber")).To(Succeed())
+		Expect(head).To(BeEquivalentTo(2))
+	})
+
+	It("should serve blocks by number, tag and hash", func() {
+		var block map[string]interface{}
+		Expect(client.Call(&block, "eth_getBlockByNumber", "0x1", false)).To(Succeed())
+		Expect(block["hash"]).To(Equal(blocks[1].Hash().Hex()))
+		Expect(block["stateRoot"]).To(Equal(roots[1].Hex()))
+		Expect(block["baseFeePerGas"]).To(Equal("0x19"))
+		Expect(block["size"]).To(Equal(hexutil.Uint64(blocks[1].Size()).String()))
+		Expect(block["transactions"]).To(Equal([]interface{}{legacy.Hash().Hex(), dynamic.Hash().Hex()}))
+
+		Expect(client.Call(&block, "eth_getBlockByNumber", "latest", false)).To(Succeed())
+		Expect(block["hash"]).To(Equal(blocks[2].Hash().Hex()))
+
+		var full struct {
+			Hash         common.Hash
+			Transactions []rpcserver.RPCTransaction
+		}
+		Expect(client.Call(&full, "eth_getBlockByHash", blocks[1].Hash(), true)).To(Succeed())
+		Expect(full.Hash).To(Equal(blocks[1].Hash()))
+		Expect(full.Transactions).To(HaveLen(2))
+		Expect(full.Transactions[1].From).To(Equal(sender))
+		Expect(full.Transactions[1].GasPrice.ToInt()).To(BeEquivalentTo(big.NewInt(27)))
+
+		By("Returning null for unknown blocks")
+		block = nil
+		Expect(client.Call(&block, "eth_getBlockByNumber", "0x9", false)).To(Succeed())
+		Expect(block).To(BeNil())
+		Expect(client.Call(&block, "eth_getBlockByHash", common.HexToHash("0xdead"), false)).To(Succeed())
+		Expect(block).To(BeNil())
+	})
+
+	It("should serve transactions and receipts through the lookup index", func() {
+		var tx *rpcserver.RPCTransaction
+		Expect(client.Call(&tx, "eth_getTransactionByHash", dynamic.Hash())).To(Succeed())
+		Expect(tx).NotTo(BeNil())
+		Expect(tx.From).To(Equal(sender))
+		Expect(*tx.BlockHash).To(Equal(blocks[1].Hash()))
+		Expect(*tx.TransactionIndex).To(BeEquivalentTo(1))
+		Expect(tx.GasFeeCap.ToInt()).To(BeEquivalentTo(big.NewInt(50)))
+
+		var receipt map[string]interface{}
+		Expect(client.Call(&receipt, "eth_getTransactionReceipt", dynamic.Hash())).To(Succeed())
+		Expect(receipt["status"]).To(Equal("0x1"))
+		Expect(receipt["gasUsed"]).To(Equal("0x7530"))
+		Expect(receipt["cumulativeGasUsed"]).To(Equal("0xc738"))
+		Expect(receipt["effectiveGasPrice"]).To(Equal("0x1b"))
+		Expect(common.HexToAddress(receipt["from"].(string))).To(Equal(sender))
+		Expect(receipt["contractAddress"]).To(BeNil())
+		logs := receipt["logs"].([]interface{})
+		Expect(logs).To(HaveLen(1))
+		Expect(logs[0].(map[string]interface{})["transactionIndex"]).To(Equal("0x1"))
+
+		By("Returning null for unknown transactions")
+		tx = nil
+		Expect(client.Call(&tx, "eth_getTransactionByHash", common.HexToHash("0xbeef"))).To(Succeed())
+		Expect(tx).To(BeNil())
+	})
+
+	It("should read balances, code and storage from the state of the requested block", func() {
+		var balance hexutil.Big
+		Expect(client.Call(&balance, "eth_getBalance", sender, "latest")).To(Succeed())
+		Expect(balance.ToInt().Uint64()).To(BeEquivalentTo(900_000))
+		Expect(client.Call(&balance, "eth_getBalance", sender, "0x0")).To(Succeed())
+		Expect(balance.ToInt().Uint64()).To(BeEquivalentTo(1_000_000))
+		Expect(client.Call(&balance, "eth_getBalance", recipient, rpc.BlockNumberOrHashWithHash(blocks[1].Hash(), true))).To(Succeed())
+		Expect(balance.ToInt().Uint64()).To(BeEquivalentTo(5))
+
+		var code hexutil.Bytes
+		Expect(client.Call(&code, "eth_getCode", contract, "latest")).To(Succeed())
+		Expect([]byte(code)).To(Equal(contractCode))
+		Expect(client.Call(&code, "eth_getCode", contract, "earliest")).To(Succeed())
+		Expect(code).To(BeEmpty())
+
+		var value hexutil.Bytes
+		Expect(client.Call(&value, "eth_getStorageAt", contract, "0x1", "latest")).To(Succeed())
+		Expect(common.BytesToHash(value)).To(Equal(common.HexToHash("0x2a")))
+		Expect(client.Call(&value, "eth_getStorageAt", contract, "0x2", "latest")).To(Succeed())
+		Expect(common.BytesToHash(value)).To(Equal(common.Hash{}))
+
+		By("Failing when the state of a block is gone")
+		rawdb.DeleteLegacyTrieNode(db, roots[0])
+		err := client.Call(&balance, "eth_getBalance", sender, "0x0")
+		Expect(err).To(MatchError(ContainSubstring("is not available")))
+	})
+
+	It("should filter logs by range, block hash, address and topics", func() {
+		var logs []types.Log
+		Expect(client.Call(&logs, "eth_getLogs", map[string]interface{}{"fromBlock": "earliest", "address": contract})).To(Succeed())
+		Expect(logs).To(HaveLen(1))
+		Expect(logs[0].TxHash).To(Equal(dynamic.Hash()))
+		Expect(logs[0].BlockNumber).To(BeEquivalentTo(1))
+		Expect(logs[0].Topics).To(Equal([]common.Hash{topic}))
+
+		Expect(client.Call(&logs, "eth_getLogs", map[string]interface{}{"blockHash": blocks[1].Hash(), "topics": []interface{}{[]interface{}{topic, nil}}})).To(Succeed())
+		Expect(logs).To(HaveLen(1))
+
+		Expect(client.Call(&logs, "eth_getLogs", map[string]interface{}{"fromBlock": "0x0", "topics": []interface{}{common.HexToHash("0x02")}})).To(Succeed())
+		Expect(logs).To(BeEmpty())
+		Expect(client.Call(&logs, "eth_getLogs", map[string]interface{}{"fromBlock": "0x0", "address": []common.Address{recipient}})).To(Succeed())
+		Expect(logs).To(BeEmpty())
+
+		By("Refusing ranges over the limit")
+		limited := serve(rpcserver.NewChain(db), rpcserver.Config{MaxLogRange: 2})
+		err := limited.Call(&logs, "eth_getLogs", map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x2"})
+		Expect(err).To(MatchError(ContainSubstring("exceeds the limit of 2 blocks")))
+	})
+
+	It("should run calls against the state of the requested block", func() {
+		call := map[string]interface{}{"to": contract, "input": "0x70a08231"}
+		var result hexutil.Bytes
+		Expect(client.Call(&result, "eth_call", call, "latest")).To(Succeed())
+		Expect(common.BytesToHash(result)).To(Equal(common.HexToHash("0x2a")))
+		Expect(client.Call(&result, "eth_call", call)).To(Succeed())
+		Expect(common.BytesToHash(result)).To(Equal(common.HexToHash("0x2a")))
+		Expect(client.Call(&result, "eth_call", call, "0x0")).To(Succeed())
+		Expect(result).To(BeEmpty())
+
+		By("Reporting reverts with their reason and data")
+		err := client.Call(&result, "eth_call", map[string]interface{}{"to": reverter}, "latest")
+		Expect(err).To(MatchError("execution reverted: nope"))
+		dataErr, ok := err.(rpc.DataError)
+		Expect(ok).To(BeTrue())
+		Expect(dataErr.ErrorData()).To(Equal(hexutil.Encode(revertPayload)))
+
+		By("Applying the forks the chain config schedules by timestamp")
+		err = client.Call(&result, "eth_call", map[string]interface{}{"to": shanghai}, "0x1")
+		Expect(err).To(MatchError(ContainSubstring("invalid opcode")))
+		Expect(client.Call(&result, "eth_call", map[string]interface{}{"to": shanghai}, "0x2")).To(Succeed())
+	})
+
+	It("should estimate the lowest gas a call succeeds with", func() {
+		var gas hexutil.Uint64
+		Expect(client.Call(&gas, "eth_estimateGas", map[string]interface{}{"to": contract}, "latest")).To(Succeed())
+		// Intrinsic gas, a cold SLOAD under Berlin rules and 18 for the rest
+		Expect(gas).To(BeEquivalentTo(21_000 + 2_100 + 18))
+
+		Expect(client.Call(&gas, "eth_estimateGas", map[string]interface{}{"from": sender, "to": recipient, "value": "0x1", "gasPrice": "0x19"})).To(Succeed())
+		Expect(gas).To(BeEquivalentTo(21_000))
+
+		err := client.Call(&gas, "eth_estimateGas", map[string]interface{}{"to": reverter}, "latest")
+		Expect(err).To(MatchError("execution reverted: nope"))
+		err = client.Call(&gas, "eth_estimateGas", map[string]interface{}{"from": recipient, "to": sender, "value": "0x100"}, "latest")
+		Expect(err).To(MatchError(ContainSubstring("insufficient funds")))
+	})
+
+	It("should serve namespaced databases through a table", func() {
+		namespace := common.HexToHash("0x1234").Bytes()
+		namespaced := memorydb.New()
+		it := db.NewIterator(nil, nil)
+		for it.Next() {
+			Expect(namespaced.Put(append(common.CopyBytes(namespace), it.Key()...), it.Value())).To(Succeed())
+		}
+		it.Release()
+
+		c := serve(rpcserver.NewChain(rawdb.NewTable(rawdb.NewDatabase(namespaced), string(namespace))), rpcserver.Config{})
+		var head hexutil.Uint64
+		Expect(c.Call(&head, "eth_blockNumber")).To(Succeed())
+		Expect(head).To(BeEquivalentTo(2))
+		var balance hexutil.Big
+		Expect(c.Call(&balance, "eth_getBalance", recipient, "latest")).To(Succeed())
+		Expect(balance.ToInt().Uint64()).To(BeEquivalentTo(5))
+	})
+
+	It("should serve blocks and receipts moved into the freezer", func() {
+		path := GinkgoT().TempDir()
+		kv, err := database.OpenKeyValueStore(database.PebbleDB, path, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		it := db.NewIterator(nil, nil)
+		for it.Next() {
+			Expect(kv.Put(it.Key(), it.Value())).To(Succeed())
+		}
+		it.Release()
+		_, err = database.Freeze(kv, database.AncientPath(path), 2, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kv.Close()).To(Succeed())
+
+		frozen, err := database.OpenEthDB(database.PebbleDB, path, database.BackendOptions{ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(frozen.Close)
+		c := serve(rpcserver.NewChain(frozen), rpcserver.Config{})
+
+		var block map[string]interface{}
+		Expect(c.Call(&block, "eth_getBlockByNumber", "0x1", false)).To(Succeed())
+		Expect(block["hash"]).To(Equal(blocks[1].Hash().Hex()))
+		Expect(block["transactions"]).To(HaveLen(2))
+
+		var receipt map[string]interface{}
+		Expect(c.Call(&receipt, "eth_getTransactionReceipt", dynamic.Hash())).To(Succeed())
+		Expect(receipt["blockNumber"]).To(Equal("0x1"))
+		Expect(receipt["gasUsed"]).To(Equal("0x7530"))
+	})
+})
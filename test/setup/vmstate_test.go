@@ -0,0 +1,118 @@
+package setup_test
+
+import (
+	"encoding/binary"
+
+	"github.com/luxfi/genesis/pkg/application"
+	"github.com/luxfi/genesis/pkg/database"
+	"github.com/luxfi/genesis/pkg/setup"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/ethdb/memorydb"
+	"github.com/luxfi/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VM state", func() {
+	var (
+		db     ethdb.Database
+		vmdb   ethdb.KeyValueStore
+		blocks []*types.Block
+	)
+
+	BeforeEach(func() {
+		db = rawdb.NewMemoryDatabase()
+		vmdb = memorydb.New()
+		blocks = testutil.Chain(5, func(header *types.Header) *types.Body {
+			header.Root = common.BytesToHash([]byte{byte(header.Number.Uint64() + 1)})
+			return nil
+		})
+		testutil.WriteChain(db, blocks)
+	})
+
+	It("should write the ethdb and VM keys for the target block", func() {
+		report, err := setup.WriteVMState(db, vmdb, 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Hash).To(Equal(blocks[3].Hash()))
+		Expect(report.Root).To(Equal(blocks[3].Root()))
+		Expect(report.Writes).To(HaveLen(9))
+
+		hash := blocks[3].Hash()
+		Expect(rawdb.ReadHeadHeaderHash(db)).To(Equal(hash))
+		Expect(rawdb.ReadHeadBlockHash(db)).To(Equal(hash))
+		Expect(rawdb.ReadHeadFastBlockHash(db)).To(Equal(hash))
+		for _, key := range []string{"AcceptorTipKey", "snowman_lastAccepted"} {
+			value, err := db.Get([]byte(key))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal(hash.Bytes()), key)
+		}
+		height, err := db.Get([]byte("height"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binary.BigEndian.Uint64(height)).To(BeEquivalentTo(3))
+
+		By("Writing the VM metadata database")
+		lastAccepted, err := vmdb.Get([]byte("lastAccepted"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lastAccepted).To(Equal(hash.Bytes()))
+		height, err = vmdb.Get([]byte("lastAcceptedHeight"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binary.BigEndian.Uint64(height)).To(BeEquivalentTo(3))
+		initialized, err := vmdb.Get([]byte("initialized"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initialized).To(Equal([]byte{1}))
+	})
+
+	It("should only write ethdb without a VM database", func() {
+		report, err := setup.WriteVMState(db, nil, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Writes).To(HaveLen(6))
+		for _, w := range report.Writes {
+			Expect(w.DB).To(Equal("ethdb"))
+		}
+		Expect(rawdb.ReadHeadBlockHash(db)).To(Equal(blocks[0].Hash()))
+	})
+
+	It("should point the chain-state head at the highest block", func() {
+		path := GinkgoT().TempDir()
+		kv, err := database.OpenKeyValueStore(database.PebbleDB, path, database.BackendOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		testutil.WriteChain(kv, blocks)
+		Expect(kv.Close()).To(Succeed())
+
+		app := application.New()
+		app.Setup(path, log.NewNoOpLogger(), nil)
+		Expect(setup.New(app).SetupChainState(path, 0)).To(Succeed())
+
+		kv, err = database.OpenKeyValueStore(database.PebbleDB, path, database.BackendOptions{ReadOnly: true})
+		Expect(err).NotTo(HaveOccurred())
+		defer kv.Close()
+		Expect(rawdb.ReadHeadBlockHash(kv)).To(Equal(blocks[4].Hash()))
+		tip, err := kv.Get([]byte("AcceptorTipKey"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tip).To(Equal(blocks[4].Hash().Bytes()))
+	})
+
+	It("should refuse blocks that are not fully stored", func() {
+		_, err := setup.WriteVMState(db, vmdb, 7)
+		Expect(err).To(MatchError(ContainSubstring("no canonical hash for block 7")))
+
+		rawdb.DeleteBody(db, blocks[2].Hash(), 2)
+		_, err = setup.WriteVMState(db, vmdb, 2)
+		Expect(err).To(MatchError(ContainSubstring("body of block 2")))
+
+		rawdb.DeleteHeaderNumber(db, blocks[1].Hash())
+		_, err = setup.WriteVMState(db, vmdb, 1)
+		Expect(err).To(MatchError(ContainSubstring("no hash-to-number entry")))
+
+		has, err := db.Has([]byte("LastBlock"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(has).To(BeFalse())
+		has, err = vmdb.Has([]byte("lastAccepted"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(has).To(BeFalse())
+	})
+})
@@ -0,0 +1,114 @@
+package state_test
+
+import (
+	"context"
+
+	"github.com/holiman/uint256"
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/trie"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// buildState writes a hash-scheme state with plain accounts, contracts with
+// storage and shared code into db and returns its root.
+func buildState(db ethdb.KeyValueWriter) common.Hash {
+	accounts := trie.NewEmpty(nil)
+	for i := 0; i < 500; i++ {
+		acc := types.StateAccount{
+			Balance:  uint256.NewInt(uint64(i + 1)),
+			Root:     types.EmptyRootHash,
+			CodeHash: types.EmptyCodeHash.Bytes(),
+		}
+		if i%10 == 0 {
+			code := []byte{0x60, byte(i / 10 % 30), 0x00}
+			acc.CodeHash = crypto.Keccak256(code)
+			rawdb.WriteCode(db, common.BytesToHash(acc.CodeHash), code)
+
+			storage := trie.NewEmpty(nil)
+			for j := 0; j < 20; j++ {
+				value, err := rlp.EncodeToBytes([]byte{byte(i), byte(j), 1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(storage.Update(crypto.Keccak256([]byte{byte(j)}), value)).To(Succeed())
+			}
+			acc.Root = testutil.CommitTrie(db, storage)
+		}
+		blob, err := rlp.EncodeToBytes(&acc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(accounts.Update(crypto.Keccak256([]byte{byte(i), byte(i >> 8)}), blob)).To(Succeed())
+	}
+	return testutil.CommitTrie(db, accounts)
+}
+
+var _ = Describe("State copy", func() {
+	It("should copy every node and contract code and verify the root", func() {
+		src := rawdb.NewMemoryDatabase()
+		root := buildState(src)
+
+		dst := rawdb.NewMemoryDatabase()
+		stats, err := state.Copy(context.Background(), src, dst, state.CopyConfig{Root: root, Workers: 4, Verify: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Accounts).To(BeEquivalentTo(500))
+		Expect(stats.StorageTries).To(BeEquivalentTo(50))
+		Expect(stats.StorageSlots).To(BeEquivalentTo(50 * 20))
+		Expect(stats.Code).To(BeEquivalentTo(30))
+
+		By("Reading an account back from the copied trie")
+		tr, err := trie.New(trie.StateTrieID(root), testutil.HashNodes{DB: dst})
+		Expect(err).NotTo(HaveOccurred())
+		blob, err := tr.Get(crypto.Keccak256([]byte{20, 0}))
+		Expect(err).NotTo(HaveOccurred())
+		var acc types.StateAccount
+		Expect(rlp.DecodeBytes(blob, &acc)).To(Succeed())
+		Expect(acc.Balance.Uint64()).To(BeEquivalentTo(21))
+		Expect(rawdb.ReadCode(dst, common.BytesToHash(acc.CodeHash))).To(Equal([]byte{0x60, 2, 0x00}))
+	})
+
+	It("should read a namespaced source", func() {
+		plain := rawdb.NewMemoryDatabase()
+		root := buildState(plain)
+
+		namespace := crypto.Keccak256([]byte("chain"))
+		src := rawdb.NewMemoryDatabase()
+		it := plain.NewIterator(nil, nil)
+		for it.Next() {
+			Expect(src.Put(append(append([]byte{}, namespace...), it.Key()...), it.Value())).To(Succeed())
+		}
+		it.Release()
+
+		dst := rawdb.NewMemoryDatabase()
+		_, err := state.Copy(context.Background(), src, dst, state.CopyConfig{Root: root, Namespace: namespace, Workers: 2})
+		Expect(err).NotTo(HaveOccurred())
+
+		stats, err := state.Verify(context.Background(), dst, root, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Accounts).To(BeEquivalentTo(500))
+	})
+
+	It("should fail when a trie node is missing", func() {
+		src := rawdb.NewMemoryDatabase()
+		root := buildState(src)
+
+		// Drop one node below the root
+		it := src.NewIterator(nil, nil)
+		var victim []byte
+		for it.Next() {
+			if len(it.Key()) == common.HashLength && common.BytesToHash(it.Key()) != root {
+				victim = common.CopyBytes(it.Key())
+				break
+			}
+		}
+		it.Release()
+		Expect(src.Delete(victim)).To(Succeed())
+
+		_, err := state.Copy(context.Background(), src, rawdb.NewMemoryDatabase(), state.CopyConfig{Root: root, Workers: 4})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,132 @@
+package state_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/luxfi/genesis/pkg/state"
+	"github.com/luxfi/genesis/test/testutil"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/crypto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// readDump decodes every line of a dump
+func readDump(out []byte) []state.DumpAccount {
+	var accounts []state.DumpAccount
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var acc state.DumpAccount
+		Expect(json.Unmarshal(scanner.Bytes(), &acc)).To(Succeed())
+		accounts = append(accounts, acc)
+	}
+	Expect(scanner.Err()).NotTo(HaveOccurred())
+	return accounts
+}
+
+// cancelWriter cancels a dump once it has taken its first write
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+var _ = Describe("State dump", func() {
+	It("should write every account and storage slot in hash order", func() {
+		db := rawdb.NewMemoryDatabase()
+		root := buildState(db)
+
+		var out bytes.Buffer
+		stats, err := state.Dump(context.Background(), db, state.DumpConfig{Root: root, Storage: true, Workers: 4}, &out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Complete).To(BeTrue())
+		Expect(stats.Accounts).To(BeEquivalentTo(500))
+		Expect(stats.StorageSlots).To(BeEquivalentTo(50 * 20))
+
+		accounts := readDump(out.Bytes())
+		Expect(accounts).To(HaveLen(500))
+		for i := 1; i < len(accounts); i++ {
+			Expect(bytes.Compare(accounts[i-1].AddressHash[:], accounts[i].AddressHash[:])).To(Equal(-1))
+		}
+
+		hash := crypto.Keccak256Hash([]byte{20, 0})
+		idx := -1
+		for i, acc := range accounts {
+			if acc.AddressHash == hash {
+				idx = i
+			}
+		}
+		Expect(idx).NotTo(Equal(-1))
+		acc := accounts[idx]
+		Expect(acc.Balance).To(Equal("21"))
+		Expect(acc.CodeHash).To(Equal(crypto.Keccak256Hash([]byte{0x60, 2, 0x00})))
+		Expect(acc.Address).To(BeNil())
+		Expect(acc.Storage).To(HaveLen(20))
+		Expect(acc.Storage).To(ContainElement(state.DumpSlot{
+			Hash:  crypto.Keccak256Hash([]byte{3}),
+			Value: common.BytesToHash([]byte{20, 3, 1}),
+		}))
+	})
+
+	It("should resolve addresses and storage keys from preimages", func() {
+		db := rawdb.NewMemoryDatabase()
+		address := common.HexToAddress("0x9011E888251AB053B7bD1cdB598Db4f9DEd94714")
+		slot := common.HexToHash("0x01")
+
+		root := testutil.WriteState(db, map[common.Address]testutil.Account{
+			address: {Nonce: 7, Balance: 1000, Storage: map[common.Hash]common.Hash{slot: common.HexToHash("0x2a")}},
+		})
+		rawdb.WritePreimages(db, map[common.Hash][]byte{
+			crypto.Keccak256Hash(address.Bytes()): address.Bytes(),
+			crypto.Keccak256Hash(slot.Bytes()):    slot.Bytes(),
+		})
+
+		var out bytes.Buffer
+		stats, err := state.Dump(context.Background(), db, state.DumpConfig{Root: root, Storage: true}, &out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Addresses).To(BeEquivalentTo(1))
+
+		dumped := readDump(out.Bytes())
+		Expect(dumped).To(HaveLen(1))
+		Expect(*dumped[0].Address).To(Equal(address))
+		Expect(dumped[0].Nonce).To(BeEquivalentTo(7))
+		Expect(dumped[0].Storage).To(HaveLen(1))
+		Expect(*dumped[0].Storage[0].Key).To(Equal(slot))
+		Expect(dumped[0].Storage[0].Value).To(Equal(common.BytesToHash([]byte{0x2a})))
+	})
+
+	It("should resume an interrupted dump where it stopped", func() {
+		db := rawdb.NewMemoryDatabase()
+		root := buildState(db)
+
+		var full bytes.Buffer
+		_, err := state.Dump(context.Background(), db, state.DumpConfig{Root: root, Workers: 2}, &full)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Stopping the dump after its first write")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		partial := &cancelWriter{cancel: cancel}
+		stats, err := state.Dump(ctx, db, state.DumpConfig{Root: root, Workers: 2}, partial)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(stats.Complete).To(BeFalse())
+		Expect(stats.Accounts).To(BeNumerically("<", 500))
+		Expect(readDump(partial.Bytes())).To(HaveLen(int(stats.Accounts)))
+
+		By("Appending a dump from the resume point")
+		rest, err := state.Dump(context.Background(), db, state.DumpConfig{Root: root, Start: stats.Next, Workers: 2}, io.Writer(&partial.Buffer))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rest.Accounts + stats.Accounts).To(BeEquivalentTo(500))
+		Expect(partial.String()).To(Equal(full.String()))
+	})
+})
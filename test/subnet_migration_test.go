@@ -89,6 +89,10 @@ var _ = Describe("SubnetEVM to C-Chain Migration", Ordered, func() {
 			err := migrateBlockRange(migrator, 0, 10)
 			Expect(err).NotTo(HaveOccurred())
 
+			// The migrator keeps the target open; release it for the checks below
+			migrator.Close()
+			migrator = nil
+
 			// Verify genesis block in target database
 			targetOpts := &pebble.Options{ReadOnly: true}
 			tdb, err := pebble.Open(targetDB, targetOpts)
@@ -217,7 +221,6 @@ var _ = Describe("SubnetEVM to C-Chain Migration", Ordered, func() {
 
 // Helper function to migrate a specific block range
 func migrateBlockRange(migrator *migration.SubnetToCChain, start, end uint64) error {
-	// This is a simplified version - the real migration happens inside the tool
-	// For testing, we'll just call the Migrate method which will do a few blocks
-	return nil // The migrator was already tested to work
+	migrator.FromBlock, migrator.ToBlock = start, end
+	return migrator.Migrate()
 }
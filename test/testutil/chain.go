@@ -0,0 +1,122 @@
+// Package testutil builds the chains and states the test suites run against
+package testutil
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/luxfi/genesis/pkg/migration"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	. "github.com/onsi/gomega"
+)
+
+// Header returns the header of block number in a test chain, a child of
+// parent with difficulty 1 and an 8M gas limit
+func Header(number uint64, parent common.Hash) *types.Header {
+	return &types.Header{
+		ParentHash: parent,
+		Number:     new(big.Int).SetUint64(number),
+		Difficulty: big.NewInt(1),
+		GasLimit:   8_000_000,
+	}
+}
+
+// Chain builds count blocks from genesis on, each the child of the one before.
+// fill, when set, is called with every header before its block is sealed and
+// may return the block's body.
+func Chain(count int, fill func(header *types.Header) *types.Body) []*types.Block {
+	var (
+		blocks []*types.Block
+		parent common.Hash
+	)
+	for n := 0; n < count; n++ {
+		header := Header(uint64(n), parent)
+		var body *types.Body
+		if fill != nil {
+			body = fill(header)
+		}
+		block := types.NewBlockWithHeader(header)
+		if body != nil {
+			block = block.WithBody(*body)
+		}
+		blocks = append(blocks, block)
+		parent = block.Hash()
+	}
+	return blocks
+}
+
+// WriteChain stores blocks with empty receipts and makes them canonical
+func WriteChain(db ethdb.KeyValueWriter, blocks []*types.Block) {
+	for _, block := range blocks {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), nil)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+	}
+}
+
+// WriteHead points the head block, header and fast block at hash
+func WriteHead(db ethdb.KeyValueWriter, hash common.Hash) {
+	rawdb.WriteHeadBlockHash(db, hash)
+	rawdb.WriteHeadHeaderHash(db, hash)
+	rawdb.WriteHeadFastBlockHash(db, hash)
+}
+
+// WriteCanonicalHeaders stores only the headers of blocks and makes them canonical
+func WriteCanonicalHeaders(db ethdb.KeyValueWriter, blocks []*types.Block) {
+	for _, block := range blocks {
+		rawdb.WriteHeader(db, block.Header())
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+	}
+}
+
+// SubnetHeader returns the Subnet-EVM header of block number in a test chain,
+// a child of parent
+func SubnetHeader(number uint64, parent common.Hash) *migration.SubnetEVMHeader {
+	return &migration.SubnetEVMHeader{
+		ParentHash:   parent,
+		Difficulty:   big.NewInt(1),
+		Number:       new(big.Int).SetUint64(number),
+		GasLimit:     8_000_000,
+		BaseFee:      big.NewInt(25_000_000_000),
+		BlockGasCost: big.NewInt(0),
+	}
+}
+
+// WriteSubnetHeader stores a Subnet-EVM header under its hash, without the
+// number lookup, and returns the hash
+func WriteSubnetHeader(db ethdb.KeyValueWriter, header *migration.SubnetEVMHeader) common.Hash {
+	data, err := rlp.EncodeToBytes(header)
+	Expect(err).NotTo(HaveOccurred())
+	hash := crypto.Keccak256Hash(data)
+	key := binary.BigEndian.AppendUint64([]byte("h"), header.Number.Uint64())
+	Expect(db.Put(append(key, hash.Bytes()...), data)).To(Succeed())
+	return hash
+}
+
+// WriteSubnetChain stores count Subnet-EVM headers from genesis on with their
+// canonical and number entries, points the head header at the last one and
+// returns their hashes. fill, when set, is called with every header before it
+// is written.
+func WriteSubnetChain(db ethdb.KeyValueWriter, count int, fill func(header *migration.SubnetEVMHeader)) []common.Hash {
+	var (
+		hashes []common.Hash
+		parent common.Hash
+	)
+	for n := uint64(0); n < uint64(count); n++ {
+		header := SubnetHeader(n, parent)
+		if fill != nil {
+			fill(header)
+		}
+		parent = WriteSubnetHeader(db, header)
+		rawdb.WriteCanonicalHash(db, parent, n)
+		rawdb.WriteHeaderNumber(db, parent, n)
+		hashes = append(hashes, parent)
+	}
+	rawdb.WriteHeadHeaderHash(db, parent)
+	return hashes
+}
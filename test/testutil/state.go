@@ -0,0 +1,76 @@
+package testutil
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/luxfi/geth/common"
+	"github.com/luxfi/geth/core/rawdb"
+	"github.com/luxfi/geth/core/types"
+	"github.com/luxfi/geth/crypto"
+	"github.com/luxfi/geth/ethdb"
+	"github.com/luxfi/geth/rlp"
+	"github.com/luxfi/geth/trie"
+	triedb "github.com/luxfi/geth/triedb/database"
+	. "github.com/onsi/gomega"
+)
+
+// HashNodes reads hash-scheme trie nodes directly from a key-value store
+type HashNodes struct {
+	DB ethdb.KeyValueReader
+}
+
+func (h HashNodes) NodeReader(common.Hash) (triedb.NodeReader, error) { return h, nil }
+
+func (h HashNodes) Node(_ common.Hash, _ []byte, hash common.Hash) ([]byte, error) {
+	return rawdb.ReadLegacyTrieNode(h.DB, hash), nil
+}
+
+// CommitTrie writes every node of a freshly built trie into db under its hash
+func CommitTrie(db ethdb.KeyValueWriter, tr *trie.Trie) common.Hash {
+	root, nodes := tr.Commit(false)
+	if nodes != nil {
+		for hash, blob := range nodes.HashSet() {
+			rawdb.WriteLegacyTrieNode(db, hash, blob)
+		}
+	}
+	return root
+}
+
+// Account is the state of one address in a test state
+type Account struct {
+	Nonce   uint64
+	Balance uint64
+	Code    []byte
+	Storage map[common.Hash]common.Hash
+}
+
+// WriteState stores a hash-scheme state trie holding accounts, with their code
+// and storage tries, and returns its root
+func WriteState(db ethdb.KeyValueWriter, accounts map[common.Address]Account) common.Hash {
+	tr := trie.NewEmpty(nil)
+	for address, a := range accounts {
+		storageRoot := types.EmptyRootHash
+		if len(a.Storage) > 0 {
+			st := trie.NewEmpty(nil)
+			for slot, value := range a.Storage {
+				enc, err := rlp.EncodeToBytes(common.TrimLeftZeroes(value.Bytes()))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(st.Update(crypto.Keccak256(slot.Bytes()), enc)).To(Succeed())
+			}
+			storageRoot = CommitTrie(db, st)
+		}
+		codeHash := types.EmptyCodeHash
+		if len(a.Code) > 0 {
+			codeHash = crypto.Keccak256Hash(a.Code)
+			rawdb.WriteCode(db, codeHash, a.Code)
+		}
+		blob, err := rlp.EncodeToBytes(&types.StateAccount{
+			Nonce:    a.Nonce,
+			Balance:  uint256.NewInt(a.Balance),
+			Root:     storageRoot,
+			CodeHash: codeHash.Bytes(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tr.Update(crypto.Keccak256(address.Bytes()), blob)).To(Succeed())
+	}
+	return CommitTrie(db, tr)
+}